@@ -1,31 +1,69 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Структура Worker представляет информацию о работнике.
 type Worker struct {
-	Name      string
-	Position  string
-	Age       int
-	Salary    float64
+	Name     string
+	Position string
+	Age      int
+	Salary   float64
 }
 
-// Функция calculateAverageAge вычисляет средний возраст работников
-func calculateAverageAge(workers []Worker, position string) float64 {
-	var totalAge, count int
+// Структура PositionInfo описывает должность в справочнике: код, используемый в данных,
+// полное название и дополнительные варианты написания, принимаемые в запросах.
+type PositionInfo struct {
+	Code    string
+	Name    string
+	Aliases []string
+}
 
-	// Проходим по каждому работнику в списке.
-	for _, worker := range workers {
-		// Если должность работника совпадает с искомой, учитываем его возраст.
-		if worker.Position == position {
-			totalAge += worker.Age // Суммируем возраст.
-			count++                // Увеличиваем счетчик работников.
+// Справочник должностей.
+var positionCatalog = []PositionInfo{
+	{Code: "Д", Name: "Дизайнер", Aliases: []string{"designer"}},
+	{Code: "С", Name: "Системный администратор", Aliases: []string{"сисадмин", "sysadmin"}},
+}
+
+// Функция resolvePosition находит должность по коду, полному названию или псевдониму
+// без учета регистра.
+func resolvePosition(query string) (PositionInfo, error) {
+	query = strings.TrimSpace(query)
+	for _, info := range positionCatalog {
+		if strings.EqualFold(query, info.Code) || strings.EqualFold(query, info.Name) {
+			return info, nil
+		}
+		for _, alias := range info.Aliases {
+			if strings.EqualFold(query, alias) {
+				return info, nil
+			}
+		}
+	}
+	return PositionInfo{}, fmt.Errorf("неизвестная должность %q", query)
+}
+
+// Функция positionName возвращает читаемое название должности вместе с кодом,
+// например "Дизайнер (Д)". Для кода, которого нет в справочнике, возвращается сам код.
+func positionName(code string) string {
+	for _, info := range positionCatalog {
+		if info.Code == code {
+			return fmt.Sprintf("%s (%s)", info.Name, info.Code)
 		}
 	}
+	return code
+}
+
+// Функция calculateAverageAge вычисляет средний возраст работников
+func calculateAverageAge(workers []Worker, position string) float64 {
+	// Суммируем возраст и считаем работников с указанной должностью.
+	totalAge, count := sumAges(workers, position)
 
 	// Если работников с указанной должностью не найдено, возвращаем 0.
 	if count == 0 {
@@ -36,6 +74,34 @@ func calculateAverageAge(workers []Worker, position string) float64 {
 	return float64(totalAge) / float64(count)
 }
 
+// Функция sumAges возвращает сумму возрастов и количество работников указанной должности.
+// Используется для объединения результатов частей: средние частей нельзя просто усреднять,
+// так как в частях разное количество подходящих работников.
+func sumAges(workers []Worker, position string) (int64, int64) {
+	var totalAge, count int64
+
+	// Проходим по каждому работнику в списке.
+	for _, worker := range workers {
+		// Если должность работника совпадает с искомой, учитываем его возраст.
+		if worker.Position == position {
+			totalAge = addInt64(totalAge, int64(worker.Age)) // Суммируем возраст.
+			count++                                          // Увеличиваем счетчик работников.
+		}
+	}
+	return totalAge, count
+}
+
+// Функция addInt64 складывает два числа и аварийно завершает программу при переполнении.
+// Суммы возрастов накапливаются в int64, чтобы не зависеть от разрядности int, а явная
+// проверка не дает переполнению на очень больших наборах данных незаметно исказить среднее.
+func addInt64(a, b int64) int64 {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		panic(fmt.Sprintf("переполнение int64 при сложении %d и %d", a, b))
+	}
+	return sum
+}
+
 // Функция findMaxSalary находит максимальную зарплату среди работников
 func findMaxSalary(workers []Worker, position string, avgAge float64) float64 {
 	var maxSalary float64
@@ -65,6 +131,62 @@ func abs(x float64) float64 {
 	return x
 }
 
+// Функция cpuModel возвращает модель процессора из /proc/cpuinfo.
+// Если модель определить не удалось, возвращается архитектура.
+func cpuModel() string {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return runtime.GOARCH
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "model name") {
+			if i := strings.Index(line, ":"); i >= 0 {
+				return strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return runtime.GOARCH
+}
+
+// Функция printEnvironment выводит параметры окружения и набора данных,
+// чтобы результаты, полученные на разных машинах, можно было сравнивать.
+func printEnvironment(numWorkers int, position string) {
+	fmt.Printf("Окружение:\n")
+	fmt.Printf("Версия Go: %s\n", runtime.Version())
+	fmt.Printf("ОС: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Процессор: %s\n", cpuModel())
+	fmt.Printf("GOMAXPROCS: %d\n", runtime.GOMAXPROCS(0))
+	fmt.Printf("Количество работников: %d\n", numWorkers)
+	fmt.Printf("Должность: %s\n\n", positionName(position))
+}
+
+// Функция partition делит n элементов на не более чем parts непустых частей.
+// Остаток от деления распределяется по одному элементу на первые части,
+// поэтому размеры частей отличаются не больше чем на единицу.
+// Каждая часть задается полуинтервалом индексов [начало, конец).
+func partition(n, parts int) [][2]int {
+	// Частей не может быть больше, чем элементов, иначе появятся пустые части.
+	if parts > n {
+		parts = n
+	}
+	if parts <= 0 {
+		return nil
+	}
+
+	size, remainder := n/parts, n%parts
+	ranges := make([][2]int, 0, parts)
+	start := 0
+	for i := 0; i < parts; i++ {
+		end := start + size
+		if i < remainder {
+			end++
+		}
+		ranges = append(ranges, [2]int{start, end})
+		start = end
+	}
+	return ranges
+}
+
 // Функция processWithoutConcurrency обрабатывает данные без использования многозадачности.
 func processWithoutConcurrency(workers []Worker, position string) {
 	// Засекаем время начала выполнения.
@@ -75,55 +197,33 @@ func processWithoutConcurrency(workers []Worker, position string) {
 
 	// Количество частей, на которые разбиваем данные.
 	countSize := 3
-	// Размер каждой части.
-	subsetsSize := len(workers) / countSize
+	// Границы частей (пустых частей не бывает).
+	ranges := partition(len(workers), countSize)
 
 	// Срезы для хранения промежуточных результатов.
-	avgAgeResults := make([]float64, countSize)
-	maxSalaryResults := make([]float64, countSize)
-
-	// Поиск среднего возраста в каждой части данных.
-	for i := 0; i < countSize; i++ {
-		func(i int) {
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * subsetsSize
-			endIndex := (i + 1) * subsetsSize
-			// Для последней части корректируем конечный индекс, чтобы не выйти за пределы списка.
-			if i == countSize-1 {
-				endIndex = len(workers)
-			}
-			// Вычисляем средний возраст для текущей части.
-			avgAgeResults[i] = calculateAverageAge(workers[startIndex:endIndex], position)
-		}(i)
-	}
-
-	// Объединяем результаты среднего возраста.
-	var totalAge float64
-	var count int
-	for _, avg := range avgAgeResults {
-		if avg > 0 {
-			totalAge += avg
-			count++
-		}
+	ageTotals := make([]int64, len(ranges))
+	ageCounts := make([]int64, len(ranges))
+	maxSalaryResults := make([]float64, len(ranges))
+
+	// Суммируем возраст в каждой части данных.
+	for i, r := range ranges {
+		ageTotals[i], ageCounts[i] = sumAges(workers[r[0]:r[1]], position)
+	}
+
+	// Объединяем результаты: каждая часть учитывается с весом по числу найденных работников.
+	var totalAge, count int64
+	for i := range ranges {
+		totalAge = addInt64(totalAge, ageTotals[i])
+		count = addInt64(count, ageCounts[i])
 	}
 	// Вычисляем общий средний возраст.
 	if count > 0 {
-		avgAge = totalAge / float64(count)
+		avgAge = float64(totalAge) / float64(count)
 	}
 
 	// Поиск максимальной зарплаты в каждой части данных.
-	for i := 0; i < countSize; i++ {
-		func(i int) {
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * subsetsSize
-			endIndex := (i + 1) * subsetsSize
-			// Для последней части корректируем конечный индекс.
-			if i == countSize-1 {
-				endIndex = len(workers)
-			}
-			// Находим максимальную зарплату для текущей части.
-			maxSalaryResults[i] = findMaxSalary(workers[startIndex:endIndex], position, avgAge)
-		}(i)
+	for i, r := range ranges {
+		maxSalaryResults[i] = findMaxSalary(workers[r[0]:r[1]], position, avgAge)
 	}
 
 	// Объединяем результаты максимальной зарплаты.
@@ -155,62 +255,44 @@ func processWithConcurrency(workers []Worker, position string) {
 
 	// Количество горутин.
 	numGoroutines := 3
-	// Размер каждой части данных.
-	chunkSize := len(workers) / numGoroutines
+	// Границы частей данных: если работников меньше, чем горутин, горутин запускается меньше.
+	ranges := partition(len(workers), numGoroutines)
 
 	// Срезы для хранения промежуточных результатов.
-	avgAgeResults := make([]float64, numGoroutines)
-	maxSalaryResults := make([]float64, numGoroutines)
-
-	// Запускаем горутины для вычисления среднего возраста.
-	wg.Add(numGoroutines)
-	for i := 0; i < numGoroutines; i++ {
-		go func(i int) {
+	ageTotals := make([]int64, len(ranges))
+	ageCounts := make([]int64, len(ranges))
+	maxSalaryResults := make([]float64, len(ranges))
+
+	// Запускаем горутины для суммирования возраста.
+	wg.Add(len(ranges))
+	for i, r := range ranges {
+		go func(i int, r [2]int) {
 			defer wg.Done() // Уменьшаем счетчик WaitGroup при завершении горутины.
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * chunkSize
-			endIndex := (i + 1) * chunkSize
-			// Для последней части корректируем конечный индекс.
-			if i == numGoroutines-1 {
-				endIndex = len(workers)
-			}
-			// Вычисляем средний возраст для текущей части.
-			avgAgeResults[i] = calculateAverageAge(workers[startIndex:endIndex], position)
-		}(i)
+			ageTotals[i], ageCounts[i] = sumAges(workers[r[0]:r[1]], position)
+		}(i, r)
 	}
 
 	// Ждем завершения всех горутин.
 	wg.Wait()
 
-	// Объединяем результаты среднего возраста.
-	var totalAge float64
-	var count int
-	for _, avg := range avgAgeResults {
-		if avg > 0 {
-			totalAge += avg
-			count++
-		}
+	// Объединяем результаты: каждая часть учитывается с весом по числу найденных работников.
+	var totalAge, count int64
+	for i := range ranges {
+		totalAge = addInt64(totalAge, ageTotals[i])
+		count = addInt64(count, ageCounts[i])
 	}
 	// Вычисляем общий средний возраст.
 	if count > 0 {
-		avgAge = totalAge / float64(count)
+		avgAge = float64(totalAge) / float64(count)
 	}
 
 	// Запускаем горутины для поиска максимальной зарплаты.
-	wg.Add(numGoroutines)
-	for i := 0; i < numGoroutines; i++ {
-		go func(i int) {
+	wg.Add(len(ranges))
+	for i, r := range ranges {
+		go func(i int, r [2]int) {
 			defer wg.Done() // Уменьшаем счетчик WaitGroup при завершении горутины.
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * chunkSize
-			endIndex := (i + 1) * chunkSize
-			// Для последней части корректируем конечный индекс.
-			if i == numGoroutines-1 {
-				endIndex = len(workers)
-			}
-			// Находим максимальную зарплату для текущей части.
-			maxSalaryResults[i] = findMaxSalary(workers[startIndex:endIndex], position, avgAge)
-		}(i)
+			maxSalaryResults[i] = findMaxSalary(workers[r[0]:r[1]], position, avgAge)
+		}(i, r)
 	}
 
 	// Ждем завершения всех горутин.
@@ -235,6 +317,9 @@ func processWithConcurrency(workers []Worker, position string) {
 
 // Основная функция программы.
 func main() {
+	positionQuery := flag.String("position", "Д", "должность для анализа: код, название или псевдоним")
+	flag.Parse()
+
 	// Создаем массив работников.
 	workers := []Worker{
 		{"Иванов Иван", "Д", 30, 50000},
@@ -244,8 +329,16 @@ func main() {
 		{"Морозов Алексей", "С", 42, 75000},
 	}
 
-	// Указываем должность для анализа.
-	position := "Д"
+	// Должность для анализа задается кодом, названием или псевдонимом.
+	info, err := resolvePosition(*positionQuery)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	position := info.Code
+
+	// Выводим параметры окружения.
+	printEnvironment(len(workers), position)
 
 	// Обработка данных без многозадачности.
 	processWithoutConcurrency(workers, position)
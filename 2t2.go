@@ -1,32 +1,142 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/tabwriter"
 	"time"
-	"math/rand"
+	"unsafe"
 )
 
 // Структура Worker представляет информацию о работнике.
 type Worker struct {
 	Name      string
 	Position  string
-	Age       int
+	Age       int       // Возраст на дату запроса, вычисляется из BirthDate функцией setAges.
+	BirthDate time.Time // Дата рождения.
+	HireDate  time.Time // Дата приема на работу (нулевая, если неизвестна).
 	Salary    float64
 }
 
-// Функция calculateAverageAge вычисляет средний возраст работников для указанной должности (position).
-func calculateAverageAge(workers []Worker, position string) float64 {
-	var totalAge, count int
+// Структура PositionInfo описывает должность в справочнике: код, используемый в данных,
+// полное название и дополнительные варианты написания, принимаемые в запросах.
+type PositionInfo struct {
+	Code    string
+	Name    string
+	Aliases []string
+}
 
-	// Проходим по каждому работнику в списке.
+// Справочник должностей.
+var positionCatalog = []PositionInfo{
+	{Code: "Д", Name: "Дизайнер", Aliases: []string{"designer"}},
+	{Code: "С", Name: "Системный администратор", Aliases: []string{"сисадмин", "sysadmin"}},
+}
+
+// Функция resolvePosition находит должность по коду, полному названию или псевдониму
+// без учета регистра.
+func resolvePosition(query string) (PositionInfo, error) {
+	query = strings.TrimSpace(query)
+	for _, info := range positionCatalog {
+		if strings.EqualFold(query, info.Code) || strings.EqualFold(query, info.Name) {
+			return info, nil
+		}
+		for _, alias := range info.Aliases {
+			if strings.EqualFold(query, alias) {
+				return info, nil
+			}
+		}
+	}
+	return PositionInfo{}, fmt.Errorf("неизвестная должность %q", query)
+}
+
+// Функция positionName возвращает читаемое название должности вместе с кодом,
+// например "Дизайнер (Д)". Для кода, которого нет в справочнике, возвращается сам код.
+func positionName(code string) string {
+	for _, info := range positionCatalog {
+		if info.Code == code {
+			return fmt.Sprintf("%s (%s)", info.Name, info.Code)
+		}
+	}
+	return code
+}
+
+// Формат даты рождения в наборах данных и даты запроса во флаге -as-of.
+const dateLayout = "2006-01-02"
+
+// Функция today возвращает текущую дату в UTC без времени — дату запроса по умолчанию.
+func today() time.Time {
+	y, m, d := time.Now().UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Функция parseAsOf разбирает дату запроса из флага -as-of. Пустая строка означает сегодня.
+func parseAsOf(s string) (time.Time, error) {
+	if s == "" {
+		return today(), nil
+	}
+	asOf, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("дата запроса %q: ожидается формат ГГГГ-ММ-ДД", s)
+	}
+	return asOf, nil
+}
+
+// Функция ageAt возвращает число полных лет на дату asOf для родившегося в birth:
+// если день рождения в году asOf еще не наступил, последний год не засчитывается.
+func ageAt(birth, asOf time.Time) int {
+	age := asOf.Year() - birth.Year()
+	if asOf.Month() < birth.Month() || (asOf.Month() == birth.Month() && asOf.Day() < birth.Day()) {
+		age--
+	}
+	return age
+}
+
+// Функция setAges вычисляет возраст работников на дату asOf и отбрасывает тех, кто к этой
+// дате еще не родился; возвращает оставшихся и количество отброшенных. Агрегаты читают
+// готовое поле Age, поэтому возраст вычисляется один раз после загрузки данных.
+func setAges(workers []Worker, asOf time.Time) ([]Worker, int) {
+	ParallelFor(context.Background(), len(workers), 64*1024, runtime.GOMAXPROCS(0), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			workers[i].Age = ageAt(workers[i].BirthDate, asOf)
+		}
+	})
+	born := workers[:0]
 	for _, worker := range workers {
-		// Если должность работника совпадает с искомой, учитываем его возраст.
-		if worker.Position == position {
-			totalAge += worker.Age // Суммируем возраст.
-			count++                // Увеличиваем счетчик работников.
+		if !worker.BirthDate.After(asOf) {
+			born = append(born, worker)
 		}
 	}
+	return born, len(workers) - len(born)
+}
+
+// Функция calculateAverageAge вычисляет средний возраст работников для указанной должности (position).
+func calculateAverageAge(workers []Worker, position string) float64 {
+	// Суммируем возраст и считаем работников с указанной должностью.
+	totalAge, count := sumAges(workers, position)
 
 	// Если работников с указанной должностью не найдено, возвращаем 0.
 	if count == 0 {
@@ -37,23 +147,116 @@ func calculateAverageAge(workers []Worker, position string) float64 {
 	return float64(totalAge) / float64(count)
 }
 
-// Функция findMaxSalary находит максимальную зарплату среди работников
-func findMaxSalary(workers []Worker, position string, avgAge float64) float64 {
-	var maxSalary float64
+// Функция sumAges возвращает сумму возрастов и количество работников указанной должности.
+// Используется для объединения результатов частей: средние частей нельзя просто усреднять,
+// так как в частях разное количество подходящих работников.
+func sumAges(workers []Worker, position string) (int64, int64) {
+	var totalAge, count int64
 
 	// Проходим по каждому работнику в списке.
 	for _, worker := range workers {
-		// Если должность работника совпадает с искомой и его возраст близок к среднему,
-		// проверяем его зарплату.
-		if worker.Position == position && abs(float64(worker.Age)-avgAge) <= 2 {
-			// Если зарплата текущего работника больше максимальной, обновляем максимальную зарплату.
-			if worker.Salary > maxSalary {
-				maxSalary = worker.Salary
-			}
+		// Если должность работника совпадает с искомой, учитываем его возраст.
+		if worker.Position == position {
+			totalAge = addInt64(totalAge, int64(worker.Age)) // Суммируем возраст.
+			count++                                          // Увеличиваем счетчик работников.
+		}
+	}
+	return totalAge, count
+}
+
+// Функция addInt64 складывает два числа и аварийно завершает программу при переполнении.
+// Суммы возрастов накапливаются в int64, чтобы не зависеть от разрядности int, а явная
+// проверка не дает переполнению на очень больших наборах данных незаметно исказить среднее.
+func addInt64(a, b int64) int64 {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		panic(fmt.Sprintf("переполнение int64 при сложении %d и %d", a, b))
+	}
+	return sum
+}
+
+// Функция ArgMax находит среди работников, удовлетворяющих filter, работника
+// с наибольшим значением key. Возвращает работника, значение ключа и признак того,
+// что подходящий работник найден. Если наибольшее значение у нескольких работников,
+// выбирается первый из них в порядке следования.
+func ArgMax(workers []Worker, filter func(Worker) bool, key func(Worker) float64) (Worker, float64, bool) {
+	index, value := argMaxIndex(workers, filter, key)
+	if index < 0 {
+		return Worker{}, 0, false
+	}
+	return workers[index], value, true
+}
+
+// Функция argMaxIndex возвращает индекс первого работника с наибольшим значением key
+// среди удовлетворяющих filter и само значение. Если подходящих работников нет, возвращает -1.
+func argMaxIndex(workers []Worker, filter func(Worker) bool, key func(Worker) float64) (int, float64) {
+	best := -1
+	var bestValue float64
+
+	for i, worker := range workers {
+		if !filter(worker) {
+			continue
+		}
+		// Строгое сравнение оставляет первого из работников с равными значениями.
+		if value := key(worker); best < 0 || value > bestValue {
+			best, bestValue = i, value
+		}
+	}
+	return best, bestValue
+}
+
+// Функция parallelArgMax выполняет ArgMax в numGoroutines горутинах и объединяет
+// результаты частей. Правило выбора при равенстве то же, что у ArgMax: побеждает работник
+// с наименьшим индексом во всем срезе, поэтому результат не зависит от числа частей
+// и порядка завершения горутин.
+func parallelArgMax(workers []Worker, filter func(Worker) bool, key func(Worker) float64, numGoroutines int) (Worker, float64, bool) {
+	ranges := partition(len(workers), numGoroutines)
+
+	// Результаты частей: индекс в исходном срезе (-1, если ничего не найдено) и значение ключа.
+	type candidate struct {
+		index int
+		value float64
+	}
+	candidates := make([]candidate, len(ranges))
+
+	RunScope(context.Background(), func(s *Scope) {
+		for i, r := range ranges {
+			s.Go(func(context.Context) error {
+				index, value := argMaxIndex(workers[r[0]:r[1]], filter, key)
+				if index >= 0 {
+					index += r[0]
+				}
+				candidates[i] = candidate{index, value}
+				return nil
+			})
+		}
+	})
+
+	// Объединяем результаты частей: большее значение, а при равенстве — меньший индекс.
+	best := candidate{index: -1}
+	for _, c := range candidates {
+		if c.index < 0 {
+			continue
+		}
+		if best.index < 0 || c.value > best.value || (c.value == best.value && c.index < best.index) {
+			best = c
 		}
 	}
+	if best.index < 0 {
+		return Worker{}, 0, false
+	}
+	return workers[best.index], best.value, true
+}
 
-	// Возвращаем максимальную зарплату.
+// Функция findMaxSalary находит максимальную зарплату среди работников указанной должности,
+// возраст которых отличается от среднего не больше чем на 2 года.
+// Если таких работников нет, возвращает 0.
+func findMaxSalary(workers []Worker, position string, avgAge float64) float64 {
+	_, maxSalary, _ := ArgMax(workers,
+		func(worker Worker) bool {
+			return worker.Position == position && abs(float64(worker.Age)-avgAge) <= 2
+		},
+		func(worker Worker) float64 { return worker.Salary })
 	return maxSalary
 }
 
@@ -66,66 +269,253 @@ func abs(x float64) float64 {
 	return x
 }
 
-// Функция processWithoutConcurrency обрабатывает данные без использования многозадачности.
-func processWithoutConcurrency(workers []Worker, position string) {
-	// Засекаем время начала выполнения.
-	start := time.Now()
+// Функция cpuModel возвращает модель процессора из /proc/cpuinfo.
+// Если модель определить не удалось, возвращается архитектура.
+func cpuModel() string {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return runtime.GOARCH
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "model name") {
+			if i := strings.Index(line, ":"); i >= 0 {
+				return strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return runtime.GOARCH
+}
+
+// Функция printEnvironment выводит параметры окружения и набора данных,
+// чтобы результаты, полученные на разных машинах, можно было сравнивать.
+func printEnvironment(numWorkers int, position string, seed int64, asOf time.Time) {
+	fmt.Printf("Окружение:\n")
+	fmt.Printf("Версия Go: %s\n", runtime.Version())
+	fmt.Printf("ОС: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Процессор: %s\n", cpuModel())
+	fmt.Printf("GOMAXPROCS: %d\n", runtime.GOMAXPROCS(0))
+	fmt.Printf("Количество работников: %d\n", numWorkers)
+	fmt.Printf("Зерно генератора: %d\n", seed)
+	fmt.Printf("Дата запроса: %s\n", asOf.Format(dateLayout))
+	fmt.Printf("Должность: %s\n\n", positionName(position))
+}
+
+// Функция partition делит n элементов на не более чем parts непустых частей.
+// Остаток от деления распределяется по одному элементу на первые части,
+// поэтому размеры частей отличаются не больше чем на единицу.
+// Каждая часть задается полуинтервалом индексов [начало, конец).
+func partition(n, parts int) [][2]int {
+	// Частей не может быть больше, чем элементов, иначе появятся пустые части.
+	if parts > n {
+		parts = n
+	}
+	if parts <= 0 {
+		return nil
+	}
+
+	size, remainder := n/parts, n%parts
+	ranges := make([][2]int, 0, parts)
+	start := 0
+	for i := 0; i < parts; i++ {
+		end := start + size
+		if i < remainder {
+			end++
+		}
+		ranges = append(ranges, [2]int{start, end})
+		start = end
+	}
+	return ranges
+}
+
+// Интерфейс Partitioner описывает стратегию разбиения данных на части для обработки горутинами.
+// Реализации не возвращают пустых частей.
+type Partitioner interface {
+	// Метод Name возвращает название стратегии для вывода результатов.
+	Name() string
+	// Метод Partition делит работников не более чем на parts частей.
+	Partition(workers []Worker, parts int) [][]Worker
+}
+
+// Структура blockPartitioner делит данные на непрерывные блоки почти равного размера.
+// Части являются подсрезами исходного среза, копирования не происходит.
+type blockPartitioner struct{}
+
+func (blockPartitioner) Name() string { return "блоками" }
+
+func (blockPartitioner) Partition(workers []Worker, parts int) [][]Worker {
+	ranges := partition(len(workers), parts)
+	chunks := make([][]Worker, len(ranges))
+	for i, r := range ranges {
+		chunks[i] = workers[r[0]:r[1]]
+	}
+	return chunks
+}
+
+// Структура interleavedPartitioner раскладывает работников по частям по кругу:
+// работник i попадает в часть i % parts. Если подходящие работники сгруппированы
+// в одном конце среза (например, входные данные отсортированы), нагрузка все равно
+// распределяется по частям равномерно.
+type interleavedPartitioner struct{}
+
+func (interleavedPartitioner) Name() string { return "с чередованием" }
+
+func (interleavedPartitioner) Partition(workers []Worker, parts int) [][]Worker {
+	if parts > len(workers) {
+		parts = len(workers)
+	}
+	if parts <= 0 {
+		return nil
+	}
+	chunks := make([][]Worker, parts)
+	for i := range chunks {
+		chunks[i] = make([]Worker, 0, len(workers)/parts+1)
+	}
+	for i, worker := range workers {
+		chunks[i%parts] = append(chunks[i%parts], worker)
+	}
+	return chunks
+}
+
+// Структура rangePartitioner делит работников по диапазонам значения ключа Key:
+// отрезок [минимум, максимум] делится на parts равных диапазонов, и каждая часть
+// содержит работников со значением ключа из своего диапазона. Пустые диапазоны отбрасываются.
+type rangePartitioner struct {
+	KeyName string
+	Key     func(Worker) float64
+}
+
+func (p rangePartitioner) Name() string { return "по диапазонам " + p.KeyName }
+
+func (p rangePartitioner) Partition(workers []Worker, parts int) [][]Worker {
+	if len(workers) == 0 || parts <= 0 {
+		return nil
+	}
+
+	// Находим границы значений ключа.
+	minKey, maxKey := p.Key(workers[0]), p.Key(workers[0])
+	for _, worker := range workers {
+		key := p.Key(worker)
+		if key < minKey {
+			minKey = key
+		}
+		if key > maxKey {
+			maxKey = key
+		}
+	}
+
+	// Раскладываем работников по диапазонам.
+	width := (maxKey - minKey) / float64(parts)
+	buckets := make([][]Worker, parts)
+	for _, worker := range workers {
+		i := parts - 1
+		if width > 0 {
+			i = int((p.Key(worker) - minKey) / width)
+		}
+		// Максимальное значение ключа относится к последнему диапазону.
+		if i >= parts {
+			i = parts - 1
+		}
+		buckets[i] = append(buckets[i], worker)
+	}
+
+	// Отбрасываем пустые диапазоны.
+	chunks := buckets[:0]
+	for _, bucket := range buckets {
+		if len(bucket) > 0 {
+			chunks = append(chunks, bucket)
+		}
+	}
+	return chunks
+}
+
+// Структура positionPartitioner делит работников по хешу должности (positionPartition):
+// все работники одной должности попадают в одну часть, поэтому каждая горутина полностью
+// владеет своими должностями, и при группировке по должности результаты частей не нужно
+// сливать. Частей не больше, чем различных должностей; пустые части отбрасываются.
+type positionPartitioner struct{}
+
+func (positionPartitioner) Name() string { return "по хешу должности" }
+
+func (positionPartitioner) Partition(workers []Worker, parts int) [][]Worker {
+	if len(workers) == 0 || parts <= 0 {
+		return nil
+	}
+	buckets := make([][]Worker, parts)
+	for _, worker := range workers {
+		i := positionPartition(worker.Position, parts)
+		buckets[i] = append(buckets[i], worker)
+	}
+
+	// Отбрасываем пустые части.
+	chunks := buckets[:0]
+	for _, bucket := range buckets {
+		if len(bucket) > 0 {
+			chunks = append(chunks, bucket)
+		}
+	}
+	return chunks
+}
+
+// Функция analyzeSequential вычисляет средний возраст и максимальную зарплату
+// без использования многозадачности.
+func analyzeSequential(workers []Worker, position string) (float64, float64) {
+	// Данные делятся на 3 части, которые по очереди обрабатывает вызывающая горутина:
+	// ParallelFor с одной горутиной не создает пул, поэтому в замер не попадают накладные
+	// расходы на горутины и каналы.
+	countSize := 3
+	return analyzeChunked(workers, position, 1, (len(workers)+countSize-1)/countSize)
+}
+
+// Функция analyzeParallel вычисляет средний возраст и максимальную зарплату в numGoroutines
+// горутинах. Данные делятся на части для горутин стратегией partitioner. Непрерывные части
+// разбиения блоками обрабатывает ParallelFor (analyzeChunked); части остальных стратегий
+// ставятся в пул задачами Submit, а результаты частей собирает WhenAll.
+func analyzeParallel(workers []Worker, position string, partitioner Partitioner, numGoroutines int) (float64, float64) {
+	if _, ok := partitioner.(blockPartitioner); ok && numGoroutines > 0 {
+		return analyzeChunked(workers, position, numGoroutines, (len(workers)+numGoroutines-1)/numGoroutines)
+	}
 
+	ctx := context.Background()
 	var avgAge float64
 	var maxSalary float64
 
-	// Количество частей, на которые разбиваем данные.
-	countSize := 3
-	// Размер каждой части.
-	subsetsSize := len(workers) / countSize
+	// Делим данные на части выбранной стратегией: если работников меньше, чем горутин,
+	// горутин запускается меньше. Каждой части — своя горутина пула.
+	chunks := partitioner.Partition(workers, numGoroutines)
+	pool := NewPool(len(chunks))
+	defer pool.Close()
 
-	// Срезы для хранения промежуточных результатов.
-	avgAgeResults := make([]float64, countSize)
-	maxSalaryResults := make([]float64, countSize)
-
-	// Поиск среднего возраста в каждой части данных.
-	for i := 0; i < countSize; i++ {
-		func(i int) {
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * subsetsSize
-			endIndex := (i + 1) * subsetsSize
-			// Для последней части корректируем конечный индекс, чтобы не выйти за пределы списка.
-			if i == countSize-1 {
-				endIndex = len(workers)
-			}
-			// Вычисляем средний возраст для текущей части.
-			avgAgeResults[i] = calculateAverageAge(workers[startIndex:endIndex], position)
-		}(i)
-	}
-
-	// Объединяем результаты среднего возраста.
-	var totalAge float64
-	var count int
-	for _, avg := range avgAgeResults {
-		if avg > 0 {
-			totalAge += avg
-			count++
-		}
+	// Суммируем возраст в каждой части.
+	type ageSum struct{ total, count int64 }
+	ageFutures := make([]*Future[ageSum], len(chunks))
+	for i, chunk := range chunks {
+		ageFutures[i] = Submit(ctx, pool, func(context.Context) (ageSum, error) {
+			total, count := sumAges(chunk, position)
+			return ageSum{total, count}, nil
+		})
+	}
+	// Задачи не возвращают ошибок, а контекст не отменяется, поэтому ошибки нет.
+	ageSums, _ := WhenAll(ageFutures...).Wait(ctx)
+
+	// Объединяем результаты: каждая часть учитывается с весом по числу найденных работников.
+	var totalAge, count int64
+	for _, sum := range ageSums {
+		totalAge = addInt64(totalAge, sum.total)
+		count = addInt64(count, sum.count)
 	}
 	// Вычисляем общий средний возраст.
 	if count > 0 {
-		avgAge = totalAge / float64(count)
+		avgAge = float64(totalAge) / float64(count)
 	}
 
-	// Поиск максимальной зарплаты в каждой части данных.
-	for i := 0; i < countSize; i++ {
-		func(i int) {
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * subsetsSize
-			endIndex := (i + 1) * subsetsSize
-			// Для последней части корректируем конечный индекс.
-			if i == countSize-1 {
-				endIndex = len(workers)
-			}
-			// Находим максимальную зарплату для текущей части.
-			maxSalaryResults[i] = findMaxSalary(workers[startIndex:endIndex], position, avgAge)
-		}(i)
+	// Ищем максимальную зарплату в каждой части.
+	salaryFutures := make([]*Future[float64], len(chunks))
+	for i, chunk := range chunks {
+		salaryFutures[i] = Submit(ctx, pool, func(context.Context) (float64, error) {
+			return findMaxSalary(chunk, position, avgAge), nil
+		})
 	}
+	maxSalaryResults, _ := WhenAll(salaryFutures...).Wait(ctx)
 
 	// Объединяем результаты максимальной зарплаты.
 	for _, max := range maxSalaryResults {
@@ -134,147 +524,4534 @@ func processWithoutConcurrency(workers []Worker, position string) {
 		}
 	}
 
-	// Вычисляем время выполнения.
-	duration := time.Since(start)
-
-	// Выводим результаты.
-	fmt.Printf("Без многозадачности:\n")
-	fmt.Printf("Средний возраст: %.2f\n", avgAge)
-	fmt.Printf("Максимальная зарплата: %.2f\n", maxSalary)
-	fmt.Printf("Время обработки: %v\n\n", duration)
+	return avgAge, maxSalary
 }
 
-// Функция processWithConcurrency обрабатывает данные с использованием многозадачности (горутин).
-func processWithConcurrency(workers []Worker, position string) {
-	// Засекаем время начала выполнения.
-	start := time.Now()
+// Функция analyzeChunked вычисляет средний возраст и максимальную зарплату, разбивая данные
+// на части по chunkSize работников, которые обрабатывает пул из numGoroutines горутин.
+// В отличие от analyzeParallel, число частей не привязано к числу горутин.
+func analyzeChunked(workers []Worker, position string, numGoroutines, chunkSize int) (float64, float64) {
+	ctx := context.Background()
+	n := tiles(len(workers), chunkSize)
+	grain := max(chunkSize, 1)
 
-	// Используем WaitGroup для синхронизации горутин.
-	var wg sync.WaitGroup
+	// Суммируем возраст по частям.
+	ageTotals := make([]int64, n)
+	ageCounts := make([]int64, n)
+	ParallelFor(ctx, len(workers), grain, numGoroutines, func(lo, hi int) {
+		ageTotals[lo/grain], ageCounts[lo/grain] = sumAges(workers[lo:hi], position)
+	})
+
+	// Объединяем результаты: каждая часть учитывается с весом по числу найденных работников.
 	var avgAge float64
-	var maxSalary float64
+	var totalAge, count int64
+	for i := range ageTotals {
+		totalAge = addInt64(totalAge, ageTotals[i])
+		count = addInt64(count, ageCounts[i])
+	}
+	if count > 0 {
+		avgAge = float64(totalAge) / float64(count)
+	}
 
-	// Количество горутин.
-	numGoroutines := 3
-	// Размер каждой части данных.
-	chunkSize := len(workers) / numGoroutines
+	// Ищем максимальную зарплату по частям.
+	maxSalaryResults := make([]float64, n)
+	ParallelFor(ctx, len(workers), grain, numGoroutines, func(lo, hi int) {
+		maxSalaryResults[lo/grain] = findMaxSalary(workers[lo:hi], position, avgAge)
+	})
 
-	// Срезы для хранения промежуточных результатов.
-	avgAgeResults := make([]float64, numGoroutines)
-	maxSalaryResults := make([]float64, numGoroutines)
-
-	// Запускаем горутины для вычисления среднего возраста.
-	wg.Add(numGoroutines)
-	for i := 0; i < numGoroutines; i++ {
-		go func(i int) {
-			defer wg.Done() // Уменьшаем счетчик WaitGroup при завершении горутины.
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * chunkSize
-			endIndex := (i + 1) * chunkSize
-			// Для последней части корректируем конечный индекс.
-			if i == numGoroutines-1 {
-				endIndex = len(workers)
-			}
-			// Вычисляем средний возраст для текущей части.
-			avgAgeResults[i] = calculateAverageAge(workers[startIndex:endIndex], position)
-		}(i)
-	}
-
-	// Ждем завершения всех горутин.
-	wg.Wait()
-
-	// Объединяем результаты среднего возраста.
-	var totalAge float64
-	var count int
-	for _, avg := range avgAgeResults {
-		if avg > 0 {
-			totalAge += avg
-			count++
+	var maxSalary float64
+	for _, max := range maxSalaryResults {
+		if max > maxSalary {
+			maxSalary = max
 		}
 	}
-	// Вычисляем общий средний возраст.
-	if count > 0 {
-		avgAge = totalAge / float64(count)
+	return avgAge, maxSalary
+}
+
+// Функция bestOf выполняет f runs раз и возвращает наименьшее время: единичный замер
+// слишком сильно зависит от случайных задержек планировщика.
+func bestOf(runs int, f func()) time.Duration {
+	best := time.Duration(math.MaxInt64)
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		f()
+		best = min(best, time.Since(start))
+	}
+	return best
+}
+
+// Функция runInteractive запускает интерактивный подбор параметров: пользователь меняет
+// количество горутин и размер части командами из in, и после каждой команды анализ
+// выполняется заново с выводом времени и ускорения относительно последовательного варианта.
+func runInteractive(workers []Worker, position string, in io.Reader) {
+	goroutines := runtime.GOMAXPROCS(0)
+	chunkSize := max(1, (len(workers)+goroutines-1)/goroutines)
+	sequential := bestOf(3, func() { analyzeSequential(workers, position) })
+
+	fmt.Printf("Интерактивный подбор параметров, %d работников. Последовательно: %v\n", len(workers), sequential)
+	fmt.Println("Команды: g N — горутин, c N — размер части, + и - — вдвое больше или меньше горутин,")
+	fmt.Println("пустая строка — повторить замер, q — выход.")
+
+	// Функция measure выполняет анализ с текущими параметрами и выводит результат.
+	measure := func() {
+		var avgAge, maxSalary float64
+		elapsed := bestOf(3, func() { avgAge, maxSalary = analyzeChunked(workers, position, goroutines, chunkSize) })
+		parts := (len(workers) + chunkSize - 1) / chunkSize
+		fmt.Printf("Горутин %d, частей %d по %d: средний возраст %.2f, макс. зарплата %.2f, время %v, ускорение ×%.2f\n",
+			goroutines, parts, chunkSize, avgAge, maxSalary, elapsed, sequential.Seconds()/elapsed.Seconds())
 	}
 
-	// Запускаем горутины для поиска максимальной зарплаты.
-	wg.Add(numGoroutines)
-	for i := 0; i < numGoroutines; i++ {
-		go func(i int) {
-			defer wg.Done() // Уменьшаем счетчик WaitGroup при завершении горутины.
-			// Определяем начальный и конечный индексы для текущей части.
-			startIndex := i * chunkSize
-			endIndex := (i + 1) * chunkSize
-			// Для последней части корректируем конечный индекс.
-			if i == numGoroutines-1 {
-				endIndex = len(workers)
+	measure()
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			measure()
+			continue
+		}
+		switch fields[0] {
+		case "q":
+			return
+		case "+":
+			goroutines *= 2
+		case "-":
+			goroutines = max(1, goroutines/2)
+		case "g", "c":
+			var n int
+			if len(fields) == 2 {
+				n, _ = strconv.Atoi(fields[1])
+			}
+			if n <= 0 {
+				fmt.Println("Ожидается положительное число, например: g 8")
+				continue
+			}
+			if fields[0] == "g" {
+				goroutines = n
+			} else {
+				chunkSize = n
 			}
-			// Находим максимальную зарплату для текущей части.
-			maxSalaryResults[i] = findMaxSalary(workers[startIndex:endIndex], position, avgAge)
-		}(i)
+		default:
+			fmt.Printf("Неизвестная команда %q\n", fields[0])
+			continue
+		}
+		measure()
 	}
+}
 
-	// Ждем завершения всех горутин.
-	wg.Wait()
+// Структура soakSample представляет замер памяти и горутин в режиме длительного прогона.
+type soakSample struct {
+	Elapsed    time.Duration
+	Iterations int
+	HeapAlloc  uint64 // Живая куча после принудительной сборки мусора.
+	Goroutines int
+}
 
-	// Объединяем результаты максимальной зарплаты.
-	for _, max := range maxSalaryResults {
-		if max > maxSalary {
-			maxSalary = max
+// Функция soakIteration выполняет одну итерацию длительного прогона: анализ через пул,
+// задачи с Future и пакетный проход агрегатов — весь код, где утечка горутин или памяти
+// накапливалась бы от итерации к итерации.
+func soakIteration(workers []Worker, position string) {
+	numGoroutines := runtime.GOMAXPROCS(0)
+	analyzeChunked(workers, position, numGoroutines, generateShardSize)
+
+	ctx := context.Background()
+	pool := NewPoolWithPolicy(numGoroutines, QueueCallerRuns)
+	chunks := blockPartitioner{}.Partition(workers, numGoroutines)
+	tasks := make([]func(ctx context.Context) (int64, error), len(chunks))
+	for i, chunk := range chunks {
+		tasks[i] = func(context.Context) (int64, error) {
+			total, _ := sumAges(chunk, position)
+			return total, nil
 		}
 	}
+	futures := SubmitBatch(ctx, pool, tasks)
+	pool.Close()
+	for _, f := range futures {
+		f.Wait(ctx)
+	}
 
-	// Вычисляем время выполнения.
-	duration := time.Since(start)
+	runBatch(workers, []Aggregator{
+		&avgAgeAggregator{position: position},
+		&topSalaryAggregator{position: position, n: 3},
+		&salaryQuantilesAggregator{position: position, alpha: 0.01},
+	}, numGoroutines)
+}
 
-	// Выводим результаты.
-	fmt.Printf("С многозадачностью (с несколькими горутинами):\n")
-	fmt.Printf("Средний возраст: %.2f\n", avgAge)
-	fmt.Printf("Максимальная зарплата: %.2f\n", maxSalary)
-	fmt.Printf("Время обработки: %v\n\n", duration)
+// Функция monotonicGrowth сообщает, что значения ни разу не уменьшались и выросли
+// больше чем в 1+minGrowth раза. Для вывода нужно не меньше пяти замеров: по короткому
+// ряду рост нельзя отличить от прогрева.
+func monotonicGrowth(values []float64, minGrowth float64) bool {
+	if len(values) < 5 {
+		return false
+	}
+	for i := 1; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			return false
+		}
+	}
+	first, last := values[0], values[len(values)-1]
+	return last > first && last >= first*(1+minGrowth)
 }
 
-// Функция generateWorker генерирует случайного работника.
-func generateWorker(index int) Worker {
-	// Генерируем имя по шаблону.
-	name := fmt.Sprintf("Работник %d", index)
-	// Случайным образом выбираем должность: "Д" или "С".
-	position := "Д"
-	if rand.Intn(2) == 0 {
-		position = "С"
+// Функция runSoak повторяет soakIteration в течение duration и каждые interval снимает
+// размер живой кучи и количество горутин. Первый замер делается после первой итерации,
+// чтобы не принимать прогрев за утечку. Возвращает false, если куча или число горутин
+// монотонно росли: такую утечку короткие запуски не показывают.
+func runSoak(workers []Worker, position string, duration, interval time.Duration) bool {
+	fmt.Printf("Длительный прогон: %v, замер каждые %v\n", duration, interval)
+	start := time.Now()
+	var samples []soakSample
+	iterations := 0
+	nextSample := start
+	for time.Since(start) < duration {
+		soakIteration(workers, position)
+		iterations++
+		if time.Now().Before(nextSample) {
+			continue
+		}
+		nextSample = time.Now().Add(interval)
+
+		runtime.GC()
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		sample := soakSample{
+			Elapsed:    time.Since(start).Round(time.Second),
+			Iterations: iterations,
+			HeapAlloc:  mem.HeapAlloc,
+			Goroutines: runtime.NumGoroutine(),
+		}
+		samples = append(samples, sample)
+		fmt.Printf("%v: итераций %d, куча %.1f МиБ, горутин %d\n",
+			sample.Elapsed, sample.Iterations, float64(sample.HeapAlloc)/(1<<20), sample.Goroutines)
 	}
-	// Генерируем случайный возраст от 20 до 60 лет.
-	age := rand.Intn(41) + 20
-	// Генерируем случайную зарплату от 30 000 до 100 000.
-	salary := float64(rand.Intn(70000) + 30000
 
-	// Возвращаем структуру Worker с заполненными полями.
-	return Worker{
-		Name:     name,
-		Position: position,
-		Age:      age,
-		Salary:   salary,
+	heap := make([]float64, len(samples))
+	goroutines := make([]float64, len(samples))
+	for i, s := range samples {
+		heap[i], goroutines[i] = float64(s.HeapAlloc), float64(s.Goroutines)
 	}
+	ok := true
+	if monotonicGrowth(heap, 0.1) {
+		fmt.Println("Подозрение на утечку памяти: живая куча росла на каждом замере")
+		ok = false
+	}
+	if monotonicGrowth(goroutines, 0) {
+		fmt.Println("Подозрение на утечку горутин: их количество росло на каждом замере")
+		ok = false
+	}
+	if ok {
+		fmt.Printf("Утечек не обнаружено (замеров: %d, итераций: %d)\n", len(samples), iterations)
+	}
+	return ok
 }
 
-// Основная функция программы.
-func main() {
-	// Инициализируем генератор случайных чисел.
-	rand.Seed(time.Now().UnixNano())
+// Функция sameStats сравнивает показатели по должностям. Суммы зарплат в частях
+// складываются в разном порядке, поэтому сравниваются с относительной погрешностью.
+func sameStats(a, b map[string]*positionStats) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for position, x := range a {
+		y, ok := b[position]
+		if !ok || x.Count != y.Count || x.AgeSum != y.AgeSum || x.SalaryMin != y.SalaryMin || x.SalaryMax != y.SalaryMax {
+			return false
+		}
+		if math.Abs(x.Salary.Value()-y.Salary.Value()) > 1e-9*math.Abs(y.Salary.Value()) || x.medianAge() != y.medianAge() {
+			return false
+		}
+	}
+	return true
+}
 
-	// Создаем массив работников размером 100 000.
-	var workers []Worker
-	for i := 0; i < 100000; i++ {
-		// Генерируем работника и добавляем его в массив.
-		workers = append(workers, generateWorker(i))
+// Функция checkSubmitBatch проверяет, что SubmitBatch возвращает результат каждой задачи
+// в ее Future в порядке постановки. При политике QueueReject задача может быть отклонена.
+func checkSubmitBatch(size int, full QueueFullPolicy) bool {
+	p := NewPoolWithPolicy(size, full)
+	defer p.Close()
+
+	fns := make([]func(ctx context.Context) (int, error), 64)
+	for i := range fns {
+		fns[i] = func(context.Context) (int, error) {
+			chaosPoint()
+			return i, nil
+		}
+	}
+	for i, f := range SubmitBatch(context.Background(), p, fns) {
+		value, err := f.Wait(context.Background())
+		if full == QueueReject && errors.Is(err, ErrQueueFull) {
+			continue
+		}
+		if err != nil || value != i {
+			return false
+		}
 	}
+	return true
+}
 
-	// Указываем должность для анализа.
-	position := "Д"
+// Функция runChaosTest повторяет проверки инвариантов параллельного кода runs раз
+// с внедренными задержками и возвращает false, если хотя бы одна проверка не прошла.
+// Результаты не должны зависеть от порядка горутин: параллельный анализ и группировка
+// совпадают с последовательными, пакетные агрегаты — с вычисленными одной горутиной,
+// а Future из SubmitBatch получают результаты своих задач. Число горутин меняется
+// от прогона к прогону.
+func runChaosTest(workers []Worker, position string, runs int) bool {
+	// Для проверок порядка достаточно части данных, зато прогонов можно сделать больше.
+	workers = workers[:min(len(workers), 20000)]
+	partitioners := []Partitioner{
+		blockPartitioner{},
+		interleavedPartitioner{},
+		rangePartitioner{KeyName: "возраста", Key: func(w Worker) float64 { return float64(w.Age) }},
+		positionPartitioner{},
+	}
+	aggregators := func() []Aggregator {
+		return []Aggregator{
+			&avgAgeAggregator{position: position},
+			&maxSalaryAggregator{position: position},
+			&ageHistogramAggregator{position: position},
+			&topSalaryAggregator{position: position, n: 3},
+			&salaryQuantilesAggregator{position: position, alpha: 0.01},
+		}
+	}
 
-	// Обработка данных без многозадачности.
-	processWithoutConcurrency(workers, position)
+	// Эталонные результаты вычисляются до включения хаоса.
+	prob := chaosProb
+	chaosProb = 0
+	wantAvg, wantMax := analyzeSequential(workers, position)
+	wantStats := collectPositionStats(workers, 1, blockPartitioner{})
+	var want []string
+	for _, agg := range runBatch(workers, aggregators(), 1) {
+		want = append(want, agg.Result())
+	}
+	chaosProb = prob
+
+	fmt.Printf("Хаос-тест: прогонов %d, вероятность задержки %.2f, работников %d\n", runs, chaosProb, len(workers))
+	failures := make(map[string]int)
+	checks := 0
+	check := func(name string, ok bool) {
+		checks++
+		if !ok {
+			failures[name]++
+		}
+	}
+	start := time.Now()
+	for run := 0; run < runs; run++ {
+		numGoroutines := 2 + run%7
+		for _, p := range partitioners {
+			avg, max := analyzeParallel(workers, position, p, numGoroutines)
+			check("analyzeParallel "+p.Name(), avg == wantAvg && max == wantMax)
+			check("collectPositionStats "+p.Name(), sameStats(collectPositionStats(workers, numGoroutines, p), wantStats))
+		}
+		for j, agg := range runBatch(workers, aggregators(), numGoroutines) {
+			check("runBatch "+agg.Name(), agg.Result() == want[j])
+		}
+		check("SubmitBatch "+string(QueueBlock), checkSubmitBatch(numGoroutines, QueueBlock))
+		check("SubmitBatch "+string(QueueReject), checkSubmitBatch(numGoroutines, QueueReject))
+		check("SubmitBatch "+string(QueueCallerRuns), checkSubmitBatch(numGoroutines, QueueCallerRuns))
+	}
+
+	names := make([]string, 0, len(failures))
+	for name := range failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("Нарушение: %s (%d раз)\n", name, failures[name])
+	}
+	fmt.Printf("Проверок: %d, нарушений: %d, время: %v\n", checks, len(names), time.Since(start).Round(time.Millisecond))
+	return len(names) == 0
+}
+
+// Функция processWithoutConcurrency обрабатывает данные без использования многозадачности.
+func processWithoutConcurrency(workers []Worker, position string) {
+	// Засекаем время начала выполнения.
+	start := time.Now()
+
+	avgAge, maxSalary := analyzeSequential(workers, position)
+
+	// Вычисляем время выполнения.
+	duration := time.Since(start)
+
+	// Выводим результаты.
+	fmt.Printf("Без многозадачности:\n")
+	fmt.Printf("Средний возраст: %.2f\n", avgAge)
+	fmt.Printf("Максимальная зарплата: %.2f\n", maxSalary)
+	fmt.Printf("Время обработки: %v\n\n", duration)
+}
+
+// Функция processWithConcurrency обрабатывает данные с использованием многозадачности (горутин).
+// Данные делятся на части для горутин стратегией partitioner.
+func processWithConcurrency(workers []Worker, position string, partitioner Partitioner) {
+	// Засекаем время начала выполнения.
+	start := time.Now()
+
+	// Количество горутин.
+	numGoroutines := 3
+	avgAge, maxSalary := analyzeParallel(workers, position, partitioner, numGoroutines)
+
+	// Вычисляем время выполнения.
+	duration := time.Since(start)
+
+	// Выводим результаты.
+	fmt.Printf("С многозадачностью (с несколькими горутинами, разбиение %s):\n", partitioner.Name())
+	fmt.Printf("Средний возраст: %.2f\n", avgAge)
+	fmt.Printf("Максимальная зарплата: %.2f\n", maxSalary)
+	fmt.Printf("Время обработки: %v\n\n", duration)
+}
+
+// Оценка стоимости обработки одной записи для каждой метрики в условных единицах
+// и порог, начиная с которого параллельное выполнение окупает запуск горутин.
+// Порог подбирается по замерам processWithoutConcurrency и processWithConcurrency
+// на наборах данных разного размера.
+const (
+	costAvgAge        = 1.0
+	costMaxSalary     = 1.5
+	parallelThreshold = 50000
+)
+
+// Структура queryPlan описывает выбранный планировщиком способ выполнения запроса.
+type queryPlan struct {
+	Parallel   bool    // Выполнять ли запрос параллельно.
+	Goroutines int     // Количество горутин.
+	Cost       float64 // Оценка работы: записи × стоимость метрик.
+	Indexed    bool    // Используется ли индекс.
+	Chunks     int     // Частей индекса, которые просматриваются обоими проходами.
+	Skipped    int     // Частей индекса, пропущенных обоими проходами.
+
+	Engine      string // Способ выполнения для вывода в режиме -explain.
+	Partitioner string // Разбиение данных на части.
+	Rows        int    // Записей, которые просмотрит первый проход.
+	Matching    int    // Оценка числа записей нужной должности (-1 — неизвестно до выполнения).
+}
+
+// Функция planQuery оценивает объем работы запроса и выбирает последовательное выполнение
+// для небольших данных и параллельное — для данных, превышающих порог.
+func planQuery(records int) queryPlan {
+	plan := queryPlan{
+		Goroutines:  1,
+		Cost:        float64(records) * (costAvgAge + costMaxSalary),
+		Engine:      "последовательно в вызывающей горутине (analyzeSequential)",
+		Partitioner: "3 непрерывные части",
+		Rows:        records,
+		Matching:    -1,
+	}
+	// Параллельное выполнение имеет смысл, только если доступно больше одного процессора.
+	if plan.Cost >= parallelThreshold && runtime.GOMAXPROCS(0) > 1 {
+		plan.Parallel = true
+		plan.Goroutines = runtime.GOMAXPROCS(0)
+		plan.Engine = "ParallelFor, горутина на каждую часть (analyzeParallel)"
+		plan.Partitioner = blockPartitioner{}.Name()
+	}
+	return plan
+}
+
+// Функция planAnalysis выбирает план запроса, не выполняя его. Если построен индекс ix,
+// работа оценивается только по частям с нужной должностью, а число подходящих записей
+// известно заранее из счетчиков индекса.
+func planAnalysis(workers []Worker, position string, ix *ChunkIndex) queryPlan {
+	if ix == nil {
+		return planQuery(len(workers))
+	}
+	byPosition := ix.Matching(position, math.MinInt, math.MaxInt)
+	records, matching := 0, 0
+	for _, c := range byPosition {
+		records += len(ix.chunk(workers, c))
+		matching += ix.Positions[c][position]
+	}
+	plan := planQuery(records)
+	plan.Indexed = true
+	plan.Engine = "пул горутин по частям индекса (analyzeIndexed)"
+	plan.Partitioner = fmt.Sprintf("части индекса по %d работников", indexChunkSize)
+	plan.Matching = matching
+	// До выполнения известно только число частей первого прохода: части второго
+	// прохода выбираются по среднему возрасту.
+	plan.Chunks, plan.Skipped = len(byPosition), len(ix.Positions)-len(byPosition)
+	return plan
+}
+
+// Функция printPlan выводит план запроса до его выполнения.
+func printPlan(plan queryPlan) {
+	fmt.Printf("План запроса:\n")
+	fmt.Printf("  Способ: %s\n", plan.Engine)
+	fmt.Printf("  Разбиение: %s\n", plan.Partitioner)
+	fmt.Printf("  Горутин: %d\n", plan.Goroutines)
+	// Зарплата ищется среди работников с возрастом около среднего, поэтому агрегаты
+	// нельзя объединить в один проход.
+	fmt.Printf("  Агрегаты: средний возраст, затем максимальная зарплата (отдельными проходами)\n")
+	if plan.Indexed {
+		fmt.Printf("  Индекс: должность и возраст, частей первого прохода %d, пропущено %d\n", plan.Chunks, plan.Skipped)
+	} else {
+		fmt.Printf("  Индекс: не используется\n")
+	}
+	fmt.Printf("  Оценка записей: просмотреть %d", plan.Rows)
+	if plan.Matching >= 0 {
+		fmt.Printf(", нужной должности %d", plan.Matching)
+	}
+	fmt.Printf("\n  Оценка работы: %.0f (порог параллельности %d)\n", plan.Cost, parallelThreshold)
+}
+
+// Функция analyze вычисляет средний возраст и максимальную зарплату, выбирая способ
+// выполнения с помощью planAnalysis. Если построен индекс ix, части без нужной должности
+// пропускаются. Возвращает также выбранный план.
+func analyze(workers []Worker, position string, ix *ChunkIndex) (float64, float64, queryPlan) {
+	plan := planAnalysis(workers, position, ix)
+	if plan.Indexed {
+		avgAge, maxSalary, scanned := analyzeIndexed(workers, position, ix, plan.Goroutines)
+		plan.Chunks, plan.Skipped = scanned, 2*len(ix.Positions)-scanned
+		return avgAge, maxSalary, plan
+	}
+	if plan.Parallel {
+		avgAge, maxSalary := analyzeParallel(workers, position, blockPartitioner{}, plan.Goroutines)
+		return avgAge, maxSalary, plan
+	}
+	avgAge, maxSalary := analyzeSequential(workers, position)
+	return avgAge, maxSalary, plan
+}
+
+// Количество работников в одной части индекса.
+const indexChunkSize = 4096
+
+// Структура ChunkIndex представляет вторичные индексы набора данных по частям из
+// indexChunkSize работников: для каждой части хранятся количества работников каждой должности
+// и диапазон возрастов. Запрос по должности и возрасту пропускает части, в которых
+// подходящих работников заведомо нет. Пропуск окупается, если данные упорядочены или
+// сгруппированы; в перемешанных данных почти каждая часть содержит все должности.
+type ChunkIndex struct {
+	Positions []map[string]int // Количество работников каждой должности в части.
+	MinAge    []int
+	MaxAge    []int
+	BuildTime time.Duration
+	Allocated uint64 // Память, выделенная при построении индекса.
+}
+
+// Функция BuildChunkIndex параллельно строит индексы по частям в numGoroutines горутинах.
+func BuildChunkIndex(workers []Worker, numGoroutines int) *ChunkIndex {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	chunks := (len(workers) + indexChunkSize - 1) / indexChunkSize
+	ix := &ChunkIndex{
+		Positions: make([]map[string]int, chunks),
+		MinAge:    make([]int, chunks),
+		MaxAge:    make([]int, chunks),
+	}
+	pool := NewPool(numGoroutines)
+	for i := 0; i < chunks; i++ {
+		pool.Go(func() {
+			chunk := ix.chunk(workers, i)
+			positions := make(map[string]int)
+			minAge, maxAge := chunk[0].Age, chunk[0].Age
+			for _, worker := range chunk {
+				positions[worker.Position]++
+				minAge, maxAge = min(minAge, worker.Age), max(maxAge, worker.Age)
+			}
+			ix.Positions[i], ix.MinAge[i], ix.MaxAge[i] = positions, minAge, maxAge
+		})
+	}
+	pool.Close()
+
+	ix.BuildTime = time.Since(start)
+	runtime.ReadMemStats(&after)
+	ix.Allocated = after.TotalAlloc - before.TotalAlloc
+	return ix
+}
+
+// Метод chunk возвращает работников части i.
+func (ix *ChunkIndex) chunk(workers []Worker, i int) []Worker {
+	return workers[i*indexChunkSize : min((i+1)*indexChunkSize, len(workers))]
+}
+
+// Метод Matching возвращает номера частей, в которых могут быть работники должности position
+// с возрастом из отрезка [minAge, maxAge].
+func (ix *ChunkIndex) Matching(position string, minAge, maxAge int) []int {
+	var matching []int
+	for i := range ix.Positions {
+		if ix.Positions[i][position] > 0 && ix.MaxAge[i] >= minAge && ix.MinAge[i] <= maxAge {
+			matching = append(matching, i)
+		}
+	}
+	return matching
+}
+
+// Функция analyzeIndexed вычисляет средний возраст и максимальную зарплату, просматривая
+// только части, которые выбирает индекс: для среднего возраста — части с нужной должностью,
+// для зарплаты — части, где к тому же есть возраст, близкий к среднему. Возвращает также
+// количество просмотренных частей на обоих проходах.
+func analyzeIndexed(workers []Worker, position string, ix *ChunkIndex, numGoroutines int) (float64, float64, int) {
+	byPosition := ix.Matching(position, math.MinInt, math.MaxInt)
+	ageTotals := make([]int64, len(byPosition))
+	ageCounts := make([]int64, len(byPosition))
+	pool := NewPool(numGoroutines)
+	for i, c := range byPosition {
+		pool.Go(func() { ageTotals[i], ageCounts[i] = sumAges(ix.chunk(workers, c), position) })
+	}
+	pool.Close()
+
+	var avgAge float64
+	var totalAge, count int64
+	for i := range byPosition {
+		totalAge = addInt64(totalAge, ageTotals[i])
+		count = addInt64(count, ageCounts[i])
+	}
+	if count > 0 {
+		avgAge = float64(totalAge) / float64(count)
+	}
+
+	// findMaxSalary учитывает работников с возрастом не дальше 2 лет от среднего.
+	byAge := ix.Matching(position, int(math.Ceil(avgAge-2)), int(math.Floor(avgAge+2)))
+	maxSalaryResults := make([]float64, len(byAge))
+	pool = NewPool(numGoroutines)
+	for i, c := range byAge {
+		pool.Go(func() { maxSalaryResults[i] = findMaxSalary(ix.chunk(workers, c), position, avgAge) })
+	}
+	pool.Close()
+
+	var maxSalary float64
+	for _, max := range maxSalaryResults {
+		if max > maxSalary {
+			maxSalary = max
+		}
+	}
+	return avgAge, maxSalary, len(byPosition) + len(byAge)
+}
+
+// Функция printIndexReport выводит стоимость построения индексов.
+func printIndexReport(ix *ChunkIndex) {
+	fmt.Printf("Индексы по должности и диапазону возраста:\n")
+	fmt.Printf("Частей: %d по %d работников\n", len(ix.Positions), indexChunkSize)
+	fmt.Printf("Выделено памяти: %.1f КиБ\n", float64(ix.Allocated)/1024)
+	fmt.Printf("Время построения: %v\n\n", ix.BuildTime)
+}
+
+// Функция processWithPlanner обрабатывает данные способом, выбранным планировщиком.
+// Если explain, план выводится перед выполнением.
+func processWithPlanner(workers []Worker, position string, ix *ChunkIndex, explain bool) {
+	if explain {
+		printPlan(planAnalysis(workers, position, ix))
+	}
+
+	// Засекаем время начала выполнения.
+	start := time.Now()
+
+	avgAge, maxSalary, plan := analyze(workers, position, ix)
+
+	// Вычисляем время выполнения.
+	duration := time.Since(start)
+
+	// Выводим результаты.
+	mode := "последовательно"
+	if plan.Parallel {
+		mode = fmt.Sprintf("параллельно, горутин: %d", plan.Goroutines)
+	}
+	fmt.Printf("Автоматический выбор (%s, оценка работы: %.0f):\n", mode, plan.Cost)
+	fmt.Printf("Средний возраст: %.2f\n", avgAge)
+	fmt.Printf("Максимальная зарплата: %.2f\n", maxSalary)
+	if plan.Indexed {
+		fmt.Printf("Индекс: просмотрено частей %d, пропущено %d\n", plan.Chunks, plan.Skipped)
+	}
+	fmt.Printf("Время обработки: %v\n\n", duration)
+}
+
+// Количество записей, обрабатываемых между проверками отмены контекста.
+const cancelCheckBlock = 4096
+
+// Структура partialResult описывает результат запроса, который мог быть прерван.
+// Если запрос отменен, метрики вычислены только по обработанной части данных.
+type partialResult struct {
+	AvgAge        float64
+	MaxSalary     float64
+	AgeRecords    int  // Записей, учтенных в среднем возрасте.
+	SalaryRecords int  // Записей, просмотренных при поиске максимальной зарплаты.
+	Total         int  // Всего записей.
+	Complete      bool // Обработаны ли все записи.
+}
+
+// Функция scanWithContext обрабатывает chunk блоками по cancelCheckBlock записей,
+// проверяя отмену контекста между блоками. Возвращает количество обработанных записей.
+func scanWithContext(ctx context.Context, chunk []Worker, visit func(block []Worker)) int {
+	processed := 0
+	for processed < len(chunk) && ctx.Err() == nil {
+		end := processed + cancelCheckBlock
+		if end > len(chunk) {
+			end = len(chunk)
+		}
+		visit(chunk[processed:end])
+		processed = end
+	}
+	return processed
+}
+
+// Функция analyzeWithContext вычисляет средний возраст и максимальную зарплату в numGoroutines
+// горутинах с учетом отмены контекста. При отмене возвращается частичный результат
+// с количеством обработанных записей вместо того, чтобы отбрасывать уже сделанную работу.
+func analyzeWithContext(ctx context.Context, workers []Worker, position string, numGoroutines int) partialResult {
+	result := partialResult{Total: len(workers)}
+	chunks := blockPartitioner{}.Partition(workers, numGoroutines)
+
+	// Срезы для хранения промежуточных результатов.
+	ageTotals := make([]int64, len(chunks))
+	ageCounts := make([]int64, len(chunks))
+	ageProcessed := make([]int, len(chunks))
+	maxSalaryResults := make([]float64, len(chunks))
+	salaryProcessed := make([]int, len(chunks))
+
+	// Запускаем горутины для суммирования возраста.
+	RunScope(ctx, func(s *Scope) {
+		for i, chunk := range chunks {
+			s.Go(func(ctx context.Context) error {
+				ageProcessed[i] = scanWithContext(ctx, chunk, func(block []Worker) {
+					total, count := sumAges(block, position)
+					ageTotals[i] = addInt64(ageTotals[i], total)
+					ageCounts[i] += count
+				})
+				return nil
+			})
+		}
+	})
+
+	// Объединяем результаты среднего возраста по обработанной части.
+	var totalAge, count int64
+	for i := range chunks {
+		totalAge = addInt64(totalAge, ageTotals[i])
+		count = addInt64(count, ageCounts[i])
+		result.AgeRecords += ageProcessed[i]
+	}
+	if count > 0 {
+		result.AvgAge = float64(totalAge) / float64(count)
+	}
+
+	// Поиск максимальной зарплаты зависит от среднего возраста, поэтому
+	// выполняется, только если средний возраст вычислен полностью.
+	if result.AgeRecords == result.Total {
+		RunScope(ctx, func(s *Scope) {
+			for i, chunk := range chunks {
+				s.Go(func(ctx context.Context) error {
+					salaryProcessed[i] = scanWithContext(ctx, chunk, func(block []Worker) {
+						if max := findMaxSalary(block, position, result.AvgAge); max > maxSalaryResults[i] {
+							maxSalaryResults[i] = max
+						}
+					})
+					return nil
+				})
+			}
+		})
+
+		for i := range chunks {
+			if maxSalaryResults[i] > result.MaxSalary {
+				result.MaxSalary = maxSalaryResults[i]
+			}
+			result.SalaryRecords += salaryProcessed[i]
+		}
+	}
+
+	result.Complete = result.AgeRecords == result.Total && result.SalaryRecords == result.Total
+	return result
+}
+
+// Функция coverage возвращает долю обработанных записей в процентах.
+func coverage(processed, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(processed) * 100 / float64(total)
+}
+
+// Функция processWithTimeout обрабатывает данные с ограничением времени и выводит
+// частичный результат, если запрос не успел завершиться.
+func processWithTimeout(workers []Worker, position string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Засекаем время начала выполнения.
+	start := time.Now()
+
+	result := analyzeWithContext(ctx, workers, position, 3)
+
+	// Вычисляем время выполнения.
+	duration := time.Since(start)
+
+	// Выводим результаты.
+	status := "завершено"
+	if !result.Complete {
+		status = "прервано, результат неполный"
+	}
+	fmt.Printf("С ограничением времени %v (%s):\n", timeout, status)
+	fmt.Printf("Средний возраст: %.2f\n", result.AvgAge)
+	fmt.Printf("Максимальная зарплата: %.2f\n", result.MaxSalary)
+	fmt.Printf("Обработано записей: возраст %d из %d (%.1f%%), зарплата %d из %d (%.1f%%)\n",
+		result.AgeRecords, result.Total, coverage(result.AgeRecords, result.Total),
+		result.SalaryRecords, result.Total, coverage(result.SalaryRecords, result.Total))
+	fmt.Printf("Время обработки: %v\n\n", duration)
+}
+
+// Структура SalaryGrade задает вилку зарплат для должности.
+type SalaryGrade struct {
+	Position  string
+	MinSalary float64
+	MaxSalary float64
+}
+
+// Структура gradeViolation описывает работника, зарплата которого вне вилки его должности.
+type gradeViolation struct {
+	Worker Worker
+	Grade  SalaryGrade
+}
+
+// Функция positionPartition возвращает номер части для должности по ее хешу.
+// Обе таблицы делятся по одному и тому же хешу, поэтому совпадающие ключи
+// всегда попадают в части с одинаковым номером.
+func positionPartition(position string, parts int) int {
+	return keyPartition(position, parts)
+}
+
+// Функция keyPartition возвращает номер части для строкового ключа по его хешу FNV-1a.
+func keyPartition(key string, parts int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(parts))
+}
+
+// Функция hashSplit делит работников на parts частей по хешу ключа key: каждая горутина
+// делит свой блок, и результат local[i][p] — работники блока i, попавшие в часть p.
+// Части с одинаковым номером у двух таблиц содержат все совпадающие ключи.
+func hashSplit(workers []Worker, parts int, key func(Worker) string) [][][]Worker {
+	chunks := blockPartitioner{}.Partition(workers, parts)
+	local := make([][][]Worker, len(chunks))
+	RunScope(context.Background(), func(s *Scope) {
+		for i, chunk := range chunks {
+			s.Go(func(context.Context) error {
+				local[i] = make([][]Worker, parts)
+				for _, worker := range chunk {
+					p := keyPartition(key(worker), parts)
+					local[i][p] = append(local[i][p], worker)
+				}
+				return nil
+			})
+		}
+	})
+	return local
+}
+
+// Функция hashJoinOutOfGrade соединяет работников с таблицей вилок зарплат по должности
+// параллельным хеш-соединением и возвращает работников, чья зарплата вне вилки.
+// Обе таблицы делятся на parts частей по хешу должности, после чего каждая горутина
+// строит хеш-таблицу по своей части вилок и проверяет по ней свою часть работников.
+func hashJoinOutOfGrade(workers []Worker, grades []SalaryGrade, parts int) []gradeViolation {
+	if parts <= 0 {
+		parts = 1
+	}
+
+	// Делим таблицу вилок по хешу должности.
+	gradeParts := make([][]SalaryGrade, parts)
+	for _, grade := range grades {
+		p := positionPartition(grade.Position, parts)
+		gradeParts[p] = append(gradeParts[p], grade)
+	}
+
+	// Делим работников по хешу должности: каждая горутина делит свой блок,
+	// затем блоки одной части объединяются.
+	local := hashSplit(workers, parts, func(w Worker) string { return w.Position })
+
+	// Построение и проверка: часть p обрабатывается своей горутиной.
+	results := make([][]gradeViolation, parts)
+	RunScope(context.Background(), func(s *Scope) {
+		for p := 0; p < parts; p++ {
+			s.Go(func(context.Context) error {
+				table := make(map[string]SalaryGrade, len(gradeParts[p]))
+				for _, grade := range gradeParts[p] {
+					table[grade.Position] = grade
+				}
+				for i := range local {
+					for _, worker := range local[i][p] {
+						grade, ok := table[worker.Position]
+						if ok && (worker.Salary < grade.MinSalary || worker.Salary > grade.MaxSalary) {
+							results[p] = append(results[p], gradeViolation{Worker: worker, Grade: grade})
+						}
+					}
+				}
+				return nil
+			})
+		}
+	})
+
+	// Объединяем результаты частей.
+	var violations []gradeViolation
+	for _, r := range results {
+		violations = append(violations, r...)
+	}
+	return violations
+}
+
+// Функция processSalaryGrades находит работников с зарплатой вне вилки их должности
+// и выводит количество таких работников по должностям с несколькими примерами.
+func processSalaryGrades(workers []Worker, grades []SalaryGrade) {
+	// Засекаем время начала выполнения.
+	start := time.Now()
+
+	violations := hashJoinOutOfGrade(workers, grades, 3)
+
+	// Вычисляем время выполнения.
+	duration := time.Since(start)
+
+	// Порядок результатов зависит от разбиения, поэтому для вывода упорядочиваем их.
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Worker.Name < violations[j].Worker.Name
+	})
+	byPosition := make(map[string]int)
+	for _, v := range violations {
+		byPosition[v.Worker.Position]++
+	}
+
+	// Выводим результаты.
+	fmt.Printf("Зарплата вне вилки (параллельное хеш-соединение):\n")
+	for _, grade := range grades {
+		fmt.Printf("Должность %s (%.0f–%.0f): %d работников\n",
+			positionName(grade.Position), grade.MinSalary, grade.MaxSalary, byPosition[grade.Position])
+	}
+	for i := 0; i < len(violations) && i < 3; i++ {
+		fmt.Printf("Например: %s, %s, %.2f\n",
+			violations[i].Worker.Name, positionName(violations[i].Worker.Position), violations[i].Worker.Salary)
+	}
+	fmt.Printf("Время обработки: %v\n\n", duration)
+}
+
+// Интерфейс Aggregator описывает метрику, вычисляемую за один проход по данным.
+// Каждая горутина получает собственный пустой агрегатор (метод Empty), заполняет его
+// своей частью данных, после чего агрегаторы частей объединяются методом Merge.
+type Aggregator interface {
+	// Метод Name возвращает название метрики для вывода.
+	Name() string
+	// Метод Empty создает пустой агрегатор с теми же параметрами.
+	Empty() Aggregator
+	// Метод Add учитывает одного работника.
+	Add(worker Worker)
+	// Метод Merge добавляет состояние агрегатора того же типа.
+	Merge(other Aggregator)
+	// Метод Result возвращает результат в виде строки для вывода.
+	Result() string
+}
+
+// Структура avgAgeAggregator вычисляет средний возраст работников должности.
+type avgAgeAggregator struct {
+	position        string
+	totalAge, count int64
+}
+
+func (a *avgAgeAggregator) Name() string      { return "Средний возраст" }
+func (a *avgAgeAggregator) Empty() Aggregator { return &avgAgeAggregator{position: a.position} }
+
+func (a *avgAgeAggregator) Add(worker Worker) {
+	if worker.Position == a.position {
+		a.totalAge = addInt64(a.totalAge, int64(worker.Age))
+		a.count++
+	}
+}
+
+func (a *avgAgeAggregator) Merge(other Aggregator) {
+	o := other.(*avgAgeAggregator)
+	a.totalAge = addInt64(a.totalAge, o.totalAge)
+	a.count += o.count
+}
+
+func (a *avgAgeAggregator) Result() string {
+	if a.count == 0 {
+		return "0.00"
+	}
+	return fmt.Sprintf("%.2f", float64(a.totalAge)/float64(a.count))
+}
+
+// Структура maxSalaryAggregator находит максимальную зарплату работников должности.
+// В отличие от findMaxSalary, не зависит от среднего возраста, поэтому вычисляется
+// в том же проходе, что и остальные метрики.
+type maxSalaryAggregator struct {
+	position  string
+	maxSalary float64
+}
+
+func (a *maxSalaryAggregator) Name() string      { return "Максимальная зарплата" }
+func (a *maxSalaryAggregator) Empty() Aggregator { return &maxSalaryAggregator{position: a.position} }
+
+func (a *maxSalaryAggregator) Add(worker Worker) {
+	if worker.Position == a.position && worker.Salary > a.maxSalary {
+		a.maxSalary = worker.Salary
+	}
+}
+
+func (a *maxSalaryAggregator) Merge(other Aggregator) {
+	if o := other.(*maxSalaryAggregator); o.maxSalary > a.maxSalary {
+		a.maxSalary = o.maxSalary
+	}
+}
+
+func (a *maxSalaryAggregator) Result() string { return fmt.Sprintf("%.2f", a.maxSalary) }
+
+// Структура ageHistogramAggregator строит гистограмму возрастов работников должности по десятилетиям.
+type ageHistogramAggregator struct {
+	position string
+	buckets  map[int]int // Начало десятилетия -> количество работников
+}
+
+func (a *ageHistogramAggregator) Name() string { return "Гистограмма возрастов" }
+
+func (a *ageHistogramAggregator) Empty() Aggregator {
+	return &ageHistogramAggregator{position: a.position, buckets: make(map[int]int)}
+}
+
+func (a *ageHistogramAggregator) Add(worker Worker) {
+	if worker.Position == a.position {
+		a.buckets[worker.Age/10*10]++
+	}
+}
+
+func (a *ageHistogramAggregator) Merge(other Aggregator) {
+	for decade, count := range other.(*ageHistogramAggregator).buckets {
+		a.buckets[decade] += count
+	}
+}
+
+func (a *ageHistogramAggregator) Result() string {
+	decades := make([]int, 0, len(a.buckets))
+	for decade := range a.buckets {
+		decades = append(decades, decade)
+	}
+	sort.Ints(decades)
+	parts := make([]string, len(decades))
+	for i, decade := range decades {
+		parts[i] = fmt.Sprintf("%d–%d: %d", decade, decade+9, a.buckets[decade])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Структура topSalaryAggregator хранит n работников должности с наибольшей зарплатой
+// в порядке убывания зарплаты.
+type topSalaryAggregator struct {
+	position string
+	n        int
+	top      []Worker
+}
+
+func (a *topSalaryAggregator) Name() string {
+	return fmt.Sprintf("Топ-%d по зарплате", a.n)
+}
+
+func (a *topSalaryAggregator) Empty() Aggregator {
+	return &topSalaryAggregator{position: a.position, n: a.n}
+}
+
+func (a *topSalaryAggregator) Add(worker Worker) {
+	if worker.Position != a.position {
+		return
+	}
+	// Если список заполнен и зарплата не больше минимальной в нем, работник не попадает в топ.
+	if len(a.top) == a.n && worker.Salary <= a.top[len(a.top)-1].Salary {
+		return
+	}
+	// Вставляем работника, сохраняя порядок убывания.
+	i := sort.Search(len(a.top), func(i int) bool { return a.top[i].Salary < worker.Salary })
+	a.top = append(a.top, Worker{})
+	copy(a.top[i+1:], a.top[i:])
+	a.top[i] = worker
+	if len(a.top) > a.n {
+		a.top = a.top[:a.n]
+	}
+}
+
+func (a *topSalaryAggregator) Merge(other Aggregator) {
+	for _, worker := range other.(*topSalaryAggregator).top {
+		a.Add(worker)
+	}
+}
+
+func (a *topSalaryAggregator) Result() string {
+	parts := make([]string, len(a.top))
+	for i, worker := range a.top {
+		parts[i] = fmt.Sprintf("%s (%.0f)", worker.Name, worker.Salary)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Функция runBatch вычисляет все агрегаторы за один параллельный проход по данным:
+// каждая горутина один раз просматривает свою часть и передает каждого работника
+// всем агрегаторам. Возвращает объединенные агрегаторы в том же порядке.
+func runBatch(workers []Worker, aggregators []Aggregator, numGoroutines int) []Aggregator {
+	return runBatchFiltered(workers, nil, aggregators, numGoroutines)
+}
+
+// Функция runBatchFiltered работает как runBatch, но передает агрегаторам только работников,
+// удовлетворяющих match (nil — всех).
+func runBatchFiltered(workers []Worker, match func(Worker) bool, aggregators []Aggregator, numGoroutines int) []Aggregator {
+	chunks := blockPartitioner{}.Partition(workers, numGoroutines)
+	partial := make([][]Aggregator, len(chunks))
+
+	RunScope(context.Background(), func(s *Scope) {
+		for i, chunk := range chunks {
+			s.Go(func(context.Context) error {
+				chaosPoint()
+				local := make([]Aggregator, len(aggregators))
+				for j, agg := range aggregators {
+					local[j] = agg.Empty()
+				}
+				for _, worker := range chunk {
+					if match != nil && !match(worker) {
+						continue
+					}
+					for _, agg := range local {
+						agg.Add(worker)
+					}
+				}
+				partial[i] = local
+				return nil
+			})
+		}
+	})
+
+	// Объединяем агрегаторы частей.
+	result := make([]Aggregator, len(aggregators))
+	for j, agg := range aggregators {
+		result[j] = agg.Empty()
+		for i := range partial {
+			result[j].Merge(partial[i][j])
+		}
+	}
+	return result
+}
+
+// Структура Query представляет цепочку фильтров над работниками. Фильтры не выполняются
+// сразу: Aggregate передает подходящих работников прямо в агрегаторы за один проход,
+// не создавая отфильтрованный срез, а Materialize строит срез, когда он действительно нужен.
+type Query struct {
+	workers []Worker
+	filters []func(Worker) bool
+}
+
+// Функция From начинает запрос над работниками workers.
+func From(workers []Worker) Query {
+	return Query{workers: workers}
+}
+
+// Метод Filter возвращает запрос с дополнительным условием pred. Исходный запрос не меняется.
+func (q Query) Filter(pred func(Worker) bool) Query {
+	filters := make([]func(Worker) bool, len(q.filters), len(q.filters)+1)
+	copy(filters, q.filters)
+	q.filters = append(filters, pred)
+	return q
+}
+
+// Метод match сообщает, удовлетворяет ли работник всем условиям запроса.
+func (q Query) match(worker Worker) bool {
+	for _, pred := range q.filters {
+		if !pred(worker) {
+			return false
+		}
+	}
+	return true
+}
+
+// Метод Materialize возвращает срез работников, удовлетворяющих всем условиям.
+func (q Query) Materialize() []Worker {
+	var result []Worker
+	for _, worker := range q.workers {
+		if q.match(worker) {
+			result = append(result, worker)
+		}
+	}
+	return result
+}
+
+// Метод Aggregate вычисляет агрегаторы по работникам, удовлетворяющим условиям,
+// за один параллельный проход без промежуточного среза.
+func (q Query) Aggregate(aggregators []Aggregator, numGoroutines int) []Aggregator {
+	return runBatchFiltered(q.workers, q.match, aggregators, numGoroutines)
+}
+
+// Функция processFilterChain сравнивает цепочку "фильтр → несколько агрегатов" с отдельным
+// отфильтрованным срезом и с потоковой передачей подходящих работников в агрегаторы.
+func processFilterChain(workers []Worker, position string) {
+	query := From(workers).
+		Filter(func(w Worker) bool { return w.Position == position }).
+		Filter(func(w Worker) bool { return w.Age < 30 }).
+		Filter(func(w Worker) bool { return w.Salary > 90000 })
+	newAggregators := func() []Aggregator {
+		return []Aggregator{
+			&avgAgeAggregator{position: position},
+			&maxSalaryAggregator{position: position},
+			&topSalaryAggregator{position: position, n: 3},
+		}
+	}
+	numGoroutines := runtime.GOMAXPROCS(0)
+
+	// measure возвращает время выполнения f и выделенную за это время память.
+	measure := func(f func()) (time.Duration, uint64) {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		f()
+		duration := time.Since(start)
+		runtime.ReadMemStats(&after)
+		return duration, after.TotalAlloc - before.TotalAlloc
+	}
+
+	var materialized, lazy []Aggregator
+	matDuration, matAlloc := measure(func() { materialized = runBatch(query.Materialize(), newAggregators(), numGoroutines) })
+	lazyDuration, lazyAlloc := measure(func() { lazy = query.Aggregate(newAggregators(), numGoroutines) })
+
+	fmt.Printf("Цепочка фильтр → агрегаты (%s, моложе 30, зарплата выше 90000):\n", positionName(position))
+	for j, agg := range lazy {
+		fmt.Printf("%s: %s\n", agg.Name(), agg.Result())
+		if materialized[j].Result() != agg.Result() {
+			fmt.Printf("Расхождение с отфильтрованным срезом: %s\n", materialized[j].Result())
+		}
+	}
+	fmt.Printf("Выделено памяти: %.1f КиБ (с отфильтрованным срезом: %.1f КиБ)\n", float64(lazyAlloc)/1024, float64(matAlloc)/1024)
+	fmt.Printf("Время обработки: %v (с отфильтрованным срезом: %v)\n\n", lazyDuration, matDuration)
+}
+
+// Структура Columns представляет работников в виде столбцов: значения одного поля лежат
+// в памяти подряд, поэтому условие по одному полю читает только его столбец.
+type Columns struct {
+	Positions []string
+	Ages      []int
+	Salaries  []float64
+}
+
+// Функция NewColumns раскладывает работников по столбцам.
+func NewColumns(workers []Worker) Columns {
+	c := Columns{
+		Positions: make([]string, len(workers)),
+		Ages:      make([]int, len(workers)),
+		Salaries:  make([]float64, len(workers)),
+	}
+	for i, worker := range workers {
+		c.Positions[i], c.Ages[i], c.Salaries[i] = worker.Position, worker.Age, worker.Salary
+	}
+	return c
+}
+
+// Тип Bitmap представляет вектор выбора: бит i установлен, если запись i удовлетворяет условию.
+type Bitmap []uint64
+
+// Функция bit переводит условие в 0 или 1. Компилятор превращает ее в инструкцию
+// установки флага, поэтому заполнение битовой карты обходится без ветвлений.
+func bit(cond bool) uint64 {
+	var b uint64
+	if cond {
+		b = 1
+	}
+	return b
+}
+
+// Функция selectWhere строит битовую карту для n записей по условию pred над номером записи.
+// Слова карты заполняются параллельно в numGoroutines горутинах: каждое слово пишет
+// ровно одна горутина.
+func selectWhere(n int, pred func(i int) bool, numGoroutines int) Bitmap {
+	words := make(Bitmap, (n+63)/64)
+	RunScope(context.Background(), func(s *Scope) {
+		for _, r := range partition(len(words), numGoroutines) {
+			s.Go(func(context.Context) error {
+				for w := r[0]; w < r[1]; w++ {
+					var word uint64
+					for j, i := 0, w*64; j < 64 && i < n; j, i = j+1, i+1 {
+						word |= bit(pred(i)) << j
+					}
+					words[w] = word
+				}
+				return nil
+			})
+		}
+	})
+	return words
+}
+
+// Метод And оставляет в карте только записи, выбранные и в other.
+func (b Bitmap) And(other Bitmap) Bitmap {
+	for i := range b {
+		b[i] &= other[i]
+	}
+	return b
+}
+
+// Метод Count возвращает количество выбранных записей.
+func (b Bitmap) Count() int {
+	count := 0
+	for _, word := range b {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// Метод ForEach вызывает visit для номера каждой выбранной записи в диапазоне слов [from, to).
+func (b Bitmap) ForEach(from, to int, visit func(i int)) {
+	for w := from; w < to; w++ {
+		for word := b[w]; word != 0; word &= word - 1 {
+			visit(w*64 + bits.TrailingZeros64(word))
+		}
+	}
+}
+
+// Функция aggregateSelected вычисляет количество, средний возраст и максимальную зарплату
+// выбранных записей. Горутины делят между собой слова карты.
+func aggregateSelected(c Columns, sel Bitmap, numGoroutines int) (int, float64, float64) {
+	ranges := partition(len(sel), numGoroutines)
+	ageSums := make([]int64, len(ranges))
+	counts := make([]int64, len(ranges))
+	maxSalaries := make([]float64, len(ranges))
+	RunScope(context.Background(), func(s *Scope) {
+		for k, r := range ranges {
+			s.Go(func(context.Context) error {
+				sel.ForEach(r[0], r[1], func(i int) {
+					ageSums[k] = addInt64(ageSums[k], int64(c.Ages[i]))
+					counts[k]++
+					maxSalaries[k] = max(maxSalaries[k], c.Salaries[i])
+				})
+				return nil
+			})
+		}
+	})
+
+	var ageSum, count int64
+	var maxSalary float64
+	for k := range ranges {
+		ageSum = addInt64(ageSum, ageSums[k])
+		count = addInt64(count, counts[k])
+		maxSalary = max(maxSalary, maxSalaries[k])
+	}
+	var avgAge float64
+	if count > 0 {
+		avgAge = float64(ageSum) / float64(count)
+	}
+	return int(count), avgAge, maxSalary
+}
+
+// Функция processColumnar выполняет запрос с тремя условиями по столбцам: каждое условие
+// дает битовую карту, карты объединяются побитовым И, и агрегаты читают только выбранные
+// записи. Для сравнения тот же запрос выполняется построчно через Query.
+func processColumnar(workers []Worker, position string) {
+	numGoroutines := runtime.GOMAXPROCS(0)
+
+	// Раскладка по столбцам делается один раз при загрузке и в замер не входит.
+	columns := NewColumns(workers)
+	start := time.Now()
+	sel := selectWhere(len(workers), func(i int) bool { return columns.Positions[i] == position }, numGoroutines)
+	sel.And(selectWhere(len(workers), func(i int) bool { return columns.Ages[i] < 30 }, numGoroutines))
+	sel.And(selectWhere(len(workers), func(i int) bool { return columns.Salaries[i] > 90000 }, numGoroutines))
+	count, avgAge, maxSalary := aggregateSelected(columns, sel, numGoroutines)
+	columnarDuration := time.Since(start)
+
+	start = time.Now()
+	rows := From(workers).
+		Filter(func(w Worker) bool { return w.Position == position }).
+		Filter(func(w Worker) bool { return w.Age < 30 }).
+		Filter(func(w Worker) bool { return w.Salary > 90000 }).
+		Aggregate([]Aggregator{&avgAgeAggregator{position: position}, &maxSalaryAggregator{position: position}}, numGoroutines)
+	rowDuration := time.Since(start)
+
+	fmt.Printf("Выборка битовыми картами по столбцам (%s, моложе 30, зарплата выше 90000):\n", positionName(position))
+	fmt.Printf("Выбрано работников: %d из %d\n", count, len(workers))
+	fmt.Printf("Средний возраст: %.2f (построчно: %s)\n", avgAge, rows[0].Result())
+	fmt.Printf("Максимальная зарплата: %.2f (построчно: %s)\n", maxSalary, rows[1].Result())
+	fmt.Printf("Время обработки: %v (построчно: %v)\n\n", columnarDuration, rowDuration)
+}
+
+// Функция processBatch вычисляет несколько метрик одним пакетным запросом и сравнивает
+// его с отдельным проходом по данным для каждой метрики.
+func processBatch(workers []Worker, position string) {
+	aggregators := []Aggregator{
+		&avgAgeAggregator{position: position},
+		&maxSalaryAggregator{position: position},
+		&ageHistogramAggregator{position: position},
+		&topSalaryAggregator{position: position, n: 3},
+		&salaryQuantilesAggregator{position: position, alpha: 0.01},
+	}
+
+	// Отдельный проход для каждой метрики.
+	start := time.Now()
+	for _, agg := range aggregators {
+		runBatch(workers, []Aggregator{agg}, 3)
+	}
+	separateDuration := time.Since(start)
+
+	// Один проход для всех метрик.
+	start = time.Now()
+	results := runBatch(workers, aggregators, 3)
+	batchDuration := time.Since(start)
+
+	// Выводим результаты.
+	fmt.Printf("Пакетный запрос (%d метрики за один проход):\n", len(aggregators))
+	for _, agg := range results {
+		fmt.Printf("%s: %s\n", agg.Name(), agg.Result())
+	}
+	fmt.Printf("Проходов по данным: 1 вместо %d\n", len(aggregators))
+	fmt.Printf("Время обработки: %v (отдельными проходами: %v)\n\n", batchDuration, separateDuration)
+}
+
+// Структура DDSketch представляет скетч квантилей с гарантированной относительной
+// точностью alpha: значения раскладываются по логарифмическим корзинам, границы которых
+// растут в gamma = (1+alpha)/(1-alpha) раз. Скетчи частей объединяются сложением
+// счетчиков корзин, поэтому квантили, вычисленные параллельно, совпадают с вычисленными
+// за один проход, и глобальная сортировка не нужна.
+type DDSketch struct {
+	gamma    float64
+	logGamma float64
+	buckets  map[int]int
+	zeros    int // Количество неположительных значений.
+	count    int
+}
+
+// Функция NewDDSketch создает пустой скетч с относительной точностью alpha.
+func NewDDSketch(alpha float64) *DDSketch {
+	gamma := (1 + alpha) / (1 - alpha)
+	return &DDSketch{gamma: gamma, logGamma: math.Log(gamma), buckets: make(map[int]int)}
+}
+
+// Метод Add добавляет значение в скетч.
+func (s *DDSketch) Add(x float64) {
+	s.count++
+	if x <= 0 {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(x)/s.logGamma))]++
+}
+
+// Метод Merge добавляет к скетчу другой скетч с той же точностью.
+func (s *DDSketch) Merge(other *DDSketch) {
+	s.count += other.count
+	s.zeros += other.zeros
+	for i, c := range other.buckets {
+		s.buckets[i] += c
+	}
+}
+
+// Метод Quantile возвращает оценку квантиля q (от 0 до 1).
+func (s *DDSketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := int(q * float64(s.count-1))
+	if rank < s.zeros {
+		return 0
+	}
+	rank -= s.zeros
+
+	keys := make([]int, 0, len(s.buckets))
+	for i := range s.buckets {
+		keys = append(keys, i)
+	}
+	sort.Ints(keys)
+	for _, i := range keys {
+		if rank < s.buckets[i] {
+			// Середина корзины (gamma^(i-1), gamma^i] с относительной погрешностью не больше alpha.
+			return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)
+		}
+		rank -= s.buckets[i]
+	}
+	return 2 * math.Pow(s.gamma, float64(keys[len(keys)-1])) / (s.gamma + 1)
+}
+
+// Структура salaryQuantilesAggregator оценивает квантили зарплаты работников должности с помощью DDSketch.
+type salaryQuantilesAggregator struct {
+	position string
+	alpha    float64
+	sketch   *DDSketch
+}
+
+func (a *salaryQuantilesAggregator) Name() string { return "Квантили зарплаты" }
+
+func (a *salaryQuantilesAggregator) Empty() Aggregator {
+	return &salaryQuantilesAggregator{position: a.position, alpha: a.alpha, sketch: NewDDSketch(a.alpha)}
+}
+
+func (a *salaryQuantilesAggregator) Add(worker Worker) {
+	if worker.Position == a.position {
+		a.sketch.Add(worker.Salary)
+	}
+}
+
+func (a *salaryQuantilesAggregator) Merge(other Aggregator) {
+	a.sketch.Merge(other.(*salaryQuantilesAggregator).sketch)
+}
+
+func (a *salaryQuantilesAggregator) Result() string {
+	return fmt.Sprintf("p50: %.0f, p90: %.0f, p99: %.0f",
+		a.sketch.Quantile(0.5), a.sketch.Quantile(0.9), a.sketch.Quantile(0.99))
+}
+
+// Бюджет памяти промежуточных результатов в байтах (флаг -max-memory, 0 — без ограничения).
+var memoryBudget int64
+
+// Структура sortItem представляет элемент внешней сортировки: ключ и номер записи,
+// по которому после сортировки можно найти саму запись.
+type sortItem struct {
+	Key   float64
+	Index int64
+}
+
+// Размер sortItem в файле серии.
+const sortItemSize = 16
+
+// Структура spillSorter представляет параллельную внешнюю сортировку слиянием. Пока элементы
+// помещаются в memoryBudget, они хранятся в памяти; при превышении бюджета буфер передается
+// пулу горутин, которые сортируют его и записывают на диск отдельной серией, а сортировщик
+// продолжает заполнять новый буфер. Итоговый порядок получается k-путевым слиянием серий
+// через дерево проигравших, поэтому в памяти находятся только буферы серий, которые
+// еще записываются, и по одному элементу из каждой серии.
+type spillSorter struct {
+	buf  []sortItem
+	dir  string   // Каталог временных файлов, создается при первом вытеснении.
+	runs []string // Файлы отсортированных серий.
+	pool *Pool    // Горутины, сортирующие и записывающие серии.
+
+	mu  sync.Mutex
+	err error // Первая ошибка вытеснения.
+}
+
+// Метод runSize возвращает количество элементов в одной серии. Пул держит до 2·GOMAXPROCS
+// буферов (в очереди и в работе), еще один заполняется, и вместе они не превышают бюджет.
+func (s *spillSorter) runSize() int {
+	return max(1, int(memoryBudget/sortItemSize)/(2*runtime.GOMAXPROCS(0)+1))
+}
+
+// Метод Add добавляет элемент, вытесняя буфер на диск при превышении бюджета.
+func (s *spillSorter) Add(key float64, index int) {
+	s.buf = append(s.buf, sortItem{Key: key, Index: int64(index)})
+	if memoryBudget > 0 && len(s.buf) >= s.runSize() {
+		s.spill()
+	}
+}
+
+// Метод fail запоминает первую ошибку вытеснения.
+func (s *spillSorter) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Метод spill передает буфер пулу для сортировки и записи новой серии.
+func (s *spillSorter) spill() {
+	if len(s.buf) == 0 {
+		return
+	}
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "lab4-spill-")
+		if err != nil {
+			s.fail(err)
+			s.buf = s.buf[:0]
+			return
+		}
+		s.dir = dir
+		s.pool = NewPool(runtime.GOMAXPROCS(0))
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("run-%d", len(s.runs)))
+	s.runs = append(s.runs, path)
+	buf := s.buf
+	s.buf = make([]sortItem, 0, cap(buf))
+	s.pool.Go(func() {
+		sortItems(buf)
+		if err := writeRun(path, buf); err != nil {
+			s.fail(err)
+		}
+	})
+}
+
+// Функция sortItems сортирует элементы по ключу, при равных ключах — по номеру записи,
+// чтобы порядок не зависел от разбиения на серии.
+func sortItems(items []sortItem) {
+	sort.Slice(items, func(i, j int) bool { return lessItem(items[i], items[j]) })
+}
+
+// Функция lessItem сравнивает элементы по ключу и номеру записи.
+func lessItem(a, b sortItem) bool {
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.Index < b.Index
+}
+
+// Функция writeRun записывает отсортированную серию в файл как последовательность
+// пар (ключ, номер) в порядке little-endian.
+func writeRun(path string, items []sortItem) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := binary.Write(w, binary.LittleEndian, items); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Структура runReader последовательно читает элементы серии из файла.
+type runReader struct {
+	f    *os.File
+	r    *bufio.Reader
+	head sortItem // Текущий (наименьший непрочитанный) элемент серии.
+	done bool     // Серия прочитана до конца.
+}
+
+// Метод next читает следующий элемент серии; в конце серии отмечает ее прочитанной.
+func (r *runReader) next() error {
+	err := binary.Read(r.r, binary.LittleEndian, &r.head)
+	if err == io.EOF {
+		r.done = true
+		return nil
+	}
+	return err
+}
+
+// Структура loserTree представляет дерево проигравших для k-путевого слияния: во внутренних
+// узлах хранятся номера серий, проигравших сравнение в этом узле, а в корне — победитель.
+// После выдачи элемента победителя достаточно переиграть путь от его листа к корню,
+// то есть log k сравнений против 2·log k у двоичной кучи.
+type loserTree struct {
+	nodes []int // nodes[0] — победитель, nodes[1:] — проигравшие; -1 — еще не сыгранный узел.
+	runs  []*runReader
+}
+
+// Функция newLoserTree строит дерево по сериям, у которых уже прочитан первый элемент.
+func newLoserTree(runs []*runReader) *loserTree {
+	t := &loserTree{nodes: make([]int, len(runs)), runs: runs}
+	for i := range t.nodes {
+		t.nodes[i] = -1
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		t.replay(i)
+	}
+	return t
+}
+
+// Метод beats сообщает, что серия a выигрывает у серии b (ее текущий элемент меньше).
+// Несыгранный узел (-1) выигрывает у всех, прочитанная серия проигрывает всем.
+func (t *loserTree) beats(a, b int) bool {
+	switch {
+	case a == -1:
+		return true
+	case b == -1:
+		return false
+	case t.runs[a].done:
+		return false
+	case t.runs[b].done:
+		return true
+	}
+	return lessItem(t.runs[a].head, t.runs[b].head)
+}
+
+// Метод replay переигрывает путь от листа серии s к корню.
+func (t *loserTree) replay(s int) {
+	for node := (s + len(t.runs)) / 2; node > 0; node /= 2 {
+		if t.beats(t.nodes[node], s) {
+			s, t.nodes[node] = t.nodes[node], s
+		}
+	}
+	t.nodes[0] = s
+}
+
+// Метод Each передает visit все элементы в порядке возрастания вместе с их номером в этом
+// порядке. Если серий на диске нет, сортируется буфер в памяти.
+func (s *spillSorter) Each(visit func(i int, item sortItem)) error {
+	if s.pool == nil {
+		sortItems(s.buf)
+		for i, item := range s.buf {
+			visit(i, item)
+		}
+		return s.err
+	}
+
+	// Остаток буфера становится последней серией; слияние начинается после записи всех серий.
+	s.spill()
+	s.pool.Close()
+	s.pool = nil
+	if s.err != nil {
+		return s.err
+	}
+
+	runs := make([]*runReader, 0, len(s.runs))
+	defer func() {
+		for _, r := range runs {
+			r.f.Close()
+		}
+	}()
+	for _, path := range s.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		r := &runReader{f: f, r: bufio.NewReader(f)}
+		runs = append(runs, r)
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+
+	tree := newLoserTree(runs)
+	for i := 0; ; i++ {
+		w := tree.nodes[0]
+		if runs[w].done {
+			return nil
+		}
+		visit(i, runs[w].head)
+		if err := runs[w].next(); err != nil {
+			return err
+		}
+		tree.replay(w)
+	}
+}
+
+// Метод Close ждет записи серий и удаляет временные файлы.
+func (s *spillSorter) Close() error {
+	if s.pool != nil {
+		s.pool.Close()
+		s.pool = nil
+	}
+	if s.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// Функция sortWorkers возвращает работников, упорядоченных по ключу key (при равных
+// ключах — в исходном порядке). Сортируются только пары (ключ, номер), и при ограниченной
+// памяти они вытесняются на диск, поэтому бюджет расходуется не на копии записей.
+func sortWorkers(workers []Worker, key func(Worker) float64) ([]Worker, int, error) {
+	var sorter spillSorter
+	defer sorter.Close()
+	for i, worker := range workers {
+		sorter.Add(key(worker), i)
+	}
+	sorted := make([]Worker, 0, len(workers))
+	err := sorter.Each(func(_ int, item sortItem) {
+		sorted = append(sorted, workers[item.Index])
+	})
+	return sorted, len(sorter.runs), err
+}
+
+// Структура KahanSum представляет сумму с компенсацией ошибки округления (вариант Ноймайера
+// алгоритма Кэхэна): младшие разряды, теряемые при каждом сложении, накапливаются в C.
+// Результат почти не зависит от порядка слагаемых и границ частей, но побитовое совпадение
+// при разных разбиениях гарантирует только фиксированный порядок сложения (SumTree).
+type KahanSum struct {
+	Sum float64
+	C   float64 // Накопленная поправка.
+}
+
+// Метод Add добавляет x к сумме.
+func (k *KahanSum) Add(x float64) {
+	t := k.Sum + x
+	if math.Abs(k.Sum) >= math.Abs(x) {
+		k.C += (k.Sum - t) + x
+	} else {
+		k.C += (x - t) + k.Sum
+	}
+	k.Sum = t
+}
+
+// Метод Merge добавляет сумму другой части вместе с ее поправкой.
+func (k *KahanSum) Merge(other KahanSum) {
+	k.Add(other.Sum)
+	k.C += other.C
+}
+
+// Метод Value возвращает сумму с учетом поправки.
+func (k KahanSum) Value() float64 {
+	return k.Sum + k.C
+}
+
+// Тип SumMode задает способ параллельного суммирования чисел с плавающей точкой.
+type SumMode string
+
+const (
+	SumNaive SumMode = "naive" // Части по числу горутин, обычное сложение.
+	SumKahan SumMode = "kahan" // Части по числу горутин, компенсированное сложение.
+	SumTree  SumMode = "tree"  // Листья фиксированного размера и фиксированное дерево сложения.
+)
+
+// Функция parseSumMode проверяет название способа суммирования из флага.
+func parseSumMode(s string) (SumMode, error) {
+	switch mode := SumMode(s); mode {
+	case SumNaive, SumKahan, SumTree:
+		return mode, nil
+	}
+	return "", fmt.Errorf("неизвестный способ суммирования %q (ожидается naive, kahan или tree)", s)
+}
+
+// Количество записей в листе дерева суммирования. Листья и порядок их сложения
+// не зависят от числа горутин, поэтому сумма SumTree одинакова до последнего бита.
+const sumLeafSize = 1024
+
+// Функция reduceTree складывает значения попарно по фиксированному дереву:
+// половины складываются рекурсивно, затем их суммы.
+func reduceTree(values []float64) float64 {
+	switch len(values) {
+	case 0:
+		return 0
+	case 1:
+		return values[0]
+	}
+	mid := len(values) / 2
+	return reduceTree(values[:mid]) + reduceTree(values[mid:])
+}
+
+// Функция sumSalaries параллельно вычисляет сумму зарплат и количество работников
+// должности способом mode. При SumNaive и SumKahan данные делятся на numGoroutines частей,
+// и результат зависит от их границ; при SumTree — на листья по sumLeafSize записей.
+func sumSalaries(workers []Worker, position string, mode SumMode, numGoroutines int) (float64, int64) {
+	grain := sumLeafSize
+	if mode != SumTree {
+		grain = (len(workers) + numGoroutines - 1) / numGoroutines
+	}
+	n := tiles(len(workers), grain)
+	grain = max(grain, 1)
+	sums := make([]KahanSum, n)
+	counts := make([]int64, n)
+	ParallelFor(context.Background(), len(workers), grain, numGoroutines, func(lo, hi int) {
+		i := lo / grain
+		for _, worker := range workers[lo:hi] {
+			if worker.Position != position {
+				continue
+			}
+			if mode == SumKahan {
+				sums[i].Add(worker.Salary)
+			} else {
+				sums[i].Sum += worker.Salary
+			}
+			counts[i]++
+		}
+	})
+
+	var count int64
+	for _, c := range counts {
+		count = addInt64(count, c)
+	}
+	switch mode {
+	case SumKahan:
+		var total KahanSum
+		for _, s := range sums {
+			total.Merge(s)
+		}
+		return total.Value(), count
+	case SumTree:
+		leaves := make([]float64, n)
+		for i, s := range sums {
+			leaves[i] = s.Sum
+		}
+		return reduceTree(leaves), count
+	}
+	var total float64
+	for _, s := range sums {
+		total += s.Sum
+	}
+	return total, count
+}
+
+// Функция processSalarySum вычисляет среднюю зарплату каждым способом суммирования
+// при числе горутин от 1 до 8 и выводит, сколько различных (побитово) результатов
+// получилось. Средняя зарплата в заголовке вычисляется способом mode. Целые зарплаты
+// сгенерированных наборов складываются точно, и способы совпадают; расхождения появляются
+// на загруженных наборах с дробными зарплатами.
+func processSalarySum(workers []Worker, position string, mode SumMode) {
+	avg := func(mode SumMode, numGoroutines int) float64 {
+		sum, count := sumSalaries(workers, position, mode, numGoroutines)
+		if count == 0 {
+			return 0
+		}
+		return sum / float64(count)
+	}
+
+	start := time.Now()
+	result := avg(mode, runtime.GOMAXPROCS(0))
+	duration := time.Since(start)
+
+	fmt.Printf("Средняя зарплата (суммирование %s):\n", mode)
+	fmt.Printf("Средняя зарплата: %.2f\n", result)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Способ\tРезультат при 1 горутине\tРазличных результатов при 1–8 горутинах\t")
+	for _, m := range []SumMode{SumNaive, SumKahan, SumTree} {
+		distinct := make(map[float64]bool)
+		for g := 1; g <= 8; g++ {
+			distinct[avg(m, g)] = true
+		}
+		fmt.Fprintf(w, "%s\t%.17g\t%d\t\n", m, avg(m, 1), len(distinct))
+	}
+	w.Flush()
+	fmt.Printf("Время обработки: %v\n\n", duration)
+}
+
+// Функция processSalaryQuantiles вычисляет квантили зарплаты параллельно с помощью DDSketch
+// и сравнивает их с точными значениями, полученными сортировкой.
+func processSalaryQuantiles(workers []Worker, position string) {
+	const alpha = 0.01
+
+	// Засекаем время начала выполнения.
+	start := time.Now()
+	results := runBatch(workers, []Aggregator{&salaryQuantilesAggregator{position: position, alpha: alpha}}, 3)
+	sketch := results[0].(*salaryQuantilesAggregator).sketch
+	sketchDuration := time.Since(start)
+
+	// Точные квантили для сравнения. При ограниченной памяти сортировка вытесняет серии на диск.
+	quantiles := []float64{0.5, 0.9, 0.99}
+	start = time.Now()
+	var sorter spillSorter
+	defer sorter.Close()
+	count := 0
+	for _, worker := range workers {
+		if worker.Position == position {
+			sorter.Add(worker.Salary, count)
+			count++
+		}
+	}
+	exacts := make([]float64, len(quantiles))
+	err := sorter.Each(func(i int, item sortItem) {
+		for k, q := range quantiles {
+			if i == int(q*float64(count-1)) {
+				exacts[k] = item.Key
+			}
+		}
+	})
+	sortDuration := time.Since(start)
+
+	fmt.Printf("Квантили зарплаты (DDSketch, точность %.0f%%, %s):\n", alpha*100, positionName(position))
+	if err != nil {
+		fmt.Printf("Ошибка сортировки с вытеснением на диск: %v\n", err)
+	}
+	for k, q := range quantiles {
+		estimate := sketch.Quantile(q)
+		exact := exacts[k]
+		var relErr float64
+		if exact != 0 {
+			relErr = math.Abs(estimate-exact) / exact * 100
+		}
+		fmt.Printf("p%.0f: %.2f (точно: %.2f, погрешность %.2f%%)\n", q*100, estimate, exact, relErr)
+	}
+	if len(sorter.runs) > 0 {
+		fmt.Printf("Сортировка вытеснила на диск серий: %d (бюджет памяти %d КиБ)\n", len(sorter.runs), memoryBudget/1024)
+	}
+	fmt.Printf("Время обработки: %v (сортировкой: %v)\n\n", sketchDuration, sortDuration)
+}
+
+// Функция processArgMaxQueries выполняет несколько запросов вида ArgMax для должности
+// и выводит найденных работников.
+func processArgMaxQueries(workers []Worker, position string) {
+	queries := []struct {
+		name string
+		key  func(Worker) float64
+	}{
+		{"Самый старший", func(w Worker) float64 { return float64(w.Age) }},
+		{"Наибольшая зарплата на год возраста", func(w Worker) float64 { return w.Salary / float64(w.Age) }},
+	}
+	isPosition := func(w Worker) bool { return w.Position == position }
+
+	fmt.Printf("Запросы ArgMax (%s):\n", positionName(position))
+	for _, q := range queries {
+		worker, value, found := parallelArgMax(workers, isPosition, q.key, 3)
+		if !found {
+			fmt.Printf("%s: нет подходящих работников\n", q.name)
+			continue
+		}
+		fmt.Printf("%s: %s, возраст %d, зарплата %.2f (значение %.2f)\n", q.name, worker.Name, worker.Age, worker.Salary, value)
+
+		// При равных значениях параллельный и последовательный поиск должны выбрать одного работника.
+		sequential, _, _ := ArgMax(workers, isPosition, q.key)
+		if sequential != worker {
+			fmt.Printf("Расхождение с последовательным поиском: %s\n", sequential.Name)
+		}
+	}
+	fmt.Println()
+}
+
+// Структура RankWeights задает веса критериев ранжирования работников.
+type RankWeights struct {
+	Salary       float64 // Зарплата: 1 — наибольшая в должности, 0 — наименьшая.
+	AgeProximity float64 // Близость возраста к среднему по должности: 1 — ровно средний.
+	Tenure       float64 // Стаж: 1 — наибольший в должности, 0 — нулевой.
+}
+
+// Структура RankedWorker представляет работника с итоговым баллом и вкладом каждого критерия
+// (балл критерия, умноженный на его вес).
+type RankedWorker struct {
+	Worker       Worker
+	Index        int // Номер работника в исходном срезе, разрешает равенство баллов.
+	Score        float64
+	Salary       float64
+	AgeProximity float64
+	Tenure       float64
+}
+
+// Функция tenureYears возвращает стаж работника в годах на дату asOf.
+func tenureYears(worker Worker, asOf time.Time) float64 {
+	if worker.HireDate.IsZero() || worker.HireDate.After(asOf) {
+		return 0
+	}
+	return asOf.Sub(worker.HireDate).Hours() / 24 / 365.25
+}
+
+// Функция rankBetter сообщает, стоит ли a в рейтинге выше b: при равных баллах выше
+// работник с меньшим номером, поэтому результат не зависит от разбиения на части.
+func rankBetter(a, b RankedWorker) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Index < b.Index
+}
+
+// Функция insertRanked вставляет r в список top, упорядоченный по rankBetter,
+// и оставляет в нем не больше n работников.
+func insertRanked(top []RankedWorker, r RankedWorker, n int) []RankedWorker {
+	if len(top) == n && !rankBetter(r, top[len(top)-1]) {
+		return top
+	}
+	i := sort.Search(len(top), func(i int) bool { return rankBetter(r, top[i]) })
+	top = append(top, RankedWorker{})
+	copy(top[i+1:], top[i:])
+	top[i] = r
+	return top[:min(len(top), n)]
+}
+
+// Функция RankWorkers возвращает n лучших работников должности по взвешенной сумме
+// критериев на дату asOf. Критерии нормируются по должности, поэтому ранжирование
+// выполняется за два параллельных прохода: первый находит границы зарплаты, средний
+// возраст, наибольшее отклонение от него и наибольший стаж, второй считает баллы
+// и оставляет в каждой части собственный топ, которые затем объединяются.
+func RankWorkers(workers []Worker, position string, weights RankWeights, asOf time.Time, n, numGoroutines int) []RankedWorker {
+	ctx := context.Background()
+	grain := max((len(workers)+numGoroutines-1)/numGoroutines, 1)
+	parts := tiles(len(workers), grain)
+
+	// Первый проход: границы для нормировки.
+	type bounds struct {
+		count                int64
+		ageSum               int64
+		minSalary, maxSalary float64
+		minAge, maxAge       int
+		maxTenure            float64
+	}
+	partial := make([]bounds, parts)
+	ParallelFor(ctx, len(workers), grain, numGoroutines, func(lo, hi int) {
+		b := &partial[lo/grain]
+		for _, worker := range workers[lo:hi] {
+			if worker.Position != position {
+				continue
+			}
+			if b.count == 0 {
+				b.minSalary, b.maxSalary, b.minAge, b.maxAge = worker.Salary, worker.Salary, worker.Age, worker.Age
+			}
+			b.count++
+			b.ageSum += int64(worker.Age)
+			b.minSalary, b.maxSalary = min(b.minSalary, worker.Salary), max(b.maxSalary, worker.Salary)
+			b.minAge, b.maxAge = min(b.minAge, worker.Age), max(b.maxAge, worker.Age)
+			b.maxTenure = max(b.maxTenure, tenureYears(worker, asOf))
+		}
+	})
+	var total bounds
+	for _, b := range partial {
+		if b.count == 0 {
+			continue
+		}
+		if total.count == 0 {
+			total = b
+			continue
+		}
+		total.count += b.count
+		total.ageSum = addInt64(total.ageSum, b.ageSum)
+		total.minSalary, total.maxSalary = min(total.minSalary, b.minSalary), max(total.maxSalary, b.maxSalary)
+		total.minAge, total.maxAge = min(total.minAge, b.minAge), max(total.maxAge, b.maxAge)
+		total.maxTenure = max(total.maxTenure, b.maxTenure)
+	}
+	if total.count == 0 {
+		return nil
+	}
+	avgAge := float64(total.ageSum) / float64(total.count)
+	maxDeviation := max(avgAge-float64(total.minAge), float64(total.maxAge)-avgAge)
+
+	// Нормировка в [0, 1]; если у всех одинаковое значение, критерий не влияет на порядок.
+	normalize := func(x, span float64) float64 {
+		if span == 0 {
+			return 0
+		}
+		return x / span
+	}
+
+	// Второй проход: баллы и топ каждой части.
+	tops := make([][]RankedWorker, parts)
+	ParallelFor(ctx, len(workers), grain, numGoroutines, func(lo, hi int) {
+		var top []RankedWorker
+		for i := lo; i < hi; i++ {
+			worker := workers[i]
+			if worker.Position != position {
+				continue
+			}
+			r := RankedWorker{
+				Worker:       worker,
+				Index:        i,
+				Salary:       weights.Salary * normalize(worker.Salary-total.minSalary, total.maxSalary-total.minSalary),
+				AgeProximity: weights.AgeProximity * (1 - normalize(math.Abs(float64(worker.Age)-avgAge), maxDeviation)),
+				Tenure:       weights.Tenure * normalize(tenureYears(worker, asOf), total.maxTenure),
+			}
+			r.Score = r.Salary + r.AgeProximity + r.Tenure
+			top = insertRanked(top, r, n)
+		}
+		tops[lo/grain] = top
+	})
+
+	var top []RankedWorker
+	for _, part := range tops {
+		for _, r := range part {
+			top = insertRanked(top, r, n)
+		}
+	}
+	return top
+}
+
+// Функция processRanking выводит лучших работников должности по зарплате, близости
+// возраста к среднему и стажу с вкладом каждого критерия в итоговый балл.
+func processRanking(workers []Worker, position string, asOf time.Time) {
+	weights := RankWeights{Salary: 0.5, AgeProximity: 0.3, Tenure: 0.2}
+
+	start := time.Now()
+	top := RankWorkers(workers, position, weights, asOf, 5, runtime.GOMAXPROCS(0))
+	duration := time.Since(start)
+
+	fmt.Printf("Рейтинг (%s; веса: зарплата %.1f, близость к среднему возрасту %.1f, стаж %.1f):\n",
+		positionName(position), weights.Salary, weights.AgeProximity, weights.Tenure)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Работник\tВозраст\tЗарплата\tСтаж, лет\tБалл зарплаты\tБалл возраста\tБалл стажа\tИтог\t")
+	for _, r := range top {
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.1f\t%.3f\t%.3f\t%.3f\t%.3f\t\n", r.Worker.Name, r.Worker.Age, r.Worker.Salary,
+			tenureYears(r.Worker, asOf), r.Salary, r.AgeProximity, r.Tenure, r.Score)
+	}
+	w.Flush()
+	fmt.Printf("Время обработки: %v\n\n", duration)
+}
+
+// Структура positionStats накапливает сводные показатели по одной должности.
+// Возрасты хранятся как количество работников каждого возраста, поэтому медиану
+// можно точно вычислить после объединения частей без сортировки всех записей.
+type positionStats struct {
+	Count     int
+	AgeSum    int64
+	AgeCounts map[int]int
+	SalaryMin float64
+	Salary    KahanSum // Сумма зарплат с компенсацией: средняя не зависит от разбиения на части.
+	SalaryMax float64
+}
+
+// Метод add учитывает работника.
+func (s *positionStats) add(worker Worker) {
+	if s.AgeCounts == nil {
+		s.AgeCounts = make(map[int]int)
+	}
+	if s.Count == 0 || worker.Salary < s.SalaryMin {
+		s.SalaryMin = worker.Salary
+	}
+	if s.Count == 0 || worker.Salary > s.SalaryMax {
+		s.SalaryMax = worker.Salary
+	}
+	s.Count++
+	s.AgeSum = addInt64(s.AgeSum, int64(worker.Age))
+	s.AgeCounts[worker.Age]++
+	s.Salary.Add(worker.Salary)
+}
+
+// Метод merge добавляет показатели другой части.
+func (s *positionStats) merge(other *positionStats) {
+	if other.Count == 0 {
+		return
+	}
+	if s.AgeCounts == nil {
+		s.AgeCounts = make(map[int]int)
+	}
+	if s.Count == 0 || other.SalaryMin < s.SalaryMin {
+		s.SalaryMin = other.SalaryMin
+	}
+	if s.Count == 0 || other.SalaryMax > s.SalaryMax {
+		s.SalaryMax = other.SalaryMax
+	}
+	s.Count += other.Count
+	s.AgeSum = addInt64(s.AgeSum, other.AgeSum)
+	for age, count := range other.AgeCounts {
+		s.AgeCounts[age] += count
+	}
+	s.Salary.Merge(other.Salary)
+}
+
+// Метод medianAge возвращает медиану возраста. При четном количестве работников
+// берется среднее двух центральных значений.
+func (s *positionStats) medianAge() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	ages := make([]int, 0, len(s.AgeCounts))
+	for age := range s.AgeCounts {
+		ages = append(ages, age)
+	}
+	sort.Ints(ages)
+
+	// Находим возраст с порядковым номером rank (с нуля).
+	ageAt := func(rank int) int {
+		for _, age := range ages {
+			if rank < s.AgeCounts[age] {
+				return age
+			}
+			rank -= s.AgeCounts[age]
+		}
+		return ages[len(ages)-1]
+	}
+	if s.Count%2 == 1 {
+		return float64(ageAt(s.Count / 2))
+	}
+	return float64(ageAt(s.Count/2-1)+ageAt(s.Count/2)) / 2
+}
+
+// Функция collectPositionStats параллельно вычисляет сводные показатели по каждой должности.
+// Данные делятся на части для горутин стратегией partitioner. Показатели должности,
+// встретившейся только в одной части, забираются без слияния, поэтому при разбиении
+// positionPartitioner этап объединения сводится к сборке отображения.
+func collectPositionStats(workers []Worker, numGoroutines int, partitioner Partitioner) map[string]*positionStats {
+	chunks := partitioner.Partition(workers, numGoroutines)
+	partial := make([]map[string]*positionStats, len(chunks))
+
+	RunScope(context.Background(), func(scope *Scope) {
+		for i, chunk := range chunks {
+			scope.Go(func(context.Context) error {
+				chaosPoint()
+				local := make(map[string]*positionStats)
+				for _, worker := range chunk {
+					s, ok := local[worker.Position]
+					if !ok {
+						s = &positionStats{}
+						local[worker.Position] = s
+					}
+					s.add(worker)
+				}
+				partial[i] = local
+				return nil
+			})
+		}
+	})
+
+	// Объединяем показатели частей.
+	stats := make(map[string]*positionStats)
+	for _, local := range partial {
+		for position, s := range local {
+			if merged, ok := stats[position]; ok {
+				merged.merge(s)
+			} else {
+				stats[position] = s
+			}
+		}
+	}
+	return stats
+}
+
+// Функция processGroupBy сравнивает группировку по должностям при разбиении блоками,
+// когда показатели каждой должности сливаются из всех частей, и по хешу должности,
+// когда каждая должность целиком принадлежит одной горутине.
+func processGroupBy(workers []Worker) {
+	for _, partitioner := range []Partitioner{blockPartitioner{}, positionPartitioner{}} {
+		start := time.Now()
+		stats := collectPositionStats(workers, runtime.GOMAXPROCS(0), partitioner)
+		duration := time.Since(start)
+
+		fmt.Printf("Группировка по должностям (разбиение %s):\n", partitioner.Name())
+		fmt.Printf("Должностей: %d\n", len(stats))
+		fmt.Printf("Время обработки: %v\n\n", duration)
+	}
+}
+
+// Структура statsFile представляет сохраненные показатели по должностям одного или
+// нескольких запусков. Показатели сливаются методом merge, который коммутативен
+// и ассоциативен, поэтому файлы можно объединять в любом порядке и группами.
+type statsFile struct {
+	Runs      int                       `json:"runs"` // Сколько запусков учтено в файле.
+	Positions map[string]*positionStats `json:"positions"`
+}
+
+// Функция writeStats сохраняет показатели по должностям в JSON-файл.
+func writeStats(path string, stats map[string]*positionStats, runs int) error {
+	data, err := json.MarshalIndent(statsFile{Runs: runs, Positions: stats}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Функция readStats читает показатели, сохраненные writeStats.
+func readStats(path string) (statsFile, error) {
+	var file statsFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Функция mergeStatsFiles объединяет показатели из нескольких файлов.
+func mergeStatsFiles(paths []string) (map[string]*positionStats, int, error) {
+	merged := make(map[string]*positionStats)
+	runs := 0
+	for _, path := range paths {
+		file, err := readStats(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		runs += file.Runs
+		for position, s := range file.Positions {
+			if _, ok := merged[position]; !ok {
+				merged[position] = &positionStats{}
+			}
+			merged[position].merge(s)
+		}
+	}
+	return merged, runs, nil
+}
+
+// Функция runStatsCommand выполняет подкоманду stats: объединение сохраненных показателей.
+func runStatsCommand(args []string) error {
+	if len(args) == 0 || args[0] != "merge" {
+		return errors.New("использование: stats merge [-o файл] файл...")
+	}
+	fs := flag.NewFlagSet("stats merge", flag.ExitOnError)
+	out := fs.String("o", "", "файл для объединенных показателей")
+	fs.Parse(args[1:])
+	if fs.NArg() == 0 {
+		return errors.New("stats merge: не заданы файлы показателей")
+	}
+
+	merged, runs, err := mergeStatsFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Объединено файлов: %d, запусков: %d\n\n", fs.NArg(), runs)
+	printReportCard(merged)
+	if *out != "" {
+		return writeStats(*out, merged, runs)
+	}
+	return nil
+}
+
+// Функция printReportCard выводит таблицу со сводными показателями по должностям
+// и строкой итогов по всем работникам.
+func printReportCard(stats map[string]*positionStats) {
+	// Должности из справочника выводятся в его порядке, остальные — по алфавиту.
+	var positions []string
+	for _, info := range positionCatalog {
+		if _, ok := stats[info.Code]; ok {
+			positions = append(positions, info.Code)
+		}
+	}
+	var unknown []string
+	for position := range stats {
+		if _, err := resolvePosition(position); err != nil {
+			unknown = append(unknown, position)
+		}
+	}
+	sort.Strings(unknown)
+	positions = append(positions, unknown...)
+
+	var total positionStats
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Должность\tРаботников\tСр. возраст\tМедиана возраста\tМин. зарплата\tСр. зарплата\tМакс. зарплата\t")
+	row := func(name string, s *positionStats) {
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.1f\t%.2f\t%.2f\t%.2f\t\n", name, s.Count,
+			float64(s.AgeSum)/float64(s.Count), s.medianAge(),
+			s.SalaryMin, s.Salary.Value()/float64(s.Count), s.SalaryMax)
+	}
+	for _, position := range positions {
+		row(positionName(position), stats[position])
+		total.merge(stats[position])
+	}
+	if total.Count > 0 {
+		row("Итого", &total)
+	}
+
+	fmt.Printf("Сводка по должностям:\n")
+	w.Flush()
+	fmt.Println()
+}
+
+// Структура call описывает вычисление, выполняющееся внутри Group.
+type call struct {
+	wg  sync.WaitGroup
+	val float64
+}
+
+// Структура Group объединяет одновременные одинаковые запросы (singleflight):
+// пока вычисление по ключу выполняется, остальные вызывающие ждут его результата,
+// а не запускают собственное.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Метод Do выполняет fn для ключа key, если для него еще нет выполняющегося вычисления.
+// Второе возвращаемое значение сообщает, был ли результат получен от чужого вычисления.
+func (g *Group) Do(key string, fn func() float64) (float64, bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	// Если вычисление уже идет, дожидаемся его результата.
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, true
+	}
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val = fn()
+	c.wg.Done()
+
+	// Следующие запросы по этому ключу снова будут вычисляться.
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return c.val, false
+}
+
+// Функция processRequestStorm имитирует шторм одинаковых запросов среднего возраста
+// и сравнивает количество вычислений без объединения запросов и с Group.
+func processRequestStorm(workers []Worker, position string, requests int) {
+	for _, dedup := range []bool{false, true} {
+		var group Group
+		var mu sync.Mutex
+		computations := 0
+		// Канал start позволяет отпустить все запросы одновременно.
+		start := make(chan struct{})
+
+		compute := func() float64 {
+			mu.Lock()
+			computations++
+			mu.Unlock()
+			return calculateAverageAge(workers, position)
+		}
+
+		var begin time.Time
+		RunScope(context.Background(), func(s *Scope) {
+			for i := 0; i < requests; i++ {
+				s.Go(func(context.Context) error {
+					<-start
+					if dedup {
+						group.Do("avgAge:"+position, compute)
+					} else {
+						compute()
+					}
+					return nil
+				})
+			}
+			begin = time.Now()
+			close(start)
+		})
+		duration := time.Since(begin)
+
+		if dedup {
+			fmt.Printf("Шторм запросов с объединением (Group):\n")
+		} else {
+			fmt.Printf("Шторм запросов без объединения:\n")
+		}
+		fmt.Printf("Запросов: %d, вычислений: %d\n", requests, computations)
+		fmt.Printf("Время обработки: %v\n\n", duration)
+	}
+}
+
+// Функция generateWorker генерирует случайного работника, используя генератор rng.
+func generateWorker(rng *rand.Rand, index int, asOf time.Time) Worker {
+	// Генерируем имя по шаблону.
+	name := fmt.Sprintf("Работник %d", index)
+	// Случайным образом выбираем должность: "Д" или "С".
+	position := "Д"
+	if rng.Intn(2) == 0 {
+		position = "С"
+	}
+	// Генерируем случайный возраст от 20 до 60 лет на дату asOf. День рождения выбирается
+	// по номеру работника, а не генератором, чтобы при том же зерне остальные поля не изменились.
+	age := rng.Intn(41) + 20
+	birthDate := asOf.AddDate(-age, 0, -(index*97)%365)
+	// Дата приема — между 20-летием и датой asOf, тоже по номеру работника.
+	hiredFrom := birthDate.AddDate(20, 0, 0)
+	hireDate := hiredFrom.AddDate(0, 0, (index*7919)%(int(asOf.Sub(hiredFrom).Hours()/24)+1))
+	// Генерируем случайную зарплату от 30 000 до 100 000.
+	salary := float64(rng.Intn(70000) + 30000)
+
+	// Возвращаем структуру Worker с заполненными полями.
+	return Worker{
+		Name:      name,
+		Position:  position,
+		Age:       ageAt(birthDate, asOf),
+		BirthDate: birthDate,
+		HireDate:  hireDate,
+		Salary:    salary,
+	}
+}
+
+// Вероятность внедренной задержки в отмеченных точках параллельного кода (0 — хаос выключен).
+// Задается флагом -chaos.
+var chaosProb float64
+
+// Функция chaosPoint отмечает место, где порядок выполнения горутин не должен влиять
+// на результат. С вероятностью chaosProb горутина уступает процессор или засыпает
+// на случайное время до 100 мкс, поэтому от запуска к запуску горутины чередуются
+// по-разному и скрытые предположения о порядке проявляются чаще.
+func chaosPoint() {
+	if chaosProb == 0 || rand.Float64() >= chaosProb {
+		return
+	}
+	if rand.Intn(2) == 0 {
+		runtime.Gosched()
+	} else {
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+	}
+}
+
+// Структура Pool представляет пул из фиксированного числа горутин, выполняющих задачи из очереди.
+type Pool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+	full  QueueFullPolicy // Политика Submit при заполненной очереди.
+}
+
+// Функция NewPool запускает пул из size горутин. Submit при заполненной очереди ждет.
+func NewPool(size int) *Pool {
+	return NewPoolWithPolicy(size, QueueBlock)
+}
+
+// Функция NewPoolWithPolicy запускает пул из size горутин с политикой full для Submit
+// при заполненной очереди.
+func NewPoolWithPolicy(size int, full QueueFullPolicy) *Pool {
+	p := &Pool{tasks: make(chan func(), size), full: full}
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				chaosPoint()
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Метод Go ставит задачу в очередь. Если очередь заполнена, вызов блокируется.
+func (p *Pool) Go(task func()) {
+	p.tasks <- task
+}
+
+// Метод Close закрывает очередь и ждет завершения всех поставленных задач.
+func (p *Pool) Close() {
+	close(p.tasks)
+	p.wg.Wait()
+}
+
+// Тип QueueFullPolicy задает поведение пула, когда очередь задач заполнена.
+type QueueFullPolicy string
+
+const (
+	QueueBlock      QueueFullPolicy = "block"       // Ждать места в очереди (или отмены контекста).
+	QueueReject     QueueFullPolicy = "reject"      // Сразу вернуть ErrQueueFull.
+	QueueCallerRuns QueueFullPolicy = "caller-runs" // Выполнить задачу в вызывающей горутине.
+)
+
+// Ошибка ErrQueueFull возвращается при политике QueueReject, если очередь заполнена.
+var ErrQueueFull = errors.New("очередь пула заполнена")
+
+// Структура PanicError представляет панику задачи Submit. Future получает ее как ошибку,
+// а Wait повторяет панику в ожидающей горутине, как RunScope для горутин области.
+type PanicError struct {
+	Value any // Значение паники.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("паника в задаче пула: %v", e.Value)
+}
+
+// Структура Future представляет результат задачи, поставленной в пул через Submit.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Метод resolve сохраняет результат задачи и будит ожидающих. Вызывается ровно один раз.
+func (f *Future[T]) resolve(value T, err error) {
+	f.value, f.err = value, err
+	close(f.done)
+}
+
+// Метод Done возвращает канал, который закрывается, когда результат готов.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Метод Wait ждет результат задачи. Если ctx отменяется раньше, возвращается ошибка контекста,
+// а сама задача продолжает выполняться. Если задача (или одна из задач WhenAll) запаниковала,
+// Wait повторяет ее панику.
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		var panicErr *PanicError
+		if errors.As(f.err, &panicErr) {
+			panic(panicErr.Value)
+		}
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Функция Submit ставит fn в пул и возвращает Future с ее результатом. Контекст передается в fn;
+// если он отменен до начала выполнения, fn не вызывается и Future получает ошибку контекста.
+// Паника fn не завершает программу из горутины пула: Future получает *PanicError.
+// Методы Go не могут иметь параметров типа, поэтому Submit — функция, а не метод Pool.
+func Submit[T any](ctx context.Context, p *Pool, fn func(ctx context.Context) (T, error)) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	task := func() {
+		chaosPoint()
+		if err := ctx.Err(); err != nil {
+			var zero T
+			f.resolve(zero, err)
+			return
+		}
+		var value T
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r}
+			}
+			f.resolve(value, err)
+		}()
+		value, err = fn(ctx)
+	}
+
+	// Сначала пробуем поставить задачу без ожидания, иначе действуем по политике пула.
+	select {
+	case p.tasks <- task:
+		return f
+	default:
+	}
+	switch p.full {
+	case QueueReject:
+		var zero T
+		f.resolve(zero, ErrQueueFull)
+	case QueueCallerRuns:
+		task()
+	default:
+		select {
+		case p.tasks <- task:
+		case <-ctx.Done():
+			var zero T
+			f.resolve(zero, ctx.Err())
+		}
+	}
+	return f
+}
+
+// Функция SubmitBatch ставит в пул все fns и возвращает их Future в том же порядке.
+func SubmitBatch[T any](ctx context.Context, p *Pool, fns []func(ctx context.Context) (T, error)) []*Future[T] {
+	futures := make([]*Future[T], len(fns))
+	for i, fn := range fns {
+		futures[i] = Submit(ctx, p, fn)
+	}
+	return futures
+}
+
+// Функция WhenAll возвращает Future, который завершается после всех futures. Его значение —
+// результаты задач в том же порядке, ошибка — объединение ошибок задач через errors.Join
+// (значения задач, завершившихся без ошибки, при этом тоже заполнены).
+func WhenAll[T any](futures ...*Future[T]) *Future[[]T] {
+	all := &Future[[]T]{done: make(chan struct{})}
+	go func() {
+		values := make([]T, len(futures))
+		errs := make([]error, len(futures))
+		for i, f := range futures {
+			<-f.done
+			values[i], errs[i] = f.value, f.err
+		}
+		all.resolve(values, errors.Join(errs...))
+	}()
+	return all
+}
+
+// Функция WhenAny возвращает Future с результатом той из futures, которая завершится первой.
+// Для пустого списка Future не завершается никогда.
+func WhenAny[T any](futures ...*Future[T]) *Future[T] {
+	first := &Future[T]{done: make(chan struct{})}
+	var once sync.Once
+	for _, f := range futures {
+		go func() {
+			<-f.done
+			once.Do(func() { first.resolve(f.value, f.err) })
+		}()
+	}
+	return first
+}
+
+// Функция WithTimeout возвращает Future с результатом f, если он готов в течение d,
+// иначе с ошибкой context.DeadlineExceeded. Сама задача f при этом не отменяется.
+func WithTimeout[T any](f *Future[T], d time.Duration) *Future[T] {
+	limited := &Future[T]{done: make(chan struct{})}
+	go func() {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-f.done:
+			limited.resolve(f.value, f.err)
+		case <-timer.C:
+			var zero T
+			limited.resolve(zero, context.DeadlineExceeded)
+		}
+	}()
+	return limited
+}
+
+// Структура Scope представляет область структурированной конкурентности: горутины,
+// запущенные через Go, не переживают RunScope, которая ждет их всех перед возвратом.
+// Первая ошибка или паника отменяет контекст области, чтобы остальные горутины
+// могли завершиться досрочно.
+type Scope struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	err      error // Первая ошибка горутины.
+	panicked bool
+	panicVal any // Значение первой паники.
+}
+
+// Функция RunScope выполняет body в новой области с контекстом, производным от ctx,
+// и ждет завершения всех горутин области. Возвращает первую ошибку горутин.
+// Если горутина или сам body запаниковали, паника после ожидания повторяется
+// в вызывающей горутине, а не завершает программу из чужой горутины.
+func RunScope(ctx context.Context, body func(s *Scope)) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Scope{ctx: ctx, cancel: cancel}
+	defer func() {
+		if r := recover(); r != nil {
+			s.fail(nil, true, r)
+		}
+		s.wg.Wait()
+		cancel()
+		if s.panicked {
+			panic(s.panicVal)
+		}
+		err = s.err
+	}()
+	body(s)
+	return nil
+}
+
+// Метод Context возвращает контекст области. Он отменяется при первой ошибке или панике.
+func (s *Scope) Context() context.Context {
+	return s.ctx
+}
+
+// Метод Go запускает fn в новой горутине области.
+func (s *Scope) Go(fn func(ctx context.Context) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				s.fail(nil, true, r)
+			}
+		}()
+		if err := fn(s.ctx); err != nil {
+			s.fail(err, false, nil)
+		}
+	}()
+}
+
+// Метод fail запоминает первую ошибку и первую панику и отменяет контекст области.
+func (s *Scope) fail(err error, panicked bool, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	if panicked && !s.panicked {
+		s.panicked, s.panicVal = true, value
+	}
+	s.cancel()
+}
+
+// Функция ParallelFor делит [0, n) на полуинтервалы [lo, hi) по grain индексов (последний
+// может быть короче) и выполняет fn для каждого в пуле из numGoroutines горутин. Номер
+// полуинтервала равен lo/grain, по нему fn может записывать результат своей части.
+// Если ctx отменен, еще не начатые полуинтервалы пропускаются и возвращается ошибка контекста.
+// При numGoroutines <= 1 полуинтервалы выполняются по очереди в вызывающей горутине без пула.
+func ParallelFor(ctx context.Context, n, grain, numGoroutines int, fn func(lo, hi int)) error {
+	grain = max(grain, 1)
+	if numGoroutines <= 1 {
+		for lo := 0; lo < n; lo += grain {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			fn(lo, min(lo+grain, n))
+		}
+		return nil
+	}
+
+	pool := NewPool(numGoroutines)
+	defer pool.Close()
+
+	futures := make([]*Future[struct{}], 0, tiles(n, grain))
+	for lo := 0; lo < n; lo += grain {
+		hi := min(lo+grain, n)
+		futures = append(futures, Submit(ctx, pool, func(context.Context) (struct{}, error) {
+			fn(lo, hi)
+			return struct{}{}, nil
+		}))
+	}
+	// Задачи возвращают ошибку только при отмене контекста.
+	if _, err := WhenAll(futures...).Wait(context.Background()); err != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Функция tiles возвращает количество полуинтервалов ParallelFor для n индексов по grain.
+func tiles(n, grain int) int {
+	grain = max(grain, 1)
+	return (n + grain - 1) / grain
+}
+
+// Количество работников в одном блоке генерации. Каждый блок генерируется собственным
+// генератором случайных чисел с зерном seed + номер блока, поэтому результат
+// не зависит от количества горутин и порядка выполнения блоков.
+const generateShardSize = 10000
+
+// Структура Counter представляет счетчик событий без общей точки конкуренции:
+// у каждой горутины свой слот, дополненный до строки кэша, а значение счетчика —
+// сумма слотов при чтении.
+type Counter struct {
+	slots []counterSlot
+}
+
+// Структура counterSlot представляет слот счетчика, занимающий отдельную строку кэша.
+type counterSlot struct {
+	n atomic.Int64
+	_ [56]byte
+}
+
+// Функция NewCounter создает счетчик на slots слотов.
+func NewCounter(slots int) *Counter {
+	return &Counter{slots: make([]counterSlot, slots)}
+}
+
+// Метод Add добавляет delta в слот slot.
+func (c *Counter) Add(slot int, delta int64) {
+	c.slots[slot%len(c.slots)].n.Add(delta)
+}
+
+// Метод Load возвращает сумму всех слотов.
+func (c *Counter) Load() int64 {
+	var total int64
+	for i := range c.slots {
+		total += c.slots[i].n.Load()
+	}
+	return total
+}
+
+// Функция generateWorkers генерирует n работников пулом из numGoroutines горутин,
+// выводя прогресс в stderr. Возраст работников задается на дату asOf. При отмене ctx генерация
+// прекращается и возвращается ошибка контекста.
+func generateWorkers(ctx context.Context, n int, seed int64, numGoroutines int, asOf time.Time) ([]Worker, error) {
+	workers := make([]Worker, n)
+	// Количество сгенерированных работников: блоки пишут в свои слоты без общей конкуренции.
+	generated := NewCounter(numGoroutines)
+
+	// Горутина вывода прогресса.
+	progressDone := make(chan struct{})
+	progressStopped := make(chan struct{})
+	go func() {
+		defer close(progressStopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progressDone:
+				printProgress(generated.Load(), n, true)
+				return
+			case <-ticker.C:
+				printProgress(generated.Load(), n, false)
+			}
+		}
+	}()
+
+	pool := NewPool(numGoroutines)
+	for start := 0; start < n; start += generateShardSize {
+		if ctx.Err() != nil {
+			break
+		}
+		end := start + generateShardSize
+		if end > n {
+			end = n
+		}
+		shard := start / generateShardSize
+		pool.Go(func() {
+			// Блок, который еще не начался, при отмене пропускается.
+			if ctx.Err() != nil {
+				return
+			}
+			rng := rand.New(rand.NewSource(seed + int64(shard)))
+			for i := start; i < end; i++ {
+				workers[i] = generateWorker(rng, i, asOf)
+			}
+			generated.Add(shard, int64(end-start))
+		})
+	}
+	pool.Close()
+	close(progressDone)
+	<-progressStopped
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return workers, nil
+}
+
+// Функция printProgress выводит полосу прогресса генерации в stderr; после последнего
+// вывода (final) строка завершается. В режиме -ci полоса не выводится, чтобы не засорять журнал.
+func printProgress(done int64, total int, final bool) {
+	if ciMode {
+		return
+	}
+	const width = 30
+	percent := 100.0
+	if total > 0 {
+		percent = float64(done) * 100 / float64(total)
+	}
+	filled := int(percent / 100 * width)
+	fmt.Fprintf(os.Stderr, "\rГенерация: [%s%s] %5.1f%%", strings.Repeat("#", filled), strings.Repeat(" ", width-filled), percent)
+	if final {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// Режим автоматической проверки (флаг -ci): без полосы прогресса и интерактивного режима.
+var ciMode bool
+
+// Каталог с сохраненными наборами данных и файл манифеста в нем.
+const (
+	dataDir      = "data"
+	manifestFile = "manifest.json"
+)
+
+// Структура datasetEntry описывает сохраненный набор данных в манифесте.
+type datasetEntry struct {
+	Name    string    `json:"name"`
+	File    string    `json:"file"`
+	Size    int       `json:"size"`
+	Seed    int64     `json:"seed"`
+	SHA256  string    `json:"sha256"`
+	Bytes   int64     `json:"bytes"`
+	Shards  []string  `json:"shards"` // SHA-256 блоков файла размером checksumShardSize.
+	Created time.Time `json:"created"`
+}
+
+// Функция readManifest читает манифест наборов данных. Отсутствующий манифест считается пустым.
+func readManifest() ([]datasetEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []datasetEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("чтение манифеста: %w", err)
+	}
+	return entries, nil
+}
+
+// Функция writeManifest записывает манифест наборов данных.
+func writeManifest(entries []datasetEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, manifestFile), append(data, '\n'), 0o644)
+}
+
+// Функция findDataset ищет набор данных в манифесте по имени.
+func findDataset(name string) (datasetEntry, error) {
+	entries, err := readManifest()
+	if err != nil {
+		return datasetEntry{}, err
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry, nil
+		}
+	}
+	return datasetEntry{}, fmt.Errorf("набор данных %q не найден в %s", name, filepath.Join(dataDir, manifestFile))
+}
+
+// Функция isGzip сообщает, что файл набора данных сжат gzip: это определяется по расширению .gz.
+func isGzip(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
+
+// Функция gunzipStream распаковывает gzip-поток src в отдельной горутине и возвращает
+// распакованные данные через канал io.Pipe, чтобы распаковка шла одновременно с разбором.
+// Заголовок gzip читается сразу, поэтому не-gzip файл дает ошибку здесь. Закрытие
+// возвращенного потока до конца данных останавливает горутину распаковки.
+func gunzipStream(src io.Reader) (io.ReadCloser, error) {
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	r, w := io.Pipe()
+	go func() {
+		_, err := io.Copy(w, gz)
+		w.CloseWithError(err) // При err == nil читатель получит io.EOF.
+	}()
+	return r, nil
+}
+
+// Двоичный формат набора данных (.wbin) для быстрой загрузки без разбора текста. Файл
+// начинается с сигнатуры binaryMagic, затем идут блоки по binaryShardRecords записей,
+// оглавление блоков (смещение uint64 и число записей uint32 каждого) и хвост из числа
+// блоков (uint32) и той же сигнатуры. Запись: имя и должность (длина uvarint и байты),
+// даты рождения и приема (дни от 1970-01-01, varint) и зарплата (float64). Целые
+// фиксированной длины записываются в порядке little-endian.
+const (
+	binaryMagic        = "LAB4WBIN"
+	binaryShardRecords = 65536
+	binaryIndexEntry   = 12    // Смещение и число записей блока.
+	binaryTrailer      = 4 + 8 // Число блоков и сигнатура.
+	binaryMinRecord    = 4 + 8 // Длины строк и даты по байту и зарплата.
+)
+
+// Функция isBinary сообщает, что файл набора данных записан в двоичном формате (.wbin).
+func isBinary(path string) bool {
+	return strings.HasSuffix(path, ".wbin")
+}
+
+// Функция unixDays возвращает номер дня даты t от 1970-01-01.
+func unixDays(t time.Time) int64 {
+	days := t.Unix() / 86400
+	if t.Unix()%86400 < 0 {
+		days-- // Деление с округлением вниз для дат до 1970 года.
+	}
+	return days
+}
+
+// Функция appendBinaryWorker дописывает к b запись работника в двоичном формате.
+func appendBinaryWorker(b []byte, worker Worker) []byte {
+	b = binary.AppendUvarint(b, uint64(len(worker.Name)))
+	b = append(b, worker.Name...)
+	b = binary.AppendUvarint(b, uint64(len(worker.Position)))
+	b = append(b, worker.Position...)
+	b = binary.AppendVarint(b, unixDays(worker.BirthDate))
+	b = binary.AppendVarint(b, unixDays(worker.HireDate))
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(worker.Salary))
+}
+
+// Функция writeBinaryDataset сохраняет работников в двоичном формате и возвращает SHA-256 файла.
+func writeBinaryDataset(path string, workers []Worker) (string, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(file, hash))
+	offset := int64(len(binaryMagic))
+	if _, err := w.WriteString(binaryMagic); err != nil {
+		return "", err
+	}
+	var index, record []byte
+	shards := 0
+	for lo := 0; lo < len(workers); lo += binaryShardRecords {
+		hi := min(lo+binaryShardRecords, len(workers))
+		index = binary.LittleEndian.AppendUint64(index, uint64(offset))
+		index = binary.LittleEndian.AppendUint32(index, uint32(hi-lo))
+		shards++
+		for _, worker := range workers[lo:hi] {
+			record = appendBinaryWorker(record[:0], worker)
+			n, err := w.Write(record)
+			if err != nil {
+				return "", err
+			}
+			offset += int64(n)
+		}
+	}
+	index = binary.LittleEndian.AppendUint32(index, uint32(shards))
+	index = append(index, binaryMagic...)
+	if _, err := w.Write(index); err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Функция decodeBinaryShard разбирает из data первые len(workers) записей блока.
+func decodeBinaryShard(data []byte, workers []Worker) error {
+	str := func() (string, bool) {
+		n, k := binary.Uvarint(data)
+		if k <= 0 || uint64(len(data)-k) < n {
+			return "", false
+		}
+		value := string(data[k : k+int(n)])
+		data = data[k+int(n):]
+		return value, true
+	}
+	date := func() (time.Time, bool) {
+		days, k := binary.Varint(data)
+		if k <= 0 {
+			return time.Time{}, false
+		}
+		data = data[k:]
+		return time.Unix(days*86400, 0).UTC(), true
+	}
+	for i := range workers {
+		var ok [4]bool
+		worker := &workers[i]
+		worker.Name, ok[0] = str()
+		worker.Position, ok[1] = str()
+		worker.BirthDate, ok[2] = date()
+		worker.HireDate, ok[3] = date()
+		if ok != [4]bool{true, true, true, true} || len(data) < 8 {
+			return fmt.Errorf("запись %d блока повреждена", i)
+		}
+		worker.Salary = math.Float64frombits(binary.LittleEndian.Uint64(data))
+		data = data[8:]
+	}
+	return nil
+}
+
+// Функция readBinaryDataset читает не больше limit работников (0 — всех) из двоичного файла.
+// Блоки читаются через ReadAt и разбираются параллельно в GOMAXPROCS горутинах, каждый —
+// в свою часть заранее выделенного среза. Файл не отображается в память: syscall.Mmap
+// нет в Windows, а программа собирается и там; чтение блоков через ReadAt тоже не требует
+// общего курсора файла.
+func readBinaryDataset(path string, limit int) ([]Worker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	corrupt := func(what string) error {
+		return fmt.Errorf("%s: не двоичный набор данных или файл поврежден (%s)", path, what)
+	}
+
+	// Сигнатура в начале и хвост с числом блоков в конце.
+	if size < int64(len(binaryMagic)+binaryTrailer) {
+		return nil, corrupt("слишком короткий файл")
+	}
+	head := make([]byte, len(binaryMagic))
+	trailer := make([]byte, binaryTrailer)
+	if _, err := file.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	if _, err := file.ReadAt(trailer, size-binaryTrailer); err != nil {
+		return nil, err
+	}
+	if string(head) != binaryMagic || string(trailer[4:]) != binaryMagic {
+		return nil, corrupt("нет сигнатуры")
+	}
+	shards := int64(binary.LittleEndian.Uint32(trailer))
+	indexStart := size - binaryTrailer - shards*binaryIndexEntry
+	if indexStart < int64(len(binaryMagic)) {
+		return nil, corrupt("оглавление")
+	}
+	index := make([]byte, shards*binaryIndexEntry)
+	if _, err := file.ReadAt(index, indexStart); err != nil {
+		return nil, err
+	}
+
+	// Границы блоков и место каждого блока в результате. Запись занимает не меньше
+	// binaryMinRecord байт, поэтому поврежденное число записей не приведет к выделению
+	// памяти больше размера файла.
+	offsets := make([]int64, shards+1)
+	counts := make([]int, shards)
+	starts := make([]int, shards+1)
+	for i := range counts {
+		entry := index[int64(i)*binaryIndexEntry:]
+		offsets[i] = int64(binary.LittleEndian.Uint64(entry))
+		counts[i] = int(binary.LittleEndian.Uint32(entry[8:]))
+	}
+	offsets[shards] = indexStart
+	for i := range counts {
+		if offsets[i] < int64(len(binaryMagic)) || offsets[i] > offsets[i+1] ||
+			int64(counts[i])*binaryMinRecord > offsets[i+1]-offsets[i] {
+			return nil, corrupt(fmt.Sprintf("блок %d", i))
+		}
+		if limit > 0 {
+			counts[i] = min(counts[i], max(limit-starts[i], 0))
+		}
+		starts[i+1] = starts[i] + counts[i]
+	}
+
+	workers := make([]Worker, starts[shards])
+	errs := make([]error, shards)
+	ParallelFor(context.Background(), int(shards), 1, runtime.GOMAXPROCS(0), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			if counts[i] == 0 {
+				continue
+			}
+			data := make([]byte, offsets[i+1]-offsets[i])
+			if _, err := file.ReadAt(data, offsets[i]); err != nil {
+				errs[i] = err
+				continue
+			}
+			if err := decodeBinaryShard(data, workers[starts[i]:starts[i+1]]); err != nil {
+				errs[i] = fmt.Errorf("блок %d: %w", i, err)
+			}
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return workers, nil
+}
+
+// Функция writeDataset сохраняет работников в CSV-файл и возвращает SHA-256 его содержимого.
+// Если имя файла оканчивается на .gz, файл сжимается gzip, а контрольная сумма считается
+// по сжатому содержимому, как его проверяет verifyDataset; файл .wbin записывается
+// в двоичном формате (writeBinaryDataset).
+// Последний столбец содержит читаемое название должности; при загрузке он не используется.
+func writeDataset(path string, workers []Worker) (string, error) {
+	if isBinary(path) {
+		return writeBinaryDataset(path, workers)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Контрольная сумма считается одновременно с записью.
+	hash := sha256.New()
+	var dst io.Writer = io.MultiWriter(file, hash)
+	var gz *gzip.Writer
+	if isGzip(path) {
+		gz = gzip.NewWriter(dst)
+		dst = gz
+	}
+	buffered := bufio.NewWriter(dst)
+	w := csv.NewWriter(buffered)
+	if err := w.Write([]string{"name", "position", "birth_date", "salary", "position_name", "hire_date"}); err != nil {
+		return "", err
+	}
+	for _, worker := range workers {
+		record := []string{
+			worker.Name,
+			worker.Position,
+			worker.BirthDate.Format(dateLayout),
+			strconv.FormatFloat(worker.Salary, 'f', -1, 64),
+			positionName(worker.Position),
+			worker.HireDate.Format(dateLayout),
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	if err := buffered.Flush(); err != nil {
+		return "", err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return "", err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Функция loadDataset читает работников из CSV-файла, записанного writeDataset. Возраст
+// вычисляется отдельно функцией setAges. В файлах прежнего формата вместо даты рождения
+// записан возраст (столбец age); для них дата рождения считается равной дате asOf минус возраст.
+func loadDataset(path string, asOf time.Time) ([]Worker, error) {
+	return readDataset(path, asOf, 0)
+}
+
+// Количество строк набора данных в одной задаче разбора.
+const parseBatchSize = 4096
+
+// Функция readDataset читает не больше limit работников из CSV-файла (0 — всех).
+// Файл с расширением .gz распаковывается в отдельной горутине (gunzipStream). Строки
+// читаются пачками по parseBatchSize, и каждая пачка разбирается задачей пула,
+// пока читаются следующие; порядок работников совпадает с порядком строк в файле.
+// Файл .wbin читается в двоичном формате (readBinaryDataset).
+func readDataset(path string, asOf time.Time, limit int) ([]Worker, error) {
+	if isBinary(path) {
+		return readBinaryDataset(path, limit)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var src io.Reader = bufio.NewReader(file)
+	if isGzip(path) {
+		stream, err := gunzipStream(src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer stream.Close()
+		src = stream
+	}
+
+	r := csv.NewReader(src)
+	// Пропускаем заголовок. Файлы без столбца position_name тоже поддерживаются:
+	// количество столбцов в остальных строках должно совпадать с заголовком.
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(header) < 4 {
+		return nil, fmt.Errorf("%s: ожидалось не меньше 4 столбцов, получено %d", path, len(header))
+	}
+
+	legacyAge := header[2] == "age"
+	hasHireDate := len(header) > 5 && header[5] == "hire_date"
+
+	ctx := context.Background()
+	pool := NewPool(runtime.GOMAXPROCS(0))
+	defer pool.Close()
+	var futures []*Future[[]Worker]
+	for read := 0; limit <= 0 || read < limit; {
+		size := parseBatchSize
+		if limit > 0 {
+			size = min(size, limit-read)
+		}
+		batch := make([][]string, 0, size)
+		for len(batch) < size {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			batch = append(batch, record)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		read += len(batch)
+		futures = append(futures, Submit(ctx, pool, func(context.Context) ([]Worker, error) {
+			return parseRecords(batch, asOf, legacyAge, hasHireDate)
+		}))
+		if len(batch) < size {
+			break
+		}
+	}
+
+	var workers []Worker
+	for _, f := range futures {
+		batch, err := f.Wait(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		workers = append(workers, batch...)
+	}
+	return workers, nil
+}
+
+// Функция parseRecords разбирает строки набора данных в работников. В файлах прежнего
+// формата (legacyAge) вместо даты рождения записан возраст на дату asOf.
+func parseRecords(records [][]string, asOf time.Time, legacyAge, hasHireDate bool) ([]Worker, error) {
+	workers := make([]Worker, 0, len(records))
+	for _, record := range records {
+		var birthDate time.Time
+		var err error
+		if legacyAge {
+			age, err := strconv.Atoi(record[2])
+			if err != nil {
+				return nil, fmt.Errorf("возраст: %w", err)
+			}
+			birthDate = asOf.AddDate(-age, 0, 0)
+		} else if birthDate, err = time.Parse(dateLayout, record[2]); err != nil {
+			return nil, fmt.Errorf("дата рождения: %w", err)
+		}
+		salary, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("зарплата: %w", err)
+		}
+		worker := Worker{Name: record[0], Position: record[1], BirthDate: birthDate, Salary: salary}
+		if hasHireDate {
+			if worker.HireDate, err = time.Parse(dateLayout, record[5]); err != nil {
+				return nil, fmt.Errorf("дата приема: %w", err)
+			}
+		}
+		workers = append(workers, worker)
+	}
+	return workers, nil
+}
+
+// Тип SalaryPolicy задает обработку некорректных зарплат (NaN и отрицательных значений),
+// которые могут встретиться в загруженных данных. Политика применяется к набору данных
+// один раз перед анализом, поэтому все агрегаты видят одинаковые записи.
+type SalaryPolicy string
+
+const (
+	// SalarySkip исключает записи с некорректной зарплатой из анализа.
+	SalarySkip SalaryPolicy = "skip"
+	// SalaryError прерывает работу на первой записи с некорректной зарплатой.
+	SalaryError SalaryPolicy = "error"
+	// SalaryClamp заменяет некорректную зарплату нулем.
+	SalaryClamp SalaryPolicy = "clamp"
+)
+
+// Функция parseSalaryPolicy разбирает название политики.
+func parseSalaryPolicy(s string) (SalaryPolicy, error) {
+	switch policy := SalaryPolicy(s); policy {
+	case SalarySkip, SalaryError, SalaryClamp:
+		return policy, nil
+	}
+	return "", fmt.Errorf("неизвестная политика зарплат %q (ожидается skip, error или clamp)", s)
+}
+
+// Структура salaryPolicyReport содержит количество записей, затронутых политикой.
+type salaryPolicyReport struct {
+	Policy   SalaryPolicy
+	NaN      int
+	Negative int
+}
+
+// Функция applySalaryPolicy проверяет зарплаты работников и применяет к некорректным политику.
+// Исходный срез не изменяется: если некорректных записей нет, он возвращается как есть,
+// иначе возвращается исправленная копия.
+func applySalaryPolicy(workers []Worker, policy SalaryPolicy) ([]Worker, salaryPolicyReport, error) {
+	report := salaryPolicyReport{Policy: policy}
+	var result []Worker
+
+	for i, worker := range workers {
+		isNaN := math.IsNaN(worker.Salary)
+		if !isNaN && worker.Salary >= 0 {
+			if result != nil {
+				result = append(result, worker)
+			}
+			continue
+		}
+
+		if isNaN {
+			report.NaN++
+		} else {
+			report.Negative++
+		}
+		if policy == SalaryError {
+			return nil, report, fmt.Errorf("запись %d (%s): некорректная зарплата %v", i, worker.Name, worker.Salary)
+		}
+
+		// Первая некорректная запись: копируем предшествующие ей корректные.
+		if result == nil {
+			result = make([]Worker, i, len(workers))
+			copy(result, workers[:i])
+		}
+		if policy == SalaryClamp {
+			worker.Salary = 0
+			result = append(result, worker)
+		}
+	}
+
+	if result == nil {
+		return workers, report, nil
+	}
+	return result, report, nil
+}
+
+// Размер блока файла набора данных, для которого считается отдельная контрольная сумма.
+// Блоки хешируются параллельно, поэтому проверка больших файлов не упирается в одно ядро.
+const checksumShardSize = 4 << 20
+
+// Функция shardChecksums вычисляет SHA-256 каждого блока файла в numGoroutines горутинах.
+// Возвращает размер файла и контрольные суммы блоков по порядку.
+func shardChecksums(path string, numGoroutines int) (int64, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	size := info.Size()
+
+	shards := int((size + checksumShardSize - 1) / checksumShardSize)
+	tasks := make([]func(ctx context.Context) (string, error), shards)
+	for i := range tasks {
+		tasks[i] = func(context.Context) (string, error) {
+			// Каждый блок читается независимо через ReadAt.
+			section := io.NewSectionReader(file, int64(i)*checksumShardSize, checksumShardSize)
+			hash := sha256.New()
+			if _, err := io.Copy(hash, section); err != nil {
+				return "", err
+			}
+			return hex.EncodeToString(hash.Sum(nil)), nil
+		}
+	}
+	ctx := context.Background()
+	pool := NewPool(numGoroutines)
+	sums, err := WhenAll(SubmitBatch(ctx, pool, tasks)...).Wait(ctx)
+	pool.Close()
+	if err != nil {
+		return 0, nil, err
+	}
+	return size, sums, nil
+}
+
+// Функция verifyDataset сверяет файл набора данных с контрольными суммами из манифеста.
+// Усеченный или измененный файл обнаруживается по размеру, поврежденный — по блоку,
+// контрольная сумма которого не совпала.
+func verifyDataset(entry datasetEntry) error {
+	if len(entry.Shards) == 0 {
+		return fmt.Errorf("набор данных %s: в манифесте нет контрольных сумм блоков, пересоздайте его", entry.Name)
+	}
+	size, sums, err := shardChecksums(filepath.Join(dataDir, entry.File), runtime.GOMAXPROCS(0))
+	if err != nil {
+		return err
+	}
+	if size != entry.Bytes {
+		return fmt.Errorf("набор данных %s: размер файла %d байт, ожидалось %d (файл усечен или изменен)", entry.Name, size, entry.Bytes)
+	}
+	for i := range sums {
+		if sums[i] != entry.Shards[i] {
+			start := int64(i) * checksumShardSize
+			end := start + checksumShardSize
+			if end > size {
+				end = size
+			}
+			return fmt.Errorf("набор данных %s: поврежден блок %d (байты %d–%d)", entry.Name, i, start, end)
+		}
+	}
+	return nil
+}
+
+// Структура workerChange описывает работника, который есть в обоих наборах данных,
+// но изменился: Before — запись из первого набора, After — из второго.
+type workerChange struct {
+	Before Worker
+	After  Worker
+}
+
+// Структура datasetDiff представляет различия двух наборов данных. Работники
+// сопоставляются по имени; списки упорядочены по имени.
+type datasetDiff struct {
+	Added    []Worker       // Есть только во втором наборе (приняты).
+	Removed  []Worker       // Есть только в первом наборе (уволены).
+	Salary   []workerChange // Изменилась зарплата.
+	Position []workerChange // Изменилась должность.
+}
+
+// Функция diffWorkers сравнивает наборы before и after параллельным хеш-соединением по имени.
+// Оба набора делятся на parts частей по хешу имени (hashSplit), после чего каждая горутина
+// строит хеш-таблицу по своей части первого набора и проверяет по ней свою часть второго.
+// Если имя в наборе повторяется, учитывается последняя запись.
+func diffWorkers(before, after []Worker, parts int) datasetDiff {
+	parts = max(parts, 1)
+	name := func(w Worker) string { return w.Name }
+	beforeParts := hashSplit(before, parts, name)
+	afterParts := hashSplit(after, parts, name)
+
+	diffs := make([]datasetDiff, parts)
+	RunScope(context.Background(), func(s *Scope) {
+		for p := 0; p < parts; p++ {
+			s.Go(func(context.Context) error {
+				table := make(map[string]Worker)
+				for i := range beforeParts {
+					for _, worker := range beforeParts[i][p] {
+						table[worker.Name] = worker
+					}
+				}
+				d := &diffs[p]
+				for i := range afterParts {
+					for _, worker := range afterParts[i][p] {
+						old, ok := table[worker.Name]
+						if !ok {
+							d.Added = append(d.Added, worker)
+							continue
+						}
+						delete(table, worker.Name)
+						if old.Salary != worker.Salary {
+							d.Salary = append(d.Salary, workerChange{Before: old, After: worker})
+						}
+						if old.Position != worker.Position {
+							d.Position = append(d.Position, workerChange{Before: old, After: worker})
+						}
+					}
+				}
+				// Оставшиеся в таблице работники во втором наборе не встретились.
+				for _, worker := range table {
+					d.Removed = append(d.Removed, worker)
+				}
+				return nil
+			})
+		}
+	})
+
+	// Объединяем результаты частей и упорядочиваем их по имени.
+	var diff datasetDiff
+	for _, d := range diffs {
+		diff.Added = append(diff.Added, d.Added...)
+		diff.Removed = append(diff.Removed, d.Removed...)
+		diff.Salary = append(diff.Salary, d.Salary...)
+		diff.Position = append(diff.Position, d.Position...)
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Name < diff.Added[j].Name })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Name < diff.Removed[j].Name })
+	sort.Slice(diff.Salary, func(i, j int) bool { return diff.Salary[i].After.Name < diff.Salary[j].After.Name })
+	sort.Slice(diff.Position, func(i, j int) bool { return diff.Position[i].After.Name < diff.Position[j].After.Name })
+	return diff
+}
+
+// Функция printDatasetDiff выводит количество принятых, уволенных и изменившихся работников
+// и не больше examples примеров каждого вида.
+func printDatasetDiff(before, after string, diff datasetDiff, examples int) {
+	raises := 0
+	for _, change := range diff.Salary {
+		if change.After.Salary > change.Before.Salary {
+			raises++
+		}
+	}
+	fmt.Printf("Сравнение наборов данных %s → %s:\n", before, after)
+	fmt.Printf("Принято: %d\n", len(diff.Added))
+	for _, worker := range diff.Added[:min(examples, len(diff.Added))] {
+		fmt.Printf("  + %s, %s, %.2f\n", worker.Name, positionName(worker.Position), worker.Salary)
+	}
+	fmt.Printf("Уволено: %d\n", len(diff.Removed))
+	for _, worker := range diff.Removed[:min(examples, len(diff.Removed))] {
+		fmt.Printf("  - %s, %s, %.2f\n", worker.Name, positionName(worker.Position), worker.Salary)
+	}
+	fmt.Printf("Изменена зарплата: %d (повышений %d, понижений %d)\n", len(diff.Salary), raises, len(diff.Salary)-raises)
+	for _, change := range diff.Salary[:min(examples, len(diff.Salary))] {
+		fmt.Printf("  %s: %.2f → %.2f\n", change.After.Name, change.Before.Salary, change.After.Salary)
+	}
+	fmt.Printf("Изменена должность: %d\n", len(diff.Position))
+	for _, change := range diff.Position[:min(examples, len(diff.Position))] {
+		fmt.Printf("  %s: %s → %s\n", change.After.Name, positionName(change.Before.Position), positionName(change.After.Position))
+	}
+}
+
+// Тип NameMode задает, как обезличиваются имена работников.
+type NameMode string
+
+const (
+	NamesKeep  NameMode = "keep"  // Оставить имена как есть.
+	NamesHash  NameMode = "hash"  // HMAC-SHA256 имени с ключом: одно имя — один псевдоним во всех наборах.
+	NamesToken NameMode = "token" // Номер записи в наборе: связь с другими наборами теряется.
+)
+
+// Структура AnonymizeOptions задает обезличивание отдельно для каждого поля.
+type AnonymizeOptions struct {
+	Names       NameMode
+	Key         []byte  // Ключ HMAC для NamesHash.
+	AgeBucket   int     // Ширина группы годов рождения в годах (0 — не менять).
+	SalaryRound float64 // Шаг округления зарплаты (0 — не менять).
+}
+
+// Функция parseAnonymizeOptions проверяет параметры обезличивания.
+func parseAnonymizeOptions(names, key string, ageBucket int, salaryRound float64) (AnonymizeOptions, error) {
+	opts := AnonymizeOptions{Names: NameMode(names), Key: []byte(key), AgeBucket: ageBucket, SalaryRound: salaryRound}
+	switch opts.Names {
+	case NamesKeep, NamesToken:
+	case NamesHash:
+		if key == "" {
+			return opts, errors.New("для -names hash нужен ключ (-key): без него псевдонимы перебираются по словарю имен")
+		}
+	default:
+		return opts, fmt.Errorf("неизвестный способ обезличивания имен %q (ожидается keep, hash или token)", names)
+	}
+	if ageBucket < 0 || salaryRound < 0 {
+		return opts, errors.New("ширина группы годов и шаг округления зарплаты не могут быть отрицательными")
+	}
+	return opts, nil
+}
+
+// Функция anonymizeWorkers возвращает обезличенную копию работников: имена заменяются
+// по opts.Names, дата рождения — 1 января первого года своей группы из AgeBucket лет,
+// зарплата округляется до SalaryRound. Записи обрабатываются в numGoroutines горутинах;
+// результат от их числа не зависит.
+func anonymizeWorkers(workers []Worker, opts AnonymizeOptions, numGoroutines int) []Worker {
+	result := make([]Worker, len(workers))
+	ParallelFor(context.Background(), len(workers), generateShardSize, numGoroutines, func(lo, hi int) {
+		mac := hmac.New(sha256.New, opts.Key)
+		for i := lo; i < hi; i++ {
+			worker := workers[i]
+			switch opts.Names {
+			case NamesHash:
+				mac.Reset()
+				mac.Write([]byte(worker.Name))
+				worker.Name = hex.EncodeToString(mac.Sum(nil))[:16]
+			case NamesToken:
+				worker.Name = fmt.Sprintf("Сотрудник %d", i)
+			}
+			if opts.AgeBucket > 0 {
+				year := worker.BirthDate.Year()
+				year -= ((year % opts.AgeBucket) + opts.AgeBucket) % opts.AgeBucket
+				worker.BirthDate = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+			}
+			if opts.SalaryRound > 0 {
+				worker.Salary = math.Round(worker.Salary/opts.SalaryRound) * opts.SalaryRound
+			}
+			result[i] = worker
+		}
+	})
+	return result
+}
+
+// Функция saveDataset записывает работников в файл entry.File каталога наборов данных,
+// вычисляет контрольные суммы файла и его блоков и добавляет набор в манифест, заменяя
+// одноименный. Возвращает запись манифеста с заполненными контрольными суммами.
+func saveDataset(entry datasetEntry, workers []Worker) (datasetEntry, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return entry, err
+	}
+	path := filepath.Join(dataDir, entry.File)
+	var err error
+	if entry.SHA256, err = writeDataset(path, workers); err != nil {
+		return entry, err
+	}
+	if entry.Bytes, entry.Shards, err = shardChecksums(path, runtime.GOMAXPROCS(0)); err != nil {
+		return entry, err
+	}
+
+	entries, err := readManifest()
+	if err != nil {
+		return entry, err
+	}
+	replaced := false
+	for i := range entries {
+		if entries[i].Name == entry.Name {
+			entries[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		entries = append(entries, entry)
+	}
+	return entry, writeManifest(entries)
+}
+
+// Функция runDatasetCommand выполняет подкоманду dataset:
+//
+//	dataset make -name NAME [-n N] [-seed S] [-gzip]  генерирует набор данных и добавляет его в манифест
+//	dataset list                                      выводит наборы данных из манифеста
+//	dataset verify -name NAME                         проверяет целостность файла набора данных
+//	dataset sort -name NAME -o FILE [-by K]           сортирует работников набора данных в файл
+//	dataset diff -a NAME -b NAME                      сравнивает два набора данных
+//	dataset anonymize -name NAME -o FILE              записывает обезличенную копию набора данных
+//	dataset convert -name NAME -format F              переводит набор данных в формат csv, csv.gz или wbin
+func runDatasetCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("использование: dataset make|list|verify|sort|diff|anonymize|convert")
+	}
+
+	switch args[0] {
+	case "make":
+		fs := flag.NewFlagSet("dataset make", flag.ExitOnError)
+		name := fs.String("name", "", "имя набора данных")
+		n := fs.Int("n", 100000, "количество работников")
+		seed := fs.Int64("seed", 1, "зерно генератора случайных чисел")
+		compress := fs.Bool("gzip", false, "сжать файл набора данных gzip (data/<имя>.csv.gz)")
+		fs.Parse(args[1:])
+		if *name == "" {
+			return errors.New("dataset make: не задано имя (-name)")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		workers, err := generateWorkers(ctx, *n, *seed, runtime.GOMAXPROCS(0), today())
+		if err != nil {
+			return err
+		}
+
+		entry := datasetEntry{Name: *name, File: *name + ".csv", Size: *n, Seed: *seed, Created: time.Now().UTC()}
+		if *compress {
+			entry.File += ".gz"
+		}
+		if entry, err = saveDataset(entry, workers); err != nil {
+			return err
+		}
+		fmt.Printf("Набор данных %s: %d работников, зерно %d, sha256 %s\n", entry.Name, entry.Size, entry.Seed, entry.SHA256)
+		return nil
+
+	case "list":
+		entries, err := readManifest()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Имя\tРазмер\tЗерно\tSHA-256\tСоздан")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.12s…\t%s\n", entry.Name, entry.Size, entry.Seed, entry.SHA256, entry.Created.Format(time.RFC3339))
+		}
+		return w.Flush()
+
+	case "verify":
+		fs := flag.NewFlagSet("dataset verify", flag.ExitOnError)
+		name := fs.String("name", "", "имя набора данных")
+		fs.Parse(args[1:])
+		entry, err := findDataset(*name)
+		if err != nil {
+			return err
+		}
+		if err := verifyDataset(entry); err != nil {
+			return err
+		}
+		fmt.Printf("Набор данных %s: файл цел, проверено блоков: %d\n", entry.Name, len(entry.Shards))
+		return nil
+
+	case "sort":
+		fs := flag.NewFlagSet("dataset sort", flag.ExitOnError)
+		name := fs.String("name", "", "имя набора данных")
+		by := fs.String("by", "salary", "ключ сортировки: salary или age")
+		out := fs.String("o", "", "файл для отсортированных работников (CSV)")
+		maxMemory := fs.Int64("max-memory", 0, "бюджет памяти сортировки в КиБ (0 — сортировка в памяти)")
+		fs.Parse(args[1:])
+		if *out == "" {
+			return errors.New("dataset sort: не задан выходной файл (-o)")
+		}
+		keys := map[string]func(Worker) float64{
+			"salary": func(w Worker) float64 { return w.Salary },
+			"age":    func(w Worker) float64 { return float64(w.Age) },
+		}
+		key, ok := keys[*by]
+		if !ok {
+			return fmt.Errorf("dataset sort: неизвестный ключ %q", *by)
+		}
+		entry, err := findDataset(*name)
+		if err != nil {
+			return err
+		}
+		workers, err := loadDataset(filepath.Join(dataDir, entry.File), today())
+		if err != nil {
+			return err
+		}
+		workers, _ = setAges(workers, today())
+
+		memoryBudget = *maxMemory * 1024
+		start := time.Now()
+		sorted, runs, err := sortWorkers(workers, key)
+		if err != nil {
+			return err
+		}
+		if _, err := writeDataset(*out, sorted); err != nil {
+			return err
+		}
+		fmt.Printf("Набор данных %s отсортирован по %s за %v (серий на диске: %d): %s\n",
+			entry.Name, *by, time.Since(start), runs, *out)
+		return nil
+
+	case "diff":
+		fs := flag.NewFlagSet("dataset diff", flag.ExitOnError)
+		nameA := fs.String("a", "", "имя первого (прежнего) набора данных")
+		nameB := fs.String("b", "", "имя второго (нового) набора данных")
+		examples := fs.Int("examples", 5, "количество примеров каждого вида изменений")
+		fs.Parse(args[1:])
+		if *nameA == "" || *nameB == "" {
+			return errors.New("dataset diff: не заданы наборы данных (-a и -b)")
+		}
+		sides := make([][]Worker, 2)
+		for i, name := range []string{*nameA, *nameB} {
+			entry, err := findDataset(name)
+			if err != nil {
+				return err
+			}
+			if sides[i], err = loadDataset(filepath.Join(dataDir, entry.File), today()); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		diff := diffWorkers(sides[0], sides[1], runtime.GOMAXPROCS(0))
+		printDatasetDiff(*nameA, *nameB, diff, *examples)
+		fmt.Printf("Время сравнения: %v\n", time.Since(start))
+		return nil
+
+	case "anonymize":
+		fs := flag.NewFlagSet("dataset anonymize", flag.ExitOnError)
+		name := fs.String("name", "", "имя набора данных")
+		out := fs.String("o", "", "файл для обезличенных работников (CSV)")
+		names := fs.String("names", string(NamesToken), "имена: keep, hash (HMAC-SHA256 с ключом -key) или token (номер записи)")
+		key := fs.String("key", "", "ключ HMAC для -names hash")
+		ageBucket := fs.Int("age-bucket", 5, "ширина группы годов рождения в годах (0 — не менять)")
+		salaryRound := fs.Float64("salary-round", 1000, "шаг округления зарплаты (0 — не менять)")
+		fs.Parse(args[1:])
+		if *out == "" {
+			return errors.New("dataset anonymize: не задан выходной файл (-o)")
+		}
+		opts, err := parseAnonymizeOptions(*names, *key, *ageBucket, *salaryRound)
+		if err != nil {
+			return fmt.Errorf("dataset anonymize: %w", err)
+		}
+		entry, err := findDataset(*name)
+		if err != nil {
+			return err
+		}
+		workers, err := loadDataset(filepath.Join(dataDir, entry.File), today())
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		anonymized := anonymizeWorkers(workers, opts, runtime.GOMAXPROCS(0))
+		sum, err := writeDataset(*out, anonymized)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Набор данных %s обезличен за %v (имена: %s, группы годов: %d, округление зарплаты: %v): %s, sha256 %s\n",
+			entry.Name, time.Since(start), opts.Names, opts.AgeBucket, opts.SalaryRound, *out, sum)
+		return nil
+
+	case "convert":
+		fs := flag.NewFlagSet("dataset convert", flag.ExitOnError)
+		name := fs.String("name", "", "имя набора данных")
+		format := fs.String("format", "wbin", "формат файла: csv, csv.gz или wbin (двоичный)")
+		as := fs.String("as", "", "имя нового набора данных (по умолчанию заменяется исходный)")
+		fs.Parse(args[1:])
+		switch *format {
+		case "csv", "csv.gz", "wbin":
+		default:
+			return fmt.Errorf("dataset convert: неизвестный формат %q (ожидается csv, csv.gz или wbin)", *format)
+		}
+		entry, err := findDataset(*name)
+		if err != nil {
+			return err
+		}
+		oldPath := filepath.Join(dataDir, entry.File)
+		start := time.Now()
+		workers, err := loadDataset(oldPath, today())
+		if err != nil {
+			return err
+		}
+		loaded := time.Since(start)
+
+		if *as != "" {
+			entry.Name = *as
+		}
+		entry.File = entry.Name + "." + *format
+		if entry, err = saveDataset(entry, workers); err != nil {
+			return err
+		}
+		// Исходный файл удаляется, только если набор заменен и файл теперь другой.
+		if newPath := filepath.Join(dataDir, entry.File); *as == "" && newPath != oldPath {
+			if err := os.Remove(oldPath); err != nil {
+				return err
+			}
+		}
+
+		start = time.Now()
+		if _, err := loadDataset(filepath.Join(dataDir, entry.File), today()); err != nil {
+			return err
+		}
+		fmt.Printf("Набор данных %s: %s, %d байт, sha256 %s\n", entry.Name, entry.File, entry.Bytes, entry.SHA256)
+		fmt.Printf("Загрузка: %v в прежнем формате, %v в новом\n", loaded, time.Since(start))
+		return nil
+	}
+	return fmt.Errorf("dataset: неизвестная команда %q", args[0])
+}
+
+// Количество строк набора данных, которые читает и проверяет пробный запуск.
+const dryRunSample = 1000
+
+// Функция estimateMemory оценивает память, которую займут rows работников, по размеру
+// структуры Worker и средней длине строк в образце sample.
+func estimateMemory(rows int, sample []Worker) int64 {
+	perWorker := int64(unsafe.Sizeof(Worker{}))
+	if len(sample) > 0 {
+		var strs int64
+		for _, worker := range sample {
+			strs += int64(len(worker.Name) + len(worker.Position))
+		}
+		perWorker += strs / int64(len(sample))
+	}
+	return int64(rows) * perWorker
+}
+
+// Функция runDryRun выполняет пробный запуск (флаг -dry-run): проверяет набор данных по
+// заголовку и первым dryRunSample строкам, выводит план запроса и оценку памяти, но сами
+// данные не загружает и не анализирует. Если набор данных не задан, образец генерируется.
+func runDryRun(dataset string, numWorkers int, position string, policy SalaryPolicy, asOf time.Time, index bool) error {
+	fmt.Printf("Пробный запуск: данные не загружаются и не анализируются.\n")
+	fmt.Printf("Должность: %s\n", positionName(position))
+	fmt.Printf("Дата запроса: %s\n", asOf.Format(dateLayout))
+	fmt.Printf("Политика зарплат: %s\n", policy)
+
+	rows := numWorkers
+	var sample []Worker
+	if dataset != "" {
+		entry, err := findDataset(dataset)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dataDir, entry.File)
+		// Полная проверка контрольных сумм читает весь файл, поэтому здесь сверяется только размер.
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Size() != entry.Bytes {
+			return fmt.Errorf("набор данных %s: размер файла %d байт, ожидалось %d (файл усечен или изменен)", entry.Name, info.Size(), entry.Bytes)
+		}
+		if sample, err = readDataset(path, asOf, dryRunSample); err != nil {
+			return err
+		}
+		rows = entry.Size
+		fmt.Printf("Набор данных: %s (%s, %d байт, зерно %d)\n", entry.Name, path, entry.Bytes, entry.Seed)
+	} else {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < min(numWorkers, dryRunSample); i++ {
+			sample = append(sample, generateWorker(rng, i, asOf))
+		}
+		fmt.Printf("Набор данных: генерируется\n")
+	}
+	fmt.Printf("Работников: %d\n", rows)
+
+	// Зарплаты образца проверяются той же политикой, что и при настоящем запуске.
+	_, report, err := applySalaryPolicy(sample, policy)
+	if err != nil {
+		return fmt.Errorf("проверка зарплат образца: %w", err)
+	}
+	_, unborn := setAges(sample, asOf)
+	hireDates := len(sample) > 0 && !sample[0].HireDate.IsZero()
+	fmt.Printf("Проверено строк образца: %d (NaN: %d, отрицательных зарплат: %d, не родились: %d, даты приема: %t)\n\n",
+		len(sample), report.NaN, report.Negative, unborn, hireDates)
+
+	printPlan(planQuery(rows))
+	if index {
+		fmt.Printf("  С флагом -index индекс строится после загрузки, и план уточняется: просматриваются только части с нужной должностью\n")
+	}
+	// Срез, заполняемый при загрузке файла, растет удвоением, поэтому на пике памяти может
+	// понадобиться до двух раз больше.
+	memory := estimateMemory(rows, sample)
+	fmt.Printf("\nОценка памяти данных: %.1f МиБ (%d байт на работника", float64(memory)/(1<<20), memory/int64(max(rows, 1)))
+	if dataset != "" {
+		fmt.Printf(", при загрузке до %.1f МиБ", float64(2*memory)/(1<<20))
+	}
+	fmt.Printf(")\n")
+	return nil
+}
+
+// Структура command описывает подкоманду программы. По реестру commands выполняется
+// разбор первого аргумента, выводится справка и строится автодополнение для оболочки.
+type command struct {
+	Name        string
+	Usage       string
+	Summary     string
+	Subcommands []subcommand
+	Run         func(args []string) error
+}
+
+// Структура subcommand описывает вложенную подкоманду и ее флаги. Флаги перечисляются
+// здесь вручную: при добавлении флага в набор флагов подкоманды его нужно добавить и сюда.
+type subcommand struct {
+	Name  string
+	Flags []string
+}
+
+// Структура helpTopic представляет страницу справки, выводимую командой help <тема>.
+type helpTopic struct {
+	Name    string
+	Summary string
+	Text    string
+}
+
+// Реестр подкоманд. Заполняется в init, так как команды help и completion сами его читают.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			Name:    "dataset",
+			Usage:   "dataset make|list|verify|sort|diff|anonymize|convert [флаги]",
+			Summary: "сохраненные наборы данных",
+			Subcommands: []subcommand{
+				{Name: "make", Flags: []string{"-name", "-n", "-seed", "-gzip"}},
+				{Name: "list"},
+				{Name: "verify", Flags: []string{"-name"}},
+				{Name: "sort", Flags: []string{"-name", "-by", "-o", "-max-memory"}},
+				{Name: "diff", Flags: []string{"-a", "-b", "-examples"}},
+				{Name: "anonymize", Flags: []string{"-name", "-o", "-names", "-key", "-age-bucket", "-salary-round"}},
+				{Name: "convert", Flags: []string{"-name", "-format", "-as"}},
+			},
+			Run: runDatasetCommand,
+		},
+		{
+			Name:        "stats",
+			Usage:       "stats merge [-o файл] файл...",
+			Summary:     "объединение показателей нескольких запусков",
+			Subcommands: []subcommand{{Name: "merge", Flags: []string{"-o"}}},
+			Run:         runStatsCommand,
+		},
+		{
+			Name:    "help",
+			Usage:   "help [тема]",
+			Summary: "справка по командам, флагам и темам",
+			Run:     runHelpCommand,
+		},
+		{
+			Name:        "completion",
+			Usage:       "completion bash|zsh",
+			Summary:     "скрипт автодополнения для оболочки",
+			Subcommands: []subcommand{{Name: "bash"}, {Name: "zsh"}},
+			Run:         runCompletionCommand,
+		},
+	}
+}
+
+// Страницы справки.
+var helpTopics = []helpTopic{
+	{
+		Name:    "strategies",
+		Summary: "стратегии разбиения данных между горутинами",
+		Text: `Каждая стратегия разбиения запускается в отчете отдельно (processWithConcurrency):
+  блоками        непрерывные части почти равного размера, без копирования
+  по кругу       работник i попадает в часть i % parts; выравнивает нагрузку на отсортированных данных
+  по диапазонам  части по диапазонам ключа (возраста), пустые отбрасываются
+  по должности   части по хешу должности; каждая горутина владеет своими должностями
+Планировщик (-explain) использует разбиение блоками.`,
+	},
+	{
+		Name:    "engines",
+		Summary: "способы выполнения запроса и суммирования",
+		Text: `Запрос "средний возраст, затем максимальная зарплата" выполняется одним из способов:
+  analyzeSequential  последовательно в вызывающей горутине, 3 части
+  analyzeParallel    горутина на каждую часть разбиения; части блоками — через ParallelFor
+  analyzeIndexed     пул горутин только по частям индекса с нужной должностью (флаг -index)
+Планировщик выбирает параллельное выполнение, если оценка работы не меньше порога
+и доступно больше одного процессора; выбранный план выводит флаг -explain.
+Суммирование зарплат (-sum-mode):
+  naive  части по числу горутин, обычное сложение
+  kahan  части по числу горутин, компенсированное сложение
+  tree   листья фиксированного размера и фиксированное дерево; результат не зависит от числа горутин`,
+	},
+	{
+		Name:    "env",
+		Summary: "переменные окружения вместо флагов",
+		Text: `Каждый флаг анализа можно задать переменной окружения: для флага -max-memory
+проверяются LAB4_ANALYTICS_MAX_MEMORY, затем общая для всех программ LAB4_MAX_MEMORY.
+Приоритет: флаг командной строки > переменная окружения > значение по умолчанию.
+Флаги подкоманд (dataset, stats) переменными окружения не задаются.`,
+	},
+	{
+		Name:    "formats",
+		Summary: "форматы файлов наборов данных и показателей",
+		Text: `data/<имя>.csv        набор данных: name,position,birth_date,salary,position_name,hire_date
+                      (даты ГГГГ-ММ-ДД; в прежнем формате вместо birth_date столбец age,
+                      столбцы position_name и hire_date необязательны)
+data/<имя>.csv.gz     то же, сжатое gzip (dataset make -gzip); любой файл наборов данных
+                      с расширением .gz читается и записывается со сжатием
+data/<имя>.wbin       двоичный формат для быстрой загрузки: блоки записей с оглавлением
+                      в конце файла, блоки разбираются параллельно (dataset convert)
+data/manifest.json    список наборов данных: размер, зерно, SHA-256 файла и его блоков
+-stats-out файл.json  показатели по должностям: {"runs": N, "positions": {...}};
+                      объединяются командой stats merge`,
+	},
+}
+
+// Функция findCommand ищет подкоманду в реестре по имени.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// Функция mainFlags возвращает имена флагов основной программы с дефисом.
+func mainFlags() []string {
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) { names = append(names, "-"+f.Name) })
+	return names
+}
+
+// Функция runHelpCommand выполняет подкоманду help: без аргументов выводит список команд,
+// тем и флагов, с аргументом — справку по команде или теме.
+func runHelpCommand(args []string) error {
+	if len(args) == 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Команды:")
+		for _, c := range commands {
+			fmt.Fprintf(w, "  %s\t%s\n", c.Usage, c.Summary)
+		}
+		fmt.Fprintln(w, "Темы (help <тема>):")
+		for _, t := range helpTopics {
+			fmt.Fprintf(w, "  %s\t%s\n", t.Name, t.Summary)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Println("Флаги анализа:")
+		flag.CommandLine.SetOutput(os.Stdout)
+		flag.PrintDefaults()
+		return nil
+	}
+
+	for _, t := range helpTopics {
+		if t.Name == args[0] {
+			fmt.Println(t.Text)
+			return nil
+		}
+	}
+	if c := findCommand(args[0]); c != nil {
+		fmt.Printf("%s — %s\n", c.Usage, c.Summary)
+		for _, sub := range c.Subcommands {
+			fmt.Printf("  %s\n", strings.Join(append([]string{c.Name, sub.Name}, sub.Flags...), " "))
+		}
+		return nil
+	}
+	return fmt.Errorf("help: неизвестная тема или команда %q", args[0])
+}
+
+// Функция runCompletionCommand выводит скрипт автодополнения для bash или zsh. Скрипт
+// строится по реестру команд и флагам программы; zsh использует тот же скрипт через bashcompinit.
+// Подключение: source <(2t2 completion bash).
+func runCompletionCommand(args []string) error {
+	if len(args) != 1 || (args[0] != "bash" && args[0] != "zsh") {
+		return errors.New("использование: completion bash|zsh")
+	}
+	prog := filepath.Base(os.Args[0])
+	fn := "_" + strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, prog)
+
+	var b strings.Builder
+	if args[0] == "zsh" {
+		b.WriteString("autoload -U +X bashcompinit && bashcompinit\n")
+	}
+	var names, topics []string
+	for _, c := range commands {
+		names = append(names, c.Name)
+	}
+	for _, t := range helpTopics {
+		topics = append(topics, t.Name)
+	}
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]}\n")
+	b.WriteString("\tlocal words=\"\"\n")
+	b.WriteString("\tcase \"${COMP_WORDS[1]}\" in\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "\t%s)\n", c.Name)
+		switch {
+		case c.Name == "help":
+			fmt.Fprintf(&b, "\t\twords=%q\n", strings.Join(append(topics, names...), " "))
+		case len(c.Subcommands) > 0:
+			var subs []string
+			for _, sub := range c.Subcommands {
+				subs = append(subs, sub.Name)
+			}
+			fmt.Fprintf(&b, "\t\tif [ \"$COMP_CWORD\" -eq 2 ]; then\n\t\t\twords=%q\n\t\telse\n", strings.Join(subs, " "))
+			b.WriteString("\t\t\tcase \"${COMP_WORDS[2]}\" in\n")
+			for _, sub := range c.Subcommands {
+				fmt.Fprintf(&b, "\t\t\t%s) words=%q ;;\n", sub.Name, strings.Join(sub.Flags, " "))
+			}
+			b.WriteString("\t\t\tesac\n\t\tfi\n")
+		}
+		b.WriteString("\t\t;;\n")
+	}
+	fmt.Fprintf(&b, "\t*)\n\t\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n\t\t\twords=%q\n\t\telse\n\t\t\twords=%q\n\t\tfi\n\t\t;;\n",
+		strings.Join(append(names, mainFlags()...), " "), strings.Join(mainFlags(), " "))
+	b.WriteString("\tesac\n")
+	b.WriteString("\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "complete -F %s %s\n", fn, prog)
+	_, err := os.Stdout.WriteString(b.String())
+	return err
+}
+
+// Функция applyEnv задает флагам, не указанным в командной строке, значения из переменных
+// окружения: для флага -max-memory проверяются LAB4_ANALYTICS_MAX_MEMORY, затем LAB4_MAX_MEMORY. Приоритет: флаг >
+// переменная окружения > значение по умолчанию. Переменная с неверным значением — ошибка.
+func applyEnv(fs *flag.FlagSet, program string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		for _, name := range envNames(program, f.Name) {
+			if value, ok := os.LookupEnv(name); ok {
+				if setErr := fs.Set(f.Name, value); setErr != nil {
+					err = fmt.Errorf("%s=%q: %w", name, value, setErr)
+				}
+				return
+			}
+		}
+	})
+	return err
+}
+
+// Функция envNames возвращает имена переменных окружения флага в порядке проверки:
+// сначала с именем программы, затем общее для всех программ лабораторной работы.
+func envNames(program, flagName string) []string {
+	name := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if program == "" {
+		return []string{"LAB4_" + name}
+	}
+	return []string{"LAB4_" + strings.ToUpper(program) + "_" + name, "LAB4_" + name}
+}
+
+// Основная функция программы.
+func main() {
+	numWorkers := flag.Int("n", 100000, "количество генерируемых работников")
+	seed := flag.Int64("seed", 0, "зерно генератора случайных чисел (0 — случайное)")
+	dataset := flag.String("dataset", "", "имя сохраненного набора данных вместо генерации")
+	positionQuery := flag.String("position", "Д", "должность для анализа: код, название или псевдоним")
+	salaryPolicyName := flag.String("salary-policy", string(SalarySkip), "обработка NaN и отрицательных зарплат: skip, error или clamp")
+	interactive := flag.Bool("interactive", false, "интерактивно подбирать количество горутин и размер части")
+	maxMemory := flag.Int64("max-memory", 0, "бюджет памяти промежуточных результатов в КиБ, сверх него данные вытесняются на диск (0 — без ограничения)")
+	asOfName := flag.String("as-of", "", "дата запроса ГГГГ-ММ-ДД, на которую вычисляется возраст (по умолчанию сегодня)")
+	sumModeName := flag.String("sum-mode", string(SumTree), "суммирование зарплат: naive, kahan или tree (одинаковый результат при любом числе горутин)")
+	statsOut := flag.String("stats-out", "", "сохранить показатели по должностям в JSON-файл для stats merge")
+	dryRun := flag.Bool("dry-run", false, "проверить параметры и набор данных, вывести план и оценку памяти без анализа")
+	explain := flag.Bool("explain", false, "выводить план запроса планировщика перед выполнением")
+	index := flag.Bool("index", false, "построить индексы по должности и возрасту при загрузке")
+	soak := flag.Duration("soak", 0, "длительный прогон анализа с поиском утечек памяти и горутин (0 — выключен)")
+	chaos := flag.Float64("chaos", 0, "вероятность случайной задержки в отмеченных точках параллельного кода (0 — выключено)")
+	chaosTest := flag.Int("chaos-test", 0, "повторить проверки инвариантов параллельного кода N раз с задержками и выйти")
+	soakInterval := flag.Duration("soak-interval", time.Second, "период замеров в длительном прогоне")
+	ci := flag.Bool("ci", false, "режим автоматической проверки: без полосы прогресса, интерактивный режим запрещен")
+
+	// Подкоманды из реестра commands разбираются вместо флагов анализа. Флаги объявлены
+	// раньше, чтобы команды help и completion могли их перечислить.
+	if len(os.Args) > 1 {
+		if c := findCommand(os.Args[1]); c != nil {
+			if err := c.Run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	flag.Parse()
+	if err := applyEnv(flag.CommandLine, "analytics"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	memoryBudget = *maxMemory * 1024
+	chaosProb = *chaos
+	ciMode = *ci
+	// В режиме -ci некому отвечать на вопросы интерактивного режима.
+	if ciMode && *interactive {
+		fmt.Fprintln(os.Stderr, "флаг -interactive нельзя использовать в режиме -ci")
+		os.Exit(2)
+	}
+
+	// Должность для анализа задается кодом, названием или псевдонимом.
+	info, err := resolvePosition(*positionQuery)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	position := info.Code
+
+	salaryPolicy, err := parseSalaryPolicy(*salaryPolicyName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	sumMode, err := parseSumMode(*sumModeName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	asOf, err := parseAsOf(*asOfName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Пробный запуск проверяет параметры и образец данных и завершается.
+	if *dryRun {
+		if err := runDryRun(*dataset, *numWorkers, position, salaryPolicy, asOf, *index); err != nil {
+			fmt.Fprintf(os.Stderr, "Пробный запуск: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var workers []Worker
+	if *dataset != "" {
+		// Загружаем сохраненный набор данных.
+		var entry datasetEntry
+		entry, err = findDataset(*dataset)
+		if err == nil {
+			// Поврежденный файл исказил бы результаты, поэтому сначала проверяем его целостность.
+			err = verifyDataset(entry)
+		}
+		if err == nil {
+			*seed = entry.Seed
+			workers, err = loadDataset(filepath.Join(dataDir, entry.File), asOf)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Загрузка набора данных: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		// Если зерно не задано, выбираем его по текущему времени.
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+
+		// Генерацию можно прервать по Ctrl+C.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		// Создаем массив работников.
+		workers, err = generateWorkers(ctx, *numWorkers, *seed, runtime.GOMAXPROCS(0), asOf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Генерация прервана: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Возраст вычисляется на дату запроса; работники, родившиеся позже нее, не учитываются.
+	workers, unborn := setAges(workers, asOf)
+
+	// Некорректные зарплаты обрабатываются до анализа, одинаково для всех агрегатов.
+	workers, report, err := applySalaryPolicy(workers, salaryPolicy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Проверка зарплат: %v\n", err)
+		os.Exit(1)
+	}
+
+	// В интерактивном режиме вместо полного отчета повторяется один анализ с параметрами пользователя.
+	if *interactive {
+		runInteractive(workers, position, os.Stdin)
+		return
+	}
+
+	// Длительный прогон завершается с ошибкой, если найдена утечка.
+	if *soak > 0 {
+		if !runSoak(workers, position, *soak, *soakInterval) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Хаос-тест без явной вероятности задержки использует 0.1.
+	if *chaosTest > 0 {
+		if chaosProb == 0 {
+			chaosProb = 0.1
+		}
+		if !runChaosTest(workers, position, *chaosTest) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Выводим параметры окружения.
+	printEnvironment(len(workers), position, *seed, asOf)
+	fmt.Printf("Некорректные зарплаты (политика %s): NaN: %d, отрицательных: %d\n", report.Policy, report.NaN, report.Negative)
+	fmt.Printf("Не родились к дате запроса: %d\n\n", unborn)
+
+	// Сводная таблица по всем должностям. Показатели можно сохранить и позже объединить
+	// с показателями других запусков командой stats merge.
+	stats := collectPositionStats(workers, runtime.GOMAXPROCS(0), blockPartitioner{})
+	printReportCard(stats)
+	if *statsOut != "" {
+		if err := writeStats(*statsOut, stats, 1); err != nil {
+			fmt.Fprintf(os.Stderr, "Сохранение показателей: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Индексы строятся после проверки зарплат, по тем данным, которые будут анализироваться.
+	var ix *ChunkIndex
+	if *index {
+		ix = BuildChunkIndex(workers, runtime.GOMAXPROCS(0))
+		printIndexReport(ix)
+	}
+
+	// Обработка данных без многозадачности.
+	processWithoutConcurrency(workers, position)
+
+	// Обработка данных с многозадачностью для каждой стратегии разбиения.
+	partitioners := []Partitioner{
+		blockPartitioner{},
+		interleavedPartitioner{},
+		rangePartitioner{KeyName: "возраста", Key: func(w Worker) float64 { return float64(w.Age) }},
+		positionPartitioner{},
+	}
+	for _, partitioner := range partitioners {
+		processWithConcurrency(workers, position, partitioner)
+	}
+
+	// Группировка по должностям при разных разбиениях.
+	processGroupBy(workers)
+
+	// Обработка данных способом, выбранным планировщиком.
+	processWithPlanner(workers, position, ix, *explain)
+
+	// Обработка данных с ограничением времени: при отмене выводится частичный результат.
+	processWithTimeout(workers, position, time.Millisecond)
+
+	// Проверка зарплат по вилкам должностей.
+	grades := []SalaryGrade{
+		{Position: "Д", MinSalary: 40000, MaxSalary: 90000},
+		{Position: "С", MinSalary: 35000, MaxSalary: 95000},
+	}
+	processSalaryGrades(workers, grades)
+
+	// Несколько метрик за один проход по данным.
+	processBatch(workers, position)
+
+	// Цепочка фильтров с несколькими агрегатами без промежуточного среза.
+	processFilterChain(workers, position)
+
+	// Тот же запрос по столбцам с битовыми картами выбора.
+	processColumnar(workers, position)
+
+	// Средняя зарплата разными способами параллельного суммирования.
+	processSalarySum(workers, position, sumMode)
+
+	// Квантили зарплаты по объединяемым скетчам частей.
+	processSalaryQuantiles(workers, position)
+
+	// Запросы наибольшего значения по произвольному ключу.
+	processArgMaxQueries(workers, position)
+
+	// Рейтинг по нескольким критериям с разбивкой балла.
+	processRanking(workers, position, asOf)
 
-	// Обработка данных с многозадачностью.
-	processWithConcurrency(workers, position)
+	// Одновременные одинаковые запросы с объединением и без.
+	processRequestStorm(workers, position, 100)
 }
@@ -1,118 +1,1919 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"math/rand"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/tabwriter"
 	"time"
 )
 
-// Количество философов за столом.
+// Количество философов за столом и ограничение времени банкета.
 const (
 	numPhilosophers = 5
+	banquetDuration = 8 * time.Second
+	courseDuration  = time.Second
+	stallDuration   = 2 * time.Second        // Длительность внедренного зависания философа.
+	dropDuration    = 500 * time.Millisecond // Время, пока упавшая вилка недоступна.
 )
 
-// Структура Fork представляет вилку, которую используют философы.
-// Вилка защищена мьютексом, чтобы предотвратить одновременное использование.
-type Fork struct {
+// Блюда банкета. Между блюдами все философы встречаются на барьере.
+var courses = []string{"Закуска", "Основное блюдо", "Десерт"}
+
+// Интерфейс Fork представляет вилку, которую используют философы.
+// Вилка защищает себя от одновременного использования; способ защиты задается
+// реализацией и выбирается независимо от стратегии взятия вилок.
+type Fork interface {
+	Lock()
+	Unlock()
+	TryLock() bool
+}
+
+// Названия реализаций вилки для флага -fork.
+var forkKinds = []string{"mutex", "channel", "backoff", "ticket"}
+
+// Функция forkConstructor возвращает конструктор вилки по названию реализации.
+func forkConstructor(kind string) (func() Fork, error) {
+	switch kind {
+	case "mutex":
+		return func() Fork { return &MutexFork{} }, nil
+	case "channel":
+		return func() Fork { return NewChanFork() }, nil
+	case "backoff":
+		return func() Fork { return &BackoffFork{} }, nil
+	case "ticket":
+		return func() Fork { return &TicketFork{} }, nil
+	}
+	return nil, fmt.Errorf("неизвестная вилка %q (ожидается одна из: %s)", kind, strings.Join(forkKinds, ", "))
+}
+
+// Структура MutexFork представляет вилку, защищенную мьютексом.
+type MutexFork struct {
 	sync.Mutex
 }
 
+// Структура ChanFork представляет вилку-жетон в буферизованном канале:
+// взять вилку — забрать жетон, положить — вернуть его.
+type ChanFork struct {
+	token chan struct{}
+}
+
+// Функция NewChanFork создает свободную вилку-жетон.
+func NewChanFork() *ChanFork {
+	f := &ChanFork{token: make(chan struct{}, 1)}
+	f.token <- struct{}{}
+	return f
+}
+
+func (f *ChanFork) Lock()   { <-f.token }
+func (f *ChanFork) Unlock() { f.token <- struct{}{} }
+
+func (f *ChanFork) TryLock() bool {
+	select {
+	case <-f.token:
+		return true
+	default:
+		return false
+	}
+}
+
+// Структура BackoffFork представляет вилку на атомарном флаге: занятую вилку
+// философ пытается взять снова через паузу, которая удваивается до maxForkBackoff.
+type BackoffFork struct {
+	held atomic.Bool
+}
+
+// Наибольшая пауза между попытками взять занятую вилку BackoffFork.
+const maxForkBackoff = 10 * time.Millisecond
+
+func (f *BackoffFork) Lock() {
+	backoff := 50 * time.Microsecond
+	for !f.TryLock() {
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxForkBackoff)
+	}
+}
+
+func (f *BackoffFork) Unlock()       { f.held.Store(false) }
+func (f *BackoffFork) TryLock() bool { return f.held.CompareAndSwap(false, true) }
+
+// Структура TicketFork представляет вилку с билетной блокировкой: философ берет
+// номер и ждет, пока не дойдет его очередь, поэтому вилку получают строго по порядку.
+type TicketFork struct {
+	next, serving atomic.Uint32
+}
+
+func (f *TicketFork) Lock() {
+	ticket := f.next.Add(1) - 1
+	for f.serving.Load() != ticket {
+		runtime.Gosched()
+	}
+}
+
+func (f *TicketFork) Unlock() { f.serving.Add(1) }
+
+// Метод TryLock берет следующий номер, только если очередь пуста.
+func (f *TicketFork) TryLock() bool {
+	serving := f.serving.Load()
+	return f.next.CompareAndSwap(serving, serving+1)
+}
+
+// Структура Lockdep представляет облегченный аналог lockdep из ядра Linux: проверку порядка
+// захвата вилок во время работы. Для каждой горутины запоминаются удерживаемые вилки,
+// а каждый захват вилки B при удерживаемой A добавляет ребро A → B в граф порядка.
+// Цикл в графе означает, что при неудачном чередовании горутины могут заблокировать
+// друг друга, даже если в этом запуске взаимоблокировки не случилось. Защиту, которую
+// Lockdep не видит, он не учитывает: у стратегии официанта тоже есть цикл, хотя
+// взаимоблокировку исключает ограничение числа мест. Поэтому аварийно завершается программа
+// только при Fatal, а иначе о каждом цикле выводится предупреждение.
+type Lockdep struct {
+	Fatal bool // Завершать программу при цикле; иначе только предупреждать.
+
+	mu       sync.Mutex
+	next     int                  // Номер следующей созданной вилки.
+	held     map[uint64][]int     // Удерживаемые вилки каждой горутины в порядке захвата.
+	after    map[int]map[int]bool // Ребра графа порядка: after[a][b] — b бралась при удерживаемой a.
+	reported map[string]bool      // Циклы, о которых уже выведено предупреждение.
+}
+
+// Функция NewLockdep создает пустой граф порядка захвата. Если fatal, найденный цикл
+// аварийно завершает программу.
+func NewLockdep(fatal bool) *Lockdep {
+	return &Lockdep{
+		Fatal:    fatal,
+		held:     make(map[uint64][]int),
+		after:    make(map[int]map[int]bool),
+		reported: make(map[string]bool),
+	}
+}
+
+// Метод Wrap оборачивает конструктор вилок так, чтобы каждая новая вилка получала номер
+// и сообщала Lockdep о захватах и освобождениях.
+func (d *Lockdep) Wrap(newFork func() Fork) func() Fork {
+	return func() Fork {
+		d.mu.Lock()
+		id := d.next
+		d.next++
+		d.mu.Unlock()
+		return &lockdepFork{Fork: newFork(), id: id, dep: d}
+	}
+}
+
+// Метод acquire проверяет захват вилки id текущей горутиной до того, как она заблокируется.
+// Если новое ребро замыкает цикл, при Fatal программа аварийно завершается с описанием цикла:
+// иначе такая ошибка проявилась бы взаимоблокировкой, которую трудно воспроизвести.
+// Без Fatal о каждом цикле один раз выводится предупреждение.
+func (d *Lockdep) acquire(id int) {
+	gid := goroutineID()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, h := range d.held[gid] {
+		if d.after[h] == nil {
+			d.after[h] = make(map[int]bool)
+		}
+		d.after[h][id] = true
+		if path := d.path(id, h, map[int]bool{}); path != nil {
+			// Цикл h → id → … → h записывается с наименьшей вилки, чтобы один и тот же
+			// цикл, замкнутый разными ребрами, узнавался при повторе.
+			cycle := append([]int{h}, path[:len(path)-1]...)
+			start := 0
+			for i, f := range cycle {
+				if f < cycle[start] {
+					start = i
+				}
+			}
+			cycle = append(cycle[start:], cycle[:start]...)
+			names := make([]string, len(cycle)+1)
+			for i, f := range append(cycle, cycle[0]) {
+				names[i] = fmt.Sprintf("вилка %d", f)
+			}
+			description := strings.Join(names, " → ")
+			if d.Fatal {
+				panic(fmt.Sprintf("lockdep: нарушен порядок захвата, возможна взаимоблокировка: %s", description))
+			}
+			if !d.reported[description] {
+				d.reported[description] = true
+				fmt.Fprintf(os.Stderr, "lockdep: предупреждение: цикл в порядке захвата (стратегия может исключать взаимоблокировку иначе): %s\n", description)
+			}
+		}
+	}
+	d.held[gid] = append(d.held[gid], id)
+}
+
+// Метод path ищет в графе порядка путь от from до to и возвращает его вершины.
+// Вызывается под d.mu.
+func (d *Lockdep) path(from, to int, visited map[int]bool) []int {
+	if from == to {
+		return []int{to}
+	}
+	visited[from] = true
+	for next := range d.after[from] {
+		if visited[next] {
+			continue
+		}
+		if rest := d.path(next, to, visited); rest != nil {
+			return append([]int{from}, rest...)
+		}
+	}
+	return nil
+}
+
+// Метод taken отмечает вилку id захваченной без ожидания (TryLock): неудачная попытка
+// не может привести к взаимоблокировке, поэтому ребра порядка не добавляются.
+func (d *Lockdep) taken(id int) {
+	gid := goroutineID()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.held[gid] = append(d.held[gid], id)
+}
+
+// Метод release убирает вилку id из удерживаемых текущей горутиной.
+func (d *Lockdep) release(id int) {
+	gid := goroutineID()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	held := d.held[gid]
+	for i, h := range held {
+		if h == id {
+			d.held[gid] = append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(d.held[gid]) == 0 {
+		delete(d.held, gid)
+	}
+}
+
+// Структура lockdepFork представляет вилку, захваты которой проверяет Lockdep.
+type lockdepFork struct {
+	Fork
+	id  int
+	dep *Lockdep
+}
+
+func (f *lockdepFork) Lock() {
+	f.dep.acquire(f.id)
+	f.Fork.Lock()
+}
+
+func (f *lockdepFork) TryLock() bool {
+	ok := f.Fork.TryLock()
+	if ok {
+		f.dep.taken(f.id)
+	}
+	return ok
+}
+
+func (f *lockdepFork) Unlock() {
+	f.dep.release(f.id)
+	f.Fork.Unlock()
+}
+
+// Функция goroutineID возвращает номер текущей горутины из заголовка ее стека
+// ("goroutine 42 [running]:"). Go не дает этот номер напрямую, поэтому функция
+// годится только для отладки.
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	fields := strings.Fields(string(buf[:n]))
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(fields[1], 10, 64)
+	return id
+}
+
+// Вероятность внедренной задержки в отмеченных точках кода философов (0 — хаос выключен).
+// Задается флагом -chaos.
+var chaosProb float64
+
+// Функция chaosPoint отмечает место, где порядок выполнения горутин не должен влиять
+// на результат. С вероятностью chaosProb горутина уступает процессор или засыпает
+// на случайное время до 100 мкс, поэтому от запуска к запуску горутины чередуются
+// по-разному и скрытые предположения о порядке проявляются чаще.
+func chaosPoint() {
+	if chaosProb == 0 || rand.Float64() >= chaosProb {
+		return
+	}
+	if rand.Intn(2) == 0 {
+		runtime.Gosched()
+	} else {
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+	}
+}
+
 // Структура Philosopher представляет философа.
 // Каждый философ имеет идентификатор, левую и правую вилку.
 type Philosopher struct {
-	id                int
-	leftFork, rightFork *Fork
+	id                  int
+	leftFork, rightFork Fork
 }
 
-// Метод dine реализует процесс "обеда" философа.
-// Философ думает и ест в бесконечном цикле, пока не получит сигнал о завершении.
-func (p Philosopher) dine(wg *sync.WaitGroup, done chan struct{}) {
-	defer wg.Done() // Уменьшаем счетчик WaitGroup при завершении.
+// Структура Event представляет событие для оповещения многих горутин сразу.
+// Реализована через закрытие канала: Set будит всех ожидающих, Reset возвращает событие в исходное состояние.
+type Event struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// Функция NewEvent создает несработавшее событие.
+func NewEvent() *Event {
+	return &Event{ch: make(chan struct{})}
+}
+
+// Метод Set устанавливает событие. Повторный вызов ничего не делает.
+func (e *Event) Set() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.ch:
+	default:
+		close(e.ch)
+	}
+}
 
+// Метод Wait блокируется до установки события.
+func (e *Event) Wait() {
+	e.mu.Lock()
+	ch := e.ch
+	e.mu.Unlock()
+	<-ch
+}
+
+// Метод IsSet проверяет, установлено ли событие, не блокируясь.
+func (e *Event) IsSet() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Метод Reset сбрасывает установленное событие.
+func (e *Event) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.ch:
+		e.ch = make(chan struct{})
+	default:
+	}
+}
+
+// Структура CyclicBarrier представляет многоразовый барьер: после прохода всех участников
+// он сбрасывается и может использоваться для следующей фазы. Действие action выполняет
+// последний прибывший участник до того, как остальные продолжат работу.
+type CyclicBarrier struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	n, count   int
+	generation int
+	action     func()
+}
+
+// Функция NewCyclicBarrier создает циклический барьер на n участников.
+func NewCyclicBarrier(n int, action func()) *CyclicBarrier {
+	b := &CyclicBarrier{n: n, action: action}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Метод Wait ожидает остальных участников текущей фазы.
+func (b *CyclicBarrier) Wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	generation := b.generation
+	b.count++
+	if b.count == b.n {
+		// Последний участник выполняет действие фазы, открывает барьер и начинает новую фазу.
+		if b.action != nil {
+			b.action()
+		}
+		b.count = 0
+		b.generation++
+		b.cond.Broadcast()
+		return
+	}
+	for generation == b.generation {
+		b.cond.Wait()
+	}
+}
+
+// Структура WeightedSemaphore представляет взвешенный семафор: участник занимает
+// сразу weight единиц ресурса из capacity и ждет, пока столько единиц не освободится.
+type WeightedSemaphore struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	capacity int
+	used     int
+}
+
+// Функция NewWeightedSemaphore создает семафор на capacity единиц ресурса.
+func NewWeightedSemaphore(capacity int) *WeightedSemaphore {
+	s := &WeightedSemaphore{capacity: capacity}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Метод Acquire занимает weight единиц ресурса, ожидая их освобождения.
+func (s *WeightedSemaphore) Acquire(weight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.used+weight > s.capacity {
+		s.cond.Wait()
+	}
+	s.used += weight
+}
+
+// Метод Release освобождает weight единиц ресурса.
+func (s *WeightedSemaphore) Release(weight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= weight
+	// Освободившихся единиц может хватить нескольким ожидающим с разным весом.
+	s.cond.Broadcast()
+}
+
+// Функция sauceWeight возвращает, сколько мест у соусника вместимостью capacity занимает
+// философ: философы с нечетным id берут двойную порцию. Порция не может превышать
+// вместимость, иначе философ ждал бы соусник вечно, держа вилки.
+func sauceWeight(id, capacity int) int {
+	return min(1+id%2, capacity)
+}
+
+// Структура TraceEvent представляет одно решение или действие философа в трассе.
+// Для решений (длительности размышления и еды, продолжение блюда) сохраняется значение.
+type TraceEvent struct {
+	Philosopher int    `json:"p"`
+	Kind        string `json:"kind"`
+	Value       int64  `json:"value,omitempty"`
+}
+
+// Структура Trace представляет полную трассу запуска: зерно генератора, параметры
+// банкета и все события в том порядке, в котором они произошли.
+type Trace struct {
+	Seed      int64        `json:"seed"`
+	Sauce     int          `json:"sauce"`
+	Strategy  string       `json:"strategy"`
+	Fork      string       `json:"fork"`
+	StallProb float64      `json:"stall_prob,omitempty"`
+	DropProb  float64      `json:"drop_prob,omitempty"`
+	Events    []TraceEvent `json:"events"`
+}
+
+// Идентификатор стола в трассе для решений, которые принимаются за всех философов сразу.
+const tableID = -1
+
+// Структура Tracer записывает трассу запуска или воспроизводит записанную.
+// Зерна генератора для повторения запуска недостаточно: порядок захвата вилок зависит
+// от планировщика. Поэтому при воспроизведении каждое событие ждет своей очереди
+// по трассе, и запуск повторяется в точности, включая почти взаимные блокировки
+// и голодание. Нулевой указатель означает работу без трассы.
+type Tracer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	trace   Trace
+	replay  bool
+	pos     int
+	onEvent func(TraceEvent) // Вызывается после каждого события под блокировкой трассировщика.
+}
+
+// Функция NewRecorder создает трассировщик, записывающий новую трассу
+// с параметрами запуска из header.
+func NewRecorder(header Trace) *Tracer {
+	header.Events = nil
+	t := &Tracer{trace: header}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Функция NewReplayer создает трассировщик, воспроизводящий записанную трассу.
+func NewReplayer(trace Trace) *Tracer {
+	t := &Tracer{trace: trace, replay: true}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Метод Decide возвращает решение философа id: при записи оно вычисляется функцией
+// decide и сохраняется в трассе, при воспроизведении берется из трассы.
+func (t *Tracer) Decide(id int, kind string, decide func() int64) int64 {
+	if t == nil {
+		return decide()
+	}
+	if !t.replay {
+		value := decide()
+		t.record(id, kind, value)
+		return value
+	}
+	event := t.await(id, kind)
+	t.advance()
+	return event.Value
+}
+
+// Метод Do выполняет действие философа id с общими ресурсами (захват или освобождение).
+// При записи захват отмечается в трассе после выполнения, а освобождение — до него,
+// чтобы в трассе освобождение ресурса всегда предшествовало его следующему захвату.
+// При воспроизведении действие выполняется в свою очередь по трассе. Перед действием
+// с флагом -chaos может быть внедрена задержка, меняющая порядок философов.
+func (t *Tracer) Do(id int, kind string, release bool, action func()) {
+	chaosPoint()
+	if t == nil {
+		action()
+		return
+	}
+	if !t.replay {
+		if release {
+			t.record(id, kind, 0)
+			action()
+		} else {
+			action()
+			t.record(id, kind, 0)
+		}
+		return
+	}
+	t.await(id, kind)
+	action()
+	t.advance()
+}
+
+// Метод Try выполняет попытку захвата ресурса философом id и возвращает ее результат.
+// При записи результат попытки try сохраняется в трассе, при воспроизведении берется
+// из трассы, и успешный захват выполняется блокирующим lock: в свою очередь ресурс свободен.
+func (t *Tracer) Try(id int, kind string, try func() bool, lock func()) bool {
+	chaosPoint()
+	if t == nil {
+		return try()
+	}
+	if !t.replay {
+		ok := try()
+		var value int64
+		if ok {
+			value = 1
+		}
+		t.record(id, kind, value)
+		return ok
+	}
+	event := t.await(id, kind)
+	if event.Value == 1 {
+		lock()
+	}
+	t.advance()
+	return event.Value == 1
+}
+
+// Метод record добавляет событие в записываемую трассу.
+func (t *Tracer) record(id int, kind string, value int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	event := TraceEvent{Philosopher: id, Kind: kind, Value: value}
+	t.trace.Events = append(t.trace.Events, event)
+	if t.onEvent != nil {
+		t.onEvent(event)
+	}
+}
+
+// Метод await ждет, пока следующим событием трассы не станет событие kind философа id.
+func (t *Tracer) await(id int, kind string) TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.pos < len(t.trace.Events) {
+		event := t.trace.Events[t.pos]
+		if event.Philosopher == id && event.Kind == kind {
+			return event
+		}
+		t.cond.Wait()
+	}
+	panic(fmt.Sprintf("трасса закончилась: философ %d ожидает события %q", id, kind))
+}
+
+// Метод advance переходит к следующему событию трассы и будит ожидающих.
+func (t *Tracer) advance() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.onEvent != nil {
+		t.onEvent(t.trace.Events[t.pos])
+	}
+	t.pos++
+	t.cond.Broadcast()
+}
+
+// Метод Save сохраняет записанную трассу в файл в формате JSON.
+func (t *Tracer) Save(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, err := json.MarshalIndent(t.trace, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Функция loadTrace читает трассу из файла.
+func loadTrace(path string) (Trace, error) {
+	var trace Trace
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return trace, err
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return trace, fmt.Errorf("%s: %w", path, err)
+	}
+	return trace, nil
+}
+
+// Структура Stepper реализует пошаговый режим: после каждого события трассы выводит
+// состояние стола и ждет нажатия Enter. Пока Stepper ждет, трассировщик заблокирован,
+// поэтому философы останавливаются на своем следующем событии.
+type Stepper struct {
+	input    *bufio.Reader
+	n        int
+	seq      int
+	course   int
+	status   []string
+	forks    []int // Философ, держащий вилку, или -1.
+	sauce    int
+	capacity int
+	running  bool // Пошаговый режим выключен командой q.
+}
+
+// Функция NewStepper создает пошаговый режим для n философов и соусника вместимостью sauce.
+func NewStepper(n, sauce int) *Stepper {
+	s := &Stepper{input: bufio.NewReader(os.Stdin), n: n, capacity: sauce}
+	s.status = make([]string, n)
+	s.forks = make([]int, n)
+	for i := range s.forks {
+		s.status[i] = "садится за стол"
+		s.forks[i] = -1
+	}
+	return s
+}
+
+// Метод Step учитывает событие, выводит состояние стола и ждет команды пользователя:
+// Enter — следующий шаг, q — продолжить без остановок.
+func (s *Stepper) Step(event TraceEvent) {
+	s.apply(event)
+	if s.running {
+		return
+	}
+
+	who := "Стол"
+	if event.Philosopher != tableID {
+		who = fmt.Sprintf("Философ %d", event.Philosopher)
+	}
+	fmt.Printf("--- Шаг %d, блюдо «%s»: %s, %s", s.seq, courses[min(s.course, len(courses)-1)], who, event.Kind)
+	if event.Value != 0 {
+		fmt.Printf(" (%d)", event.Value)
+	}
+	fmt.Println()
+	for id, status := range s.status {
+		fmt.Printf("Философ %d: %s\n", id, status)
+	}
+	var holders []string
+	for fork, holder := range s.forks {
+		if holder < 0 {
+			holders = append(holders, fmt.Sprintf("%d: свободна", fork))
+		} else {
+			holders = append(holders, fmt.Sprintf("%d: у философа %d", fork, holder))
+		}
+	}
+	fmt.Printf("Вилки: %s\n", strings.Join(holders, ", "))
+	if s.capacity > 0 {
+		fmt.Printf("Соусник: занято %d из %d\n", s.sauce, s.capacity)
+	}
+	fmt.Print("Enter — следующий шаг, q — продолжить без остановок: ")
+
+	line, err := s.input.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) == "q" {
+		s.running = true
+	}
+}
+
+// Метод apply обновляет состояние стола по событию.
+func (s *Stepper) apply(event TraceEvent) {
+	s.seq++
+	id := event.Philosopher
+	if id == tableID {
+		if event.Kind == "finish" {
+			s.course++
+		}
+		return
+	}
+	left, right := id, (id+1)%s.n
+	switch event.Kind {
+	case "continue":
+		if event.Value == 0 {
+			s.status[id] = "ждет остальных на барьере"
+		}
+	case "think":
+		s.status[id] = "размышляет"
+	case "take-left":
+		s.forks[left] = id
+		s.status[id] = "берет вилки"
+	case "take-right":
+		s.forks[right] = id
+		s.status[id] = "берет вилки"
+	case "try-right":
+		if event.Value == 1 {
+			s.forks[right] = id
+		}
+	case "take-seat":
+		s.status[id] = "получил место у официанта"
+	case "take-sauce":
+		s.sauce += sauceWeight(id, s.capacity)
+	case "eat":
+		s.status[id] = "ест"
+	case "put-left":
+		s.forks[left] = -1
+		s.status[id] = "кладет вилки"
+	case "put-right":
+		s.forks[right] = -1
+		s.status[id] = "кладет вилки"
+	case "put-sauce":
+		s.sauce -= sauceWeight(id, s.capacity)
+	}
+}
+
+// Интерфейс Strategy описывает способ, которым философ берет и кладет вилки.
+// Все действия с общими ресурсами выполняются через трассировщик, чтобы запуск
+// с любой стратегией можно было записать и воспроизвести.
+type Strategy interface {
+	Name() string  // Короткое имя для флага -strategy и трассы.
+	Title() string // Описание для вывода.
+	TakeForks(p Philosopher, tr *Tracer)
+	PutForks(p Philosopher, tr *Tracer)
+}
+
+// Имена стратегий в порядке вывода в таблице результатов.
+var strategyNames = []string{"odd-even", "hierarchy", "waiter", "trylock"}
+
+// Функция newStrategy создает стратегию по имени. У стратегий может быть собственное
+// состояние, поэтому для каждого банкета создается новый экземпляр.
+func newStrategy(name string, n int) (Strategy, error) {
+	switch name {
+	case "odd-even":
+		return oddEvenStrategy{}, nil
+	case "hierarchy":
+		return hierarchyStrategy{n: n}, nil
+	case "waiter":
+		return waiterStrategy{seats: make(chan struct{}, n-1)}, nil
+	case "trylock":
+		return tryLockStrategy{}, nil
+	case "naive":
+		return naiveStrategy{}, nil
+	}
+	return nil, fmt.Errorf("неизвестная стратегия %q (ожидается одна из: %s)", name, strings.Join(strategyNames, ", "))
+}
+
+// Функция putBoth кладет обе вилки философа.
+func putBoth(p Philosopher, tr *Tracer) {
+	tr.Do(p.id, "put-left", true, p.leftFork.Unlock)
+	tr.Do(p.id, "put-right", true, p.rightFork.Unlock)
+}
+
+// Структура naiveStrategy реализует наивный способ: все философы берут сначала левую вилку,
+// потом правую. Вилки захватываются по кругу, поэтому возможна взаимоблокировка; стратегия
+// не участвует в таблице лидеров и нужна для демонстрации проверки -lockdep.
+type naiveStrategy struct{}
+
+func (naiveStrategy) Name() string  { return "naive" }
+func (naiveStrategy) Title() string { return "Наивная (сначала левая)" }
+
+func (naiveStrategy) TakeForks(p Philosopher, tr *Tracer) {
+	tr.Do(p.id, "take-left", false, p.leftFork.Lock)
+	tr.Do(p.id, "take-right", false, p.rightFork.Lock)
+}
+
+func (naiveStrategy) PutForks(p Philosopher, tr *Tracer) { putBoth(p, tr) }
+
+// Структура oddEvenStrategy реализует исходный способ: чтобы избежать deadlock,
+// философы с четными id берут сначала левую вилку, а с нечетными — правую.
+type oddEvenStrategy struct{}
+
+func (oddEvenStrategy) Name() string { return "odd-even" }
+func (oddEvenStrategy) Title() string {
+	return "Четные слева, нечетные справа"
+}
+
+func (oddEvenStrategy) TakeForks(p Philosopher, tr *Tracer) {
+	if p.id%2 == 0 {
+		tr.Do(p.id, "take-left", false, p.leftFork.Lock)   // Блокируем левую вилку.
+		tr.Do(p.id, "take-right", false, p.rightFork.Lock) // Блокируем правую вилку.
+	} else {
+		tr.Do(p.id, "take-right", false, p.rightFork.Lock) // Блокируем правую вилку.
+		tr.Do(p.id, "take-left", false, p.leftFork.Lock)   // Блокируем левую вилку.
+	}
+}
+
+func (oddEvenStrategy) PutForks(p Philosopher, tr *Tracer) { putBoth(p, tr) }
+
+// Структура hierarchyStrategy реализует иерархию ресурсов: вилки пронумерованы,
+// и каждый философ сначала берет вилку с меньшим номером. Только последний философ,
+// у которого правая вилка имеет номер 0, начинает с правой.
+type hierarchyStrategy struct {
+	n int
+}
+
+func (hierarchyStrategy) Name() string  { return "hierarchy" }
+func (hierarchyStrategy) Title() string { return "Иерархия ресурсов" }
+
+func (s hierarchyStrategy) TakeForks(p Philosopher, tr *Tracer) {
+	if (p.id+1)%s.n > p.id {
+		tr.Do(p.id, "take-left", false, p.leftFork.Lock)
+		tr.Do(p.id, "take-right", false, p.rightFork.Lock)
+	} else {
+		tr.Do(p.id, "take-right", false, p.rightFork.Lock)
+		tr.Do(p.id, "take-left", false, p.leftFork.Lock)
+	}
+}
+
+func (hierarchyStrategy) PutForks(p Philosopher, tr *Tracer) { putBoth(p, tr) }
+
+// Структура waiterStrategy реализует официанта: за вилками одновременно могут тянуться
+// не больше n-1 философов, поэтому хотя бы один из них всегда получит обе вилки.
+type waiterStrategy struct {
+	seats chan struct{}
+}
+
+func (waiterStrategy) Name() string  { return "waiter" }
+func (waiterStrategy) Title() string { return "Официант (n-1 мест)" }
+
+func (s waiterStrategy) TakeForks(p Philosopher, tr *Tracer) {
+	tr.Do(p.id, "take-seat", false, func() { s.seats <- struct{}{} })
+	tr.Do(p.id, "take-left", false, p.leftFork.Lock)
+	tr.Do(p.id, "take-right", false, p.rightFork.Lock)
+}
+
+func (s waiterStrategy) PutForks(p Philosopher, tr *Tracer) {
+	putBoth(p, tr)
+	tr.Do(p.id, "put-seat", true, func() { <-s.seats })
+}
+
+// Структура tryLockStrategy реализует попытку с отступом: философ берет левую вилку
+// и пробует взять правую; если она занята, кладет левую и повторяет попытку
+// через случайную паузу.
+type tryLockStrategy struct{}
+
+func (tryLockStrategy) Name() string  { return "trylock" }
+func (tryLockStrategy) Title() string { return "Попытка с отступом" }
+
+func (tryLockStrategy) TakeForks(p Philosopher, tr *Tracer) {
 	for {
-		select {
-		case <-done:
-			// Если получен сигнал о завершении, философ заканчивает обедать.
-			fmt.Printf("Философ %d закончил обедать.\n", p.id)
+		tr.Do(p.id, "take-left", false, p.leftFork.Lock)
+		if tr.Try(p.id, "try-right", p.rightFork.TryLock, p.rightFork.Lock) {
 			return
-		default:
+		}
+		tr.Do(p.id, "put-left", true, p.leftFork.Unlock)
+		ms := tr.Decide(p.id, "backoff", func() int64 { return int64(1 + rand.Intn(10)) })
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+	}
+}
+
+func (tryLockStrategy) PutForks(p Philosopher, tr *Tracer) { putBoth(p, tr) }
+
+// Тип State описывает состояние философа.
+type State int
+
+const (
+	Thinking State = iota // Размышляет.
+	Hungry                // Ждет вилки или соусник.
+	Eating                // Ест.
+	Finished              // Закончил обедать.
+)
+
+// Метод String возвращает название состояния.
+func (s State) String() string {
+	switch s {
+	case Thinking:
+		return "размышляет"
+	case Hungry:
+		return "голоден"
+	case Eating:
+		return "ест"
+	case Finished:
+		return "закончил"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Ожидание вилок не меньше этого времени считается борьбой за вилку.
+const contentionThreshold = time.Millisecond
+
+// Интерфейс Observer получает события банкета. Симуляция только сообщает о событиях,
+// а вывод, сбор метрик и экспорт реализуются наблюдателями. Методы вызываются
+// из горутин философов одновременно, поэтому реализации должны быть потокобезопасными.
+type Observer interface {
+	OnStateChange(id int, state State)
+	OnMealFinished(id int, course string, forkWait, sauceWait time.Duration)
+	OnForkContended(id int, wait time.Duration)
+	OnCourseFinished(stats CourseStats)
+}
+
+// Структура multiObserver передает события нескольким наблюдателям.
+type multiObserver []Observer
+
+func (m multiObserver) OnStateChange(id int, state State) {
+	for _, o := range m {
+		o.OnStateChange(id, state)
+	}
+}
+
+func (m multiObserver) OnMealFinished(id int, course string, forkWait, sauceWait time.Duration) {
+	for _, o := range m {
+		o.OnMealFinished(id, course, forkWait, sauceWait)
+	}
+}
+
+func (m multiObserver) OnForkContended(id int, wait time.Duration) {
+	for _, o := range m {
+		o.OnForkContended(id, wait)
+	}
+}
+
+func (m multiObserver) OnCourseFinished(stats CourseStats) {
+	for _, o := range m {
+		o.OnCourseFinished(stats)
+	}
+}
+
+// Структура logObserver выводит события построчно, как исходная программа.
+type logObserver struct{}
+
+func (logObserver) OnStateChange(id int, state State) {
+	switch state {
+	case Thinking:
+		fmt.Printf("Философ %d размышляет о великом.\n", id)
+	case Eating:
+		fmt.Printf("Философ %d ест спагетти.\n", id)
+	case Finished:
+		fmt.Printf("Философ %d закончил обедать.\n", id)
+	}
+}
+
+func (logObserver) OnMealFinished(int, string, time.Duration, time.Duration) {}
+func (logObserver) OnForkContended(int, time.Duration)                       {}
+
+func (logObserver) OnCourseFinished(stats CourseStats) {
+	printCourseStats(stats)
+}
+
+// Функция printCourseStats выводит статистику блюда по каждому философу.
+func printCourseStats(stats CourseStats) {
+	total := 0
+	for _, meals := range stats.Meals {
+		total += meals
+	}
+	fmt.Printf("Блюдо «%s» завершено за %v, приемов пищи: %d (%.2f в секунду)\n",
+		stats.Name, stats.Elapsed.Round(time.Millisecond), total, float64(total)/stats.Elapsed.Seconds())
+	for id, meals := range stats.Meals {
+		fmt.Printf("Философ %d: приемов пищи %d, ожидание вилок %v, ожидание соусника %v\n", id, meals,
+			stats.ForkWaits[id].Round(time.Millisecond), stats.SauceWaits[id].Round(time.Millisecond))
+	}
+	fmt.Println()
+}
+
+// Структура Counter представляет счетчик событий без общей точки конкуренции:
+// у каждой горутины свой слот, дополненный до строки кэша, а значение счетчика —
+// сумма слотов при чтении.
+type Counter struct {
+	slots []counterSlot
+}
+
+// Структура counterSlot представляет слот счетчика, занимающий отдельную строку кэша.
+type counterSlot struct {
+	n atomic.Int64
+	_ [56]byte
+}
+
+// Функция NewCounter создает счетчик на slots слотов (обычно по одному на философа).
+func NewCounter(slots int) *Counter {
+	return &Counter{slots: make([]counterSlot, slots)}
+}
+
+// Метод Add добавляет delta в слот slot.
+func (c *Counter) Add(slot int, delta int64) {
+	c.slots[slot%len(c.slots)].n.Add(delta)
+}
+
+// Метод LoadSlot возвращает значение слота slot.
+func (c *Counter) LoadSlot(slot int) int64 {
+	return c.slots[slot%len(c.slots)].n.Load()
+}
+
+// Метод Load возвращает сумму всех слотов.
+func (c *Counter) Load() int64 {
+	var total int64
+	for i := range c.slots {
+		total += c.slots[i].n.Load()
+	}
+	return total
+}
+
+// Структура metricsObserver собирает сводные метрики банкета.
+// Частые события (смены состояний и приемы пищи) считаются счетчиками со слотом
+// на философа, остальные метрики защищены мьютексом.
+type metricsObserver struct {
+	meals           *Counter
+	stateChanges    *Counter
+	mu              sync.Mutex
+	contentions     []int
+	contendedWait   time.Duration
+	longestForkWait time.Duration
+}
+
+// Функция newMetricsObserver создает сборщик метрик для n философов.
+func newMetricsObserver(n int) *metricsObserver {
+	return &metricsObserver{meals: NewCounter(n), stateChanges: NewCounter(n), contentions: make([]int, n)}
+}
+
+func (m *metricsObserver) OnStateChange(id int, _ State) {
+	m.stateChanges.Add(id, 1)
+}
+
+func (m *metricsObserver) OnMealFinished(id int, _ string, forkWait, _ time.Duration) {
+	m.meals.Add(id, 1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.longestForkWait = max(m.longestForkWait, forkWait)
+}
+
+func (m *metricsObserver) OnForkContended(id int, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.contentions[id]++
+	m.contendedWait += wait
+}
+
+func (m *metricsObserver) OnCourseFinished(CourseStats) {}
+
+// Метод Print выводит собранные метрики.
+func (m *metricsObserver) Print() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Printf("Метрики: приемов пищи %d, смен состояний %d, самое долгое ожидание вилок %v, суммарное ожидание занятых вилок %v\n",
+		m.meals.Load(), m.stateChanges.Load(), m.longestForkWait.Round(time.Millisecond), m.contendedWait.Round(time.Millisecond))
+	for id := range m.contentions {
+		fmt.Printf("Философ %d: приемов пищи %d, из них с борьбой за вилки %d\n", id, m.meals.LoadSlot(id), m.contentions[id])
+	}
+}
+
+// Структура tuiObserver показывает состояние всех философов в одной обновляемой строке.
+type tuiObserver struct {
+	mu     sync.Mutex
+	states []State
+}
+
+// Функция newTUIObserver создает строку состояния для n философов.
+func newTUIObserver(n int) *tuiObserver {
+	return &tuiObserver{states: make([]State, n)}
+}
+
+func (t *tuiObserver) OnStateChange(id int, state State) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.states[id] = state
+	t.redraw()
+}
+
+func (t *tuiObserver) OnMealFinished(int, string, time.Duration, time.Duration) {}
+func (t *tuiObserver) OnForkContended(int, time.Duration)                       {}
+
+func (t *tuiObserver) OnCourseFinished(stats CourseStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Итог блюда выводится отдельной строкой, а строка состояния рисуется под ним заново.
+	fmt.Print("\r\033[K")
+	printCourseStats(stats)
+	t.redraw()
+}
+
+// Метод redraw перерисовывает строку состояния. Вызывается под блокировкой.
+func (t *tuiObserver) redraw() {
+	parts := make([]string, len(t.states))
+	for id, state := range t.states {
+		parts[id] = fmt.Sprintf("Ф%d: %-10s", id, state)
+	}
+	fmt.Print("\r\033[K" + strings.Join(parts, " | "))
+	if allFinished(t.states) {
+		fmt.Println()
+	}
+}
+
+// Функция allFinished проверяет, закончили ли обедать все философы.
+func allFinished(states []State) bool {
+	for _, state := range states {
+		if state != Finished {
+			return false
+		}
+	}
+	return true
+}
+
+// Структура exportObserver записывает события в формате JSON Lines для внешнего анализа.
+type exportObserver struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	start time.Time
+}
+
+// Структура exportEvent представляет строку экспорта.
+type exportEvent struct {
+	TimeMs      int64  `json:"time_ms"`
+	Philosopher int    `json:"p"`
+	Event       string `json:"event"`
+	State       string `json:"state,omitempty"`
+	Course      string `json:"course,omitempty"`
+	WaitMs      int64  `json:"wait_ms,omitempty"`
+}
+
+// Функция newExportObserver создает экспорт событий в w.
+func newExportObserver(w io.Writer) *exportObserver {
+	return &exportObserver{enc: json.NewEncoder(w), start: time.Now()}
+}
+
+// Метод write записывает событие с отметкой времени от начала банкета.
+func (e *exportObserver) write(event exportEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	event.TimeMs = time.Since(e.start).Milliseconds()
+	e.enc.Encode(event)
+}
+
+func (e *exportObserver) OnStateChange(id int, state State) {
+	e.write(exportEvent{Philosopher: id, Event: "state", State: state.String()})
+}
+
+func (e *exportObserver) OnMealFinished(id int, course string, forkWait, _ time.Duration) {
+	e.write(exportEvent{Philosopher: id, Event: "meal", Course: course, WaitMs: forkWait.Milliseconds()})
+}
+
+func (e *exportObserver) OnForkContended(id int, wait time.Duration) {
+	e.write(exportEvent{Philosopher: id, Event: "contended", WaitMs: wait.Milliseconds()})
+}
+
+func (e *exportObserver) OnCourseFinished(stats CourseStats) {
+	e.write(exportEvent{Philosopher: tableID, Event: "course", Course: stats.Name})
+}
+
+// Структура nopObserver игнорирует все события. Используется для запуска без вывода.
+type nopObserver struct{}
+
+func (nopObserver) OnStateChange(int, State)                                 {}
+func (nopObserver) OnMealFinished(int, string, time.Duration, time.Duration) {}
+func (nopObserver) OnForkContended(int, time.Duration)                       {}
+func (nopObserver) OnCourseFinished(CourseStats)                             {}
+
+// Структура Faults задает внедрение сбоев для проверки устойчивости стратегий.
+// Вероятности проверяются при каждом приеме пищи.
+type Faults struct {
+	StallProb     float64       // Вероятность, что философ зависнет во время еды.
+	StallDuration time.Duration // Длительность зависания.
+	DropProb      float64       // Вероятность, что философ уронит вилку после еды.
+	DropDuration  time.Duration // Сколько упавшая вилка недоступна остальным.
+}
+
+// Функция inject решает с вероятностью prob, произойдет ли сбой, и возвращает
+// его длительность в миллисекундах (0 — сбоя нет). Решение записывается в трассу.
+func inject(tr *Tracer, id int, kind string, prob float64, duration time.Duration) time.Duration {
+	if prob <= 0 {
+		return 0
+	}
+	ms := tr.Decide(id, kind, func() int64 {
+		if rand.Float64() < prob {
+			return duration.Milliseconds()
+		}
+		return 0
+	})
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Структура TableOptions содержит параметры банкета.
+type TableOptions struct {
+	Sauce int     // Вместимость соусника; 0 — без соусника.
+	Trace *Tracer // Трасса запуска; nil, если не ведется.
+	// Наблюдатель событий банкета; nil — без вывода.
+	Observer Observer
+	// Конструктор вилок; nil — вилки на мьютексе.
+	NewFork func() Fork
+	// Внедряемые сбои; нулевое значение — без сбоев.
+	Faults Faults
+}
+
+// Структура Banquet представляет банкет из нескольких блюд. Каждое блюдо длится
+// courseDuration, после чего философы доедают и ждут остальных на барьере.
+// Состояние блюда меняет только действие барьера, пока все философы ждут на нем,
+// поэтому отдельная синхронизация для чтения состояния не нужна.
+type Banquet struct {
+	barrier       *CyclicBarrier
+	done          *Event
+	course        int
+	start         time.Time
+	end           time.Time
+	finished      bool
+	sauce         *WeightedSemaphore // Соусник; nil, если соуса нет.
+	trace         *Tracer            // Трасса запуска; nil, если не ведется.
+	strategy      Strategy
+	observer      Observer
+	meals         [][]int           // Приемы пищи: [блюдо][философ].
+	forkWaits     [][]time.Duration // Время ожидания вилок: [блюдо][философ].
+	sauceWaits    [][]time.Duration // Время ожидания соусника: [блюдо][философ].
+	courseElapsed []time.Duration   // Длительность завершенных блюд.
+	faults        Faults
+	stalls, drops atomic.Int64 // Количество внедренных сбоев.
+}
+
+// Функция NewBanquet создает банкет для n философов. Первое блюдо начинается сразу.
+// Если в параметрах задан соусник, во время еды философы занимают в нем места.
+// Решения и действия философов записываются в трассу или воспроизводятся из нее.
+func NewBanquet(n int, done *Event, strategy Strategy, opts TableOptions) *Banquet {
+	b := &Banquet{done: done, start: time.Now(), trace: opts.Trace, strategy: strategy, observer: opts.Observer, faults: opts.Faults}
+	if b.observer == nil {
+		b.observer = nopObserver{}
+	}
+	b.end = b.start.Add(courseDuration)
+	if opts.Sauce > 0 {
+		b.sauce = NewWeightedSemaphore(opts.Sauce)
+	}
+	b.meals = make([][]int, len(courses))
+	b.forkWaits = make([][]time.Duration, len(courses))
+	b.sauceWaits = make([][]time.Duration, len(courses))
+	for i := range courses {
+		b.meals[i] = make([]int, n)
+		b.forkWaits[i] = make([]time.Duration, n)
+		b.sauceWaits[i] = make([]time.Duration, n)
+	}
+	b.barrier = NewCyclicBarrier(n, b.nextCourse)
+	return b
+}
+
+// Метод nextCourse завершает текущее блюдо: выводит его статистику и начинает следующее.
+// Вызывается последним философом, пришедшим на барьер.
+func (b *Banquet) nextCourse() {
+	b.courseElapsed = append(b.courseElapsed, time.Since(b.start))
+	b.observer.OnCourseFinished(b.courseStats(b.course))
+	b.course++
+	b.finished = b.trace.Decide(tableID, "finish", func() int64 {
+		if b.course == len(courses) || b.done.IsSet() {
+			return 1
+		}
+		return 0
+	}) == 1
+	b.start = time.Now()
+	b.end = b.start.Add(courseDuration)
+}
+
+// Метод courseStats возвращает статистику блюда с номером i.
+func (b *Banquet) courseStats(i int) CourseStats {
+	return CourseStats{
+		Name:       courses[i],
+		Elapsed:    b.courseElapsed[i],
+		Meals:      b.meals[i],
+		ForkWaits:  b.forkWaits[i],
+		SauceWaits: b.sauceWaits[i],
+	}
+}
+
+// Метод dine реализует процесс "обеда" философа.
+// Во время каждого блюда философ думает и ест, пока блюдо не закончится или не будет
+// установлено событие завершения, а затем ждет остальных на барьере.
+func (p Philosopher) dine(wg *sync.WaitGroup, banquet *Banquet) {
+	defer wg.Done() // Уменьшаем счетчик WaitGroup при завершении.
+
+	for !banquet.finished {
+		course, end := banquet.course, banquet.end
+		for p.keepEating(banquet.trace, end, banquet.done) {
 			// Философ думает, затем ест.
-			p.think()
-			p.eat()
+			p.think(banquet)
+			forkWait, sauceWait := p.eat(banquet)
+			banquet.forkWaits[course][p.id] += forkWait
+			banquet.sauceWaits[course][p.id] += sauceWait
+			banquet.meals[course][p.id]++
+			banquet.observer.OnMealFinished(p.id, courses[course], forkWait, sauceWait)
 		}
+		// Следующее блюдо начнется, когда все философы закончат текущее.
+		banquet.barrier.Wait()
 	}
+	// Если банкет закончен, философ заканчивает обедать.
+	banquet.observer.OnStateChange(p.id, Finished)
+}
+
+// Метод keepEating решает, продолжает ли философ текущее блюдо: блюдо продолжается
+// до момента end, если не установлено событие завершения.
+func (p Philosopher) keepEating(tr *Tracer, end time.Time, done *Event) bool {
+	return tr.Decide(p.id, "continue", func() int64 {
+		if time.Now().Before(end) && !done.IsSet() {
+			return 1
+		}
+		return 0
+	}) == 1
 }
 
 // Метод think реализует процесс "размышления" философа.
 // Философ думает случайное количество времени.
-func (p Philosopher) think() {
-	fmt.Printf("Философ %d размышляет о великом.\n", p.id)
-	time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
+func (p Philosopher) think(b *Banquet) {
+	b.observer.OnStateChange(p.id, Thinking)
+	ms := b.trace.Decide(p.id, "think", func() int64 { return int64(rand.Intn(1000)) })
+	time.Sleep(time.Duration(ms) * time.Millisecond)
 }
 
 // Метод eat реализует процесс "еды" философа.
-// Философ берет вилки, ест и затем кладет вилки обратно.
-func (p Philosopher) eat() {
-	// Чтобы избежать deadlock, философы с четными id берут сначала левую вилку,
-	// а с нечетными — правую.
-	if p.id%2 == 0 {
-		p.leftFork.Lock()  // Блокируем левую вилку.
-		p.rightFork.Lock() // Блокируем правую вилку.
-	} else {
-		p.rightFork.Lock() // Блокируем правую вилку.
-		p.leftFork.Lock()  // Блокируем левую вилку.
+// Философ берет вилки способом, заданным стратегией, занимает место у соусника
+// (если он есть), ест и затем освобождает соусник и кладет вилки обратно.
+// Возвращает время, которое философ ждал вилки и соусник.
+func (p Philosopher) eat(b *Banquet) (time.Duration, time.Duration) {
+	tr, sauce := b.trace, b.sauce
+	b.observer.OnStateChange(p.id, Hungry)
+	start := time.Now()
+	b.strategy.TakeForks(p, tr)
+	forkWait := time.Since(start)
+	if forkWait >= contentionThreshold {
+		b.observer.OnForkContended(p.id, forkWait)
+	}
+
+	// Соусник общий для всего стола, поэтому философ может ждать его, уже держа вилки.
+	var sauceWait time.Duration
+	if sauce != nil {
+		start = time.Now()
+		tr.Do(p.id, "take-sauce", false, func() { sauce.Acquire(sauceWeight(p.id, sauce.capacity)) })
+		sauceWait = time.Since(start)
 	}
 
 	// Философ ест случайное количество времени.
-	fmt.Printf("Философ %d ест спагетти.\n", p.id)
-	time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
+	b.observer.OnStateChange(p.id, Eating)
+	ms := tr.Decide(p.id, "eat", func() int64 { return int64(rand.Intn(1000)) })
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+
+	// Внедренный сбой: философ зависает посреди еды, продолжая держать вилки и соусник.
+	if stall := inject(tr, p.id, "stall", b.faults.StallProb, b.faults.StallDuration); stall > 0 {
+		b.stalls.Add(1)
+		time.Sleep(stall)
+	}
 
-	// Освобождаем вилки.
-	p.leftFork.Unlock()
-	p.rightFork.Unlock()
+	// Освобождаем соусник и вилки.
+	if sauce != nil {
+		tr.Do(p.id, "put-sauce", true, func() { sauce.Release(sauceWeight(p.id, sauce.capacity)) })
+	}
+	// Внедренный сбой: вилка падает, и пока ее поднимают и моют, она недоступна соседям.
+	if drop := inject(tr, p.id, "drop", b.faults.DropProb, b.faults.DropDuration); drop > 0 {
+		b.drops.Add(1)
+		time.Sleep(drop)
+	}
+	b.strategy.PutForks(p, tr)
+	return forkWait, sauceWait
 }
 
-func main() {
-	// Инициализируем генератор случайных чисел.
-	rand.Seed(time.Now().UnixNano())
+// Структура Table представляет стол с философами, который можно запустить без вывода
+// в консоль и проверить результат программно: NewTable задает количество философов,
+// стратегию и параметры, Run проводит банкет и возвращает статистику.
+type Table struct {
+	n        int
+	strategy Strategy
+	opts     TableOptions
+}
+
+// Структура CourseStats содержит статистику одного блюда.
+type CourseStats struct {
+	Name       string
+	Elapsed    time.Duration
+	Meals      []int           // Приемы пищи каждого философа.
+	ForkWaits  []time.Duration // Время ожидания вилок каждым философом.
+	SauceWaits []time.Duration // Время ожидания соусника каждым философом.
+}
+
+// Структура Stats содержит результат банкета.
+type Stats struct {
+	Courses []CourseStats // Поданные блюда; при отмене последнее блюдо прервано.
+	Meals   []int         // Приемы пищи каждого философа за весь банкет.
+	Elapsed time.Duration
+	Stalls  int // Внедренные зависания философов.
+	Drops   int // Внедренные падения вилок.
+}
+
+// Функция NewTable создает стол на n философов со стратегией взятия вилок strategy.
+func NewTable(n int, strategy Strategy, opts TableOptions) *Table {
+	return &Table{n: n, strategy: strategy, opts: opts}
+}
+
+// Метод Run рассаживает философов, проводит банкет и возвращает статистику.
+// Отмена ctx прерывает текущее блюдо и завершает банкет.
+func (t *Table) Run(ctx context.Context) Stats {
+	start := time.Now()
 
-	// Создаем массив вилок. Каждая вилка представлена мьютексом.
-	forks := make([]*Fork, numPhilosophers)
-	for i := 0; i < numPhilosophers; i++ {
-		forks[i] = &Fork{}
+	// Создаем массив вилок. По умолчанию каждая вилка представлена мьютексом.
+	newFork := t.opts.NewFork
+	if newFork == nil {
+		newFork = func() Fork { return &MutexFork{} }
+	}
+	forks := make([]Fork, t.n)
+	for i := 0; i < t.n; i++ {
+		forks[i] = newFork()
 	}
 
 	// Создаем массив философов.
-	philosophers := make([]*Philosopher, numPhilosophers)
-	for i := 0; i < numPhilosophers; i++ {
+	philosophers := make([]*Philosopher, t.n)
+	for i := 0; i < t.n; i++ {
 		philosophers[i] = &Philosopher{
-			id:        i,                      // Уникальный идентификатор философа.
-			leftFork:  forks[i],               // Левая вилка.
-			rightFork: forks[(i+1)%numPhilosophers], // Правая вилка (круговая зависимость).
+			id:        i,                // Уникальный идентификатор философа.
+			leftFork:  forks[i],         // Левая вилка.
+			rightFork: forks[(i+1)%t.n], // Правая вилка (круговая зависимость).
 		}
 	}
 
 	// Используем WaitGroup для ожидания завершения всех горутин.
 	var wg sync.WaitGroup
-	// Канал done используется для сигнализации о завершении работы.
-	done := make(chan struct{})
+	// Событие done используется для сигнализации о завершении работы.
+	done := NewEvent()
+	stop := context.AfterFunc(ctx, done.Set)
+	defer stop()
+	// Банкет из нескольких блюд с барьером между ними.
+	banquet := NewBanquet(t.n, done, t.strategy, t.opts)
 
 	// Запускаем горутины для каждого философа.
 	for _, philosopher := range philosophers {
 		wg.Add(1) // Увеличиваем счетчик WaitGroup.
-		go philosopher.dine(&wg, done)
+		go philosopher.dine(&wg, banquet)
+	}
+
+	// Ожидаем завершения всех горутин.
+	wg.Wait()
+
+	stats := Stats{
+		Meals:   make([]int, t.n),
+		Elapsed: time.Since(start),
+		Stalls:  int(banquet.stalls.Load()),
+		Drops:   int(banquet.drops.Load()),
+	}
+	for i := range banquet.courseElapsed {
+		stats.Courses = append(stats.Courses, banquet.courseStats(i))
+		for id, meals := range banquet.meals[i] {
+			stats.Meals[id] += meals
+		}
 	}
+	return stats
+}
 
-	// Философы едят 5 секунд.
-	time.Sleep(5 * time.Second)
+// Функция jainIndex вычисляет индекс справедливости Джайна для количества приемов пищи:
+// 1 — все философы ели поровну, 1/n — ел только один.
+func jainIndex(counts []int) float64 {
+	var sum, sumSquares float64
+	for _, c := range counts {
+		sum += float64(c)
+		sumSquares += float64(c) * float64(c)
+	}
+	if sumSquares == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(counts)) * sumSquares)
+}
 
-	// Закрываем канал done, чтобы сигнализировать философам о завершении.
-	close(done)
+// Функция cpuTime возвращает процессорное время процесса по оценке среды выполнения Go:
+// время, когда процессоры планировщика были заняты. В отличие от getrusage, runtime/metrics
+// доступен на любой ОС. Метрики обновляются при сборке мусора, поэтому она запускается
+// перед чтением принудительно.
+func cpuTime() time.Duration {
+	runtime.GC()
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	busy := samples[0].Value.Float64() - samples[1].Value.Float64()
+	return time.Duration(busy * float64(time.Second))
+}
 
-	// Ожидаем завершения всех горутин.
+// Структура strategyScore содержит результаты одной стратегии для таблицы лидеров.
+type strategyScore struct {
+	strategy Strategy
+	meals    int
+	jain     float64
+	wall     time.Duration
+	cpu      time.Duration
+	score    float64
+}
+
+// Функция runLeaderboard проводит банкет с каждой стратегией при одинаковом зерне,
+// параметрах opts и ограничении времени и выводит таблицу лидеров. Итоговая оценка — количество
+// приемов пищи в секунду, умноженное на индекс Джайна и деленное на 1 + доля
+// процессорного времени: стратегия выигрывает, если философы едят часто, поровну
+// и не тратят процессор на ожидание.
+func runLeaderboard(seed int64, opts TableOptions) {
+	var scores []strategyScore
+	for _, name := range strategyNames {
+		strategy, _ := newStrategy(name, numPhilosophers)
+		fmt.Printf("Стратегия %s...\n", strategy.Title())
+
+		rand.Seed(seed)
+		ctx, cancel := context.WithTimeout(context.Background(), banquetDuration)
+		cpuStart := cpuTime()
+		stats := NewTable(numPhilosophers, strategy, opts).Run(ctx)
+		cancel()
+		s := strategyScore{strategy: strategy, wall: stats.Elapsed, cpu: cpuTime() - cpuStart}
+
+		for _, m := range stats.Meals {
+			s.meals += m
+		}
+		s.jain = jainIndex(stats.Meals)
+		s.score = float64(s.meals) / s.wall.Seconds() * s.jain / (1 + s.cpu.Seconds()/s.wall.Seconds())
+		scores = append(scores, s)
+	}
+
+	sort.Slice(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+
+	fmt.Printf("\nТаблица лидеров (зерно %d):\n", seed)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Место\tСтратегия\tПриемов пищи\tВ секунду\tИндекс Джайна\tПроцессор\tОценка\t")
+	for i, s := range scores {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%.2f\t%.3f\t%v\t%.3f\t\n", i+1, s.strategy.Title(), s.meals,
+			float64(s.meals)/s.wall.Seconds(), s.jain, s.cpu.Round(time.Millisecond), s.score)
+	}
+	w.Flush()
+}
+
+// Структура PriorityMutex представляет экспериментальный мьютекс с наследованием приоритета.
+// Приоритеты назначает пользователь: горутины в Go не имеют приоритетов, поэтому наследование
+// рекомендательное — владелец узнает унаследованный приоритет через Priority и сам решает,
+// как им воспользоваться (например, запросить процессор раньше менее важных задач).
+// При освобождении мьютекс передается ожидающему с наибольшим приоритетом.
+type PriorityMutex struct {
+	mu      sync.Mutex
+	locked  bool
+	boost   int // Наибольший приоритет среди владельца и ожидающих.
+	waiters []priorityWaiter
+}
+
+// Структура priorityWaiter представляет горутину, ожидающую PriorityMutex.
+type priorityWaiter struct {
+	priority int
+	ready    chan struct{}
+}
+
+// Метод LockPriority захватывает мьютекс от имени задачи с приоритетом priority.
+// Если мьютекс занят, владелец наследует priority, пока ожидающий не получит мьютекс.
+func (m *PriorityMutex) LockPriority(priority int) {
+	m.mu.Lock()
+	if !m.locked {
+		m.locked, m.boost = true, priority
+		m.mu.Unlock()
+		return
+	}
+	w := priorityWaiter{priority: priority, ready: make(chan struct{})}
+	m.waiters = append(m.waiters, w)
+	m.boost = max(m.boost, priority)
+	m.mu.Unlock()
+	<-w.ready
+}
+
+// Метод Unlock освобождает мьютекс, передавая его ожидающему с наибольшим приоритетом
+// (при равенстве — пришедшему раньше).
+func (m *PriorityMutex) Unlock() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.waiters) == 0 {
+		m.locked = false
+		return
+	}
+	best := 0
+	for i, w := range m.waiters {
+		if w.priority > m.waiters[best].priority {
+			best = i
+		}
+	}
+	next := m.waiters[best]
+	m.waiters = append(m.waiters[:best], m.waiters[best+1:]...)
+	m.boost = next.priority
+	for _, w := range m.waiters {
+		m.boost = max(m.boost, w.priority)
+	}
+	close(next.ready)
+}
+
+// Метод Priority возвращает действующий приоритет владельца с собственным приоритетом own.
+// Вызывается только владельцем мьютекса.
+func (m *PriorityMutex) Priority(own int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return max(own, m.boost)
+}
+
+// Интерфейс priorityLocker объединяет PriorityMutex и обычный мьютекс для сравнения.
+type priorityLocker interface {
+	LockPriority(priority int)
+	Unlock()
+	Priority(own int) int
+}
+
+// Структура plainPriorityLock представляет sync.Mutex, который игнорирует приоритеты.
+type plainPriorityLock struct {
+	sync.Mutex
+}
+
+func (l *plainPriorityLock) LockPriority(int)     { l.Lock() }
+func (l *plainPriorityLock) Priority(own int) int { return own }
+
+// Структура priorityCPU представляет единственный процессор с кооперативным планированием:
+// квант времени получает ожидающая задача с наибольшим действующим приоритетом.
+type priorityCPU struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	busy    bool
+	waiting map[string]func() int // Действующие приоритеты ожидающих задач.
+}
+
+// Функция newPriorityCPU создает свободный процессор.
+func newPriorityCPU() *priorityCPU {
+	c := &priorityCPU{waiting: make(map[string]func() int)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Метод Run ждет, пока задача name станет самой приоритетной среди ожидающих,
+// и занимает процессор на квант slice.
+func (c *priorityCPU) Run(name string, priority func() int, slice time.Duration) {
+	c.mu.Lock()
+	c.waiting[name] = priority
+	for c.busy || !c.highest(name) {
+		c.cond.Wait()
+	}
+	delete(c.waiting, name)
+	c.busy = true
+	c.mu.Unlock()
+
+	time.Sleep(slice)
+
+	c.mu.Lock()
+	c.busy = false
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// Метод highest сообщает, что ни у одной ожидающей задачи приоритет не выше, чем у name.
+// Вызывается под c.mu.
+func (c *priorityCPU) highest(name string) bool {
+	own := c.waiting[name]()
+	for other, priority := range c.waiting {
+		if other != name && priority() > own {
+			return false
+		}
+	}
+	return true
+}
+
+// Функция runPriorityInversion разыгрывает классическую инверсию приоритетов на философах
+// с приоритетами 0, 1 и 2 и возвращает, сколько самый важный философ ждал вилку.
+// Младший берет вилку и ест несколько квантов; старший приходит за той же вилкой;
+// среднему вилка не нужна, но он занимает процессор. С обычным мьютексом средний вытесняет
+// младшего, и старший ждет, пока средний не закончит. С наследованием младший получает
+// приоритет старшего, доедает раньше среднего и отдает вилку.
+func runPriorityInversion(fork priorityLocker) time.Duration {
+	const slice = 2 * time.Millisecond
+	const (
+		low = iota
+		medium
+		high
+	)
+	cpu := newPriorityCPU()
+	holding := make(chan struct{})
+	var wg sync.WaitGroup
+	var highWait time.Duration
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		fork.LockPriority(low)
+		close(holding)
+		for i := 0; i < 5; i++ {
+			cpu.Run("младший", func() int { return fork.Priority(low) }, slice)
+		}
+		fork.Unlock()
+	}()
+	go func() {
+		defer wg.Done()
+		<-holding
+		start := time.Now()
+		fork.LockPriority(high)
+		highWait = time.Since(start)
+		cpu.Run("старший", func() int { return high }, slice)
+		fork.Unlock()
+	}()
+	go func() {
+		defer wg.Done()
+		<-holding
+		time.Sleep(slice / 2) // Средний приходит, когда старший уже ждет вилку.
+		for i := 0; i < 20; i++ {
+			cpu.Run("средний", func() int { return medium }, slice)
+		}
+	}()
 	wg.Wait()
+	return highWait
+}
+
+// Функция runPriorityDemo сравнивает ожидание старшего философа с sync.Mutex и PriorityMutex.
+func runPriorityDemo() {
+	fmt.Println("Инверсия приоритетов: младший держит вилку, средний занимает процессор, старший ждет вилку.")
+	fmt.Printf("sync.Mutex: старший ждал вилку %v\n", runPriorityInversion(&plainPriorityLock{}).Round(time.Millisecond))
+	fmt.Printf("PriorityMutex: старший ждал вилку %v\n", runPriorityInversion(&PriorityMutex{}).Round(time.Millisecond))
+}
+
+// Функция applyEnv задает флагам, не указанным в командной строке, значения из переменных
+// окружения: для флага -stall-prob проверяются LAB4_PHILOSOPHERS_STALL_PROB, затем LAB4_STALL_PROB. Приоритет: флаг >
+// переменная окружения > значение по умолчанию. Переменная с неверным значением — ошибка.
+func applyEnv(fs *flag.FlagSet, program string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		for _, name := range envNames(program, f.Name) {
+			if value, ok := os.LookupEnv(name); ok {
+				if setErr := fs.Set(f.Name, value); setErr != nil {
+					err = fmt.Errorf("%s=%q: %w", name, value, setErr)
+				}
+				return
+			}
+		}
+	})
+	return err
+}
+
+// Функция envNames возвращает имена переменных окружения флага в порядке проверки:
+// сначала с именем программы, затем общее для всех программ лабораторной работы.
+func envNames(program, flagName string) []string {
+	name := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if program == "" {
+		return []string{"LAB4_" + name}
+	}
+	return []string{"LAB4_" + strings.ToUpper(program) + "_" + name, "LAB4_" + name}
+}
+
+func main() {
+	sauceCapacity := flag.Int("sauce", 2, "вместимость соусника в порциях (0 — без соусника)")
+	seed := flag.Int64("seed", 0, "зерно генератора случайных чисел (0 — случайное)")
+	strategyName := flag.String("strategy", "odd-even", "способ взятия вилок: "+strings.Join(strategyNames, ", ")+" (naive — без защиты от взаимоблокировки)")
+	stallProb := flag.Float64("stall-prob", 0, "вероятность зависания философа во время еды")
+	dropProb := flag.Float64("drop-prob", 0, "вероятность падения вилки после еды")
+	forkKind := flag.String("fork", "mutex", "реализация вилки: "+strings.Join(forkKinds, ", "))
+	leaderboard := flag.Bool("leaderboard", false, "сравнить все стратегии и вывести таблицу лидеров")
+	recordPath := flag.String("record", "", "записать трассу запуска в файл")
+	replayPath := flag.String("replay", "", "воспроизвести трассу запуска из файла")
+	step := flag.Bool("step", false, "пошаговый режим: остановка после каждого события")
+	output := flag.String("output", "log", "вывод событий: log (построчно), tui (строка состояния) или none")
+	showMetrics := flag.Bool("metrics", false, "вывести сводные метрики после банкета")
+	exportPath := flag.String("export", "", "записать события в файл в формате JSON Lines")
+	lockdep := flag.Bool("lockdep", false, "проверять порядок захвата вилок: для naive завершаться при найденном цикле, для остальных стратегий предупреждать")
+	chaos := flag.Float64("chaos", 0, "вероятность случайной задержки перед каждым действием с вилками (0 — выключено)")
+	priorityDemo := flag.Bool("priority-demo", false, "показать инверсию приоритетов с sync.Mutex и PriorityMutex")
+	ci := flag.Bool("ci", false, "режим автоматической проверки: пошаговый режим и строка состояния запрещены")
+	flag.Parse()
+	if err := applyEnv(flag.CommandLine, "philosophers"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	chaosProb = *chaos
+	// В режиме -ci некому нажимать Enter в пошаговом режиме, а строка состояния
+	// перерисовывается управляющими последовательностями терминала.
+	if *ci && (*step || *output == "tui") {
+		fmt.Fprintln(os.Stderr, "флаги -step и -output tui нельзя использовать в режиме -ci")
+		os.Exit(2)
+	}
+
+	if *priorityDemo {
+		runPriorityDemo()
+		return
+	}
+
+	// Трасса записывается или воспроизводится, если это задано флагами.
+	var tracer *Tracer
+	if *replayPath != "" {
+		trace, err := loadTrace(*replayPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Загрузка трассы: %v\n", err)
+			os.Exit(1)
+		}
+		// Параметры запуска берутся из трассы.
+		*seed, *sauceCapacity, *strategyName = trace.Seed, trace.Sauce, trace.Strategy
+		*stallProb, *dropProb = trace.StallProb, trace.DropProb
+		if trace.Fork != "" {
+			*forkKind = trace.Fork
+		}
+		tracer = NewReplayer(trace)
+		fmt.Printf("Воспроизведение трассы %s: событий %d, зерно %d\n", *replayPath, len(trace.Events), trace.Seed)
+	}
+
+	// Инициализируем генератор случайных чисел.
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rand.Seed(*seed)
+
+	newFork, err := forkConstructor(*forkKind)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Только наивная стратегия ничем, кроме порядка захвата, не защищена от взаимоблокировки;
+	// у остальных цикл может быть безопасен (официант ограничивает число мест), и о нем
+	// выводится предупреждение. Наивная стратегия не участвует в таблице лидеров.
+	if *lockdep {
+		newFork = NewLockdep(*strategyName == "naive" && !*leaderboard).Wrap(newFork)
+	}
+	faults := Faults{StallProb: *stallProb, StallDuration: stallDuration, DropProb: *dropProb, DropDuration: dropDuration}
+
+	// Сравнение стратегий проводит несколько банкетов подряд без трассы.
+	if *leaderboard {
+		runLeaderboard(*seed, TableOptions{Sauce: *sauceCapacity, NewFork: newFork, Faults: faults})
+		return
+	}
+
+	strategy, err := newStrategy(*strategyName, numPhilosophers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *recordPath != "" || (*step && tracer == nil) {
+		tracer = NewRecorder(Trace{
+			Seed:      *seed,
+			Sauce:     *sauceCapacity,
+			Strategy:  strategy.Name(),
+			Fork:      *forkKind,
+			StallProb: *stallProb,
+			DropProb:  *dropProb,
+		})
+	}
+	// В пошаговом режиме события проходят через трассировщик, даже если трасса не сохраняется.
+	if *step {
+		tracer.onEvent = NewStepper(numPhilosophers, *sauceCapacity).Step
+	}
+
+	// Банкет заканчивается после всех блюд или по истечении времени. В пошаговом режиме
+	// время уходит на чтение шагов, поэтому банкет ограничивается только количеством блюд.
+	ctx := context.Background()
+	if !*step {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, banquetDuration)
+		defer cancel()
+	}
+	// Наблюдатели выбираются флагами.
+	var observers multiObserver
+	switch *output {
+	case "log":
+		observers = append(observers, logObserver{})
+	case "tui":
+		observers = append(observers, newTUIObserver(numPhilosophers))
+	case "none":
+	default:
+		fmt.Fprintf(os.Stderr, "неизвестный вывод %q (ожидается log, tui или none)\n", *output)
+		os.Exit(1)
+	}
+	var metricsObs *metricsObserver
+	if *showMetrics {
+		metricsObs = newMetricsObserver(numPhilosophers)
+		observers = append(observers, metricsObs)
+	}
+	if *exportPath != "" {
+		file, err := os.Create(*exportPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Экспорт событий: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		observers = append(observers, newExportObserver(file))
+	}
+
+	opts := TableOptions{Sauce: *sauceCapacity, Trace: tracer, Observer: observers, NewFork: newFork, Faults: faults}
+	stats := NewTable(numPhilosophers, strategy, opts).Run(ctx)
+	if metricsObs != nil {
+		metricsObs.Print()
+	}
 
 	// Выводим сообщение о завершении.
 	fmt.Println("Все философы закончили обедать.")
+	if *stallProb > 0 || *dropProb > 0 {
+		fmt.Printf("Внедренные сбои: зависаний %d, упавших вилок %d\n", stats.Stalls, stats.Drops)
+	}
+
+	// Сохраняем записанную трассу для последующего воспроизведения.
+	if *recordPath != "" {
+		if err := tracer.Save(*recordPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Сохранение трассы: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Трасса сохранена в %s (зерно %d)\n", *recordPath, *seed)
+	}
 }
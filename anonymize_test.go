@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Функция TestAnonymizeWorkers проверяет обезличивание каждого поля и то, что результат
+// не зависит от числа горутин.
+// Запуск: go test 2t2.go anonymize_test.go.
+func TestAnonymizeWorkers(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	workers := make([]Worker, 3*generateShardSize)
+	for i := range workers {
+		workers[i] = Worker{Name: "Иван", Position: "Д", BirthDate: date(1987, time.June, 15), Salary: 51499.5}
+	}
+	workers[1].Name = "Петр"
+
+	opts := AnonymizeOptions{Names: NamesHash, Key: []byte("ключ"), AgeBucket: 5, SalaryRound: 1000}
+	want := anonymizeWorkers(workers, opts, 1)
+	for _, numGoroutines := range []int{2, 3, 8} {
+		if got := anonymizeWorkers(workers, opts, numGoroutines); !reflect.DeepEqual(got, want) {
+			t.Fatalf("горутин %d: результат отличается от вычисленного одной горутиной", numGoroutines)
+		}
+	}
+
+	w := want[0]
+	if w.Name == "Иван" || w.Name != want[2].Name || w.Name == want[1].Name {
+		t.Errorf("hash: псевдонимы %q, %q, %q: одно имя должно давать один псевдоним, разные — разные",
+			w.Name, want[1].Name, want[2].Name)
+	}
+	if other := anonymizeWorkers(workers[:1], AnonymizeOptions{Names: NamesHash, Key: []byte("другой")}, 1); other[0].Name == w.Name {
+		t.Errorf("hash: псевдоним не зависит от ключа")
+	}
+	if !w.BirthDate.Equal(date(1985, time.January, 1)) {
+		t.Errorf("группа годов: дата рождения %v, ожидалось 1985-01-01", w.BirthDate)
+	}
+	if w.Salary != 51000 {
+		t.Errorf("округление зарплаты: %v, ожидалось 51000", w.Salary)
+	}
+	if w.Position != "Д" {
+		t.Errorf("должность изменилась: %q", w.Position)
+	}
+	if workers[0].Name != "Иван" {
+		t.Errorf("исходные данные изменены")
+	}
+
+	tokens := anonymizeWorkers(workers[:3], AnonymizeOptions{Names: NamesToken}, 2)
+	if tokens[0].Name == tokens[2].Name || tokens[0].Name == "Иван" {
+		t.Errorf("token: имена %q и %q должны быть разными номерами записей", tokens[0].Name, tokens[2].Name)
+	}
+	if kept := anonymizeWorkers(workers[:1], AnonymizeOptions{Names: NamesKeep}, 1); kept[0] != workers[0] {
+		t.Errorf("без обезличивания запись изменилась: %+v", kept[0])
+	}
+}
+
+// Функция TestParseAnonymizeOptions проверяет отказ от хеширования имен без ключа
+// и от неизвестных способов и отрицательных параметров.
+func TestParseAnonymizeOptions(t *testing.T) {
+	tests := []struct {
+		names, key string
+		ageBucket  int
+		round      float64
+		wantErr    bool
+	}{
+		{names: "token", ageBucket: 5, round: 1000},
+		{names: "hash", key: "k"},
+		{names: "hash", wantErr: true},
+		{names: "md5", wantErr: true},
+		{names: "keep", ageBucket: -1, wantErr: true},
+		{names: "keep", round: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		if _, err := parseAnonymizeOptions(tt.names, tt.key, tt.ageBucket, tt.round); (err != nil) != tt.wantErr {
+			t.Errorf("parseAnonymizeOptions(%q, %q, %d, %v): ошибка %v, ожидалась: %t",
+				tt.names, tt.key, tt.ageBucket, tt.round, err, tt.wantErr)
+		}
+	}
+}
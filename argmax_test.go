@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Функция TestParallelArgMaxTies проверяет, что при равных значениях ключа parallelArgMax
+// выбирает того же работника, что и последовательный ArgMax, — с наименьшим индексом, —
+// при любом числе горутин. Равные значения ставятся по обе стороны границ частей,
+// чтобы победитель одной части сравнивался с победителем соседней.
+// Запуск: go test 2t2.go argmax_test.go.
+func TestParallelArgMaxTies(t *testing.T) {
+	const n = 50
+	all := func(Worker) bool { return true }
+	salary := func(w Worker) float64 { return w.Salary }
+
+	for numGoroutines := 1; numGoroutines <= n+1; numGoroutines++ {
+		for _, r := range partition(n, numGoroutines) {
+			// Наибольшая зарплата у последнего работника части и у первого работника
+			// следующей части, а также у последнего работника среза.
+			ties := []int{r[1] - 1, n - 1}
+			if r[1] < n {
+				ties = append(ties, r[1])
+			}
+			workers := make([]Worker, n)
+			for i := range workers {
+				workers[i] = Worker{Name: fmt.Sprintf("Работник %d", i), Salary: float64(i % 7)}
+			}
+			for _, i := range ties {
+				workers[i].Salary = 100
+			}
+			want := workers[r[1]-1].Name
+
+			sequential, _, _ := ArgMax(workers, all, salary)
+			if sequential.Name != want {
+				t.Fatalf("ArgMax: %s, ожидался %s", sequential.Name, want)
+			}
+			parallel, value, found := parallelArgMax(workers, all, salary, numGoroutines)
+			if !found || value != 100 || parallel.Name != want {
+				t.Errorf("parallelArgMax(горутин %d, равные значения %v): %s (%v, %t), ожидался %s",
+					numGoroutines, ties, parallel.Name, value, found, want)
+			}
+		}
+	}
+}
+
+// Функция TestParallelArgMaxFilter проверяет, что отфильтрованные работники не выигрывают
+// даже с наибольшим значением, а без подходящих работников результат не найден.
+func TestParallelArgMaxFilter(t *testing.T) {
+	workers := []Worker{
+		{Name: "А", Position: "С", Salary: 500},
+		{Name: "Б", Position: "Д", Salary: 300},
+		{Name: "В", Position: "С", Salary: 500},
+		{Name: "Г", Position: "Д", Salary: 300},
+	}
+	salary := func(w Worker) float64 { return w.Salary }
+	for numGoroutines := 1; numGoroutines <= len(workers); numGoroutines++ {
+		worker, _, found := parallelArgMax(workers, func(w Worker) bool { return w.Position == "Д" }, salary, numGoroutines)
+		if !found || worker.Name != "Б" {
+			t.Errorf("горутин %d: %s (%t), ожидался Б", numGoroutines, worker.Name, found)
+		}
+		if _, _, found := parallelArgMax(workers, func(Worker) bool { return false }, salary, numGoroutines); found {
+			t.Errorf("горутин %d: найден работник, хотя подходящих нет", numGoroutines)
+		}
+	}
+}
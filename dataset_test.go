@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Функция TestDatasetRoundTrip проверяет, что работники, записанные writeDataset в обычный,
+// сжатый gzip и двоичный файл, читаются readDataset без изменений и в том же порядке, в том
+// числе с ограничением limit, не кратным размеру пачки разбора или блока.
+// Запуск: go test -cpu 1,4 2t2.go dataset_test.go.
+func TestDatasetRoundTrip(t *testing.T) {
+	asOf := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewSource(1))
+	workers := make([]Worker, binaryShardRecords+3*parseBatchSize+17)
+	for i := range workers {
+		workers[i] = generateWorker(rng, i, asOf)
+		workers[i].Age = 0 // Возраст не хранится в файле, его вычисляет setAges после загрузки.
+	}
+	workers[0].HireDate = time.Time{} // Дата приема неизвестна.
+	workers[1].BirthDate = time.Date(1950, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	dir := t.TempDir()
+	for _, file := range []string{"workers.csv", "workers.csv.gz", "workers.wbin"} {
+		path := filepath.Join(dir, file)
+		if _, err := writeDataset(path, workers); err != nil {
+			t.Fatalf("%s: запись: %v", file, err)
+		}
+		for _, limit := range []int{0, 1, parseBatchSize + 1, binaryShardRecords + 1, len(workers) + 5} {
+			got, err := readDataset(path, asOf, limit)
+			if err != nil {
+				t.Fatalf("%s: чтение (limit %d): %v", file, limit, err)
+			}
+			want := workers
+			if limit > 0 && limit < len(workers) {
+				want = workers[:limit]
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s (limit %d): прочитано %d работников, не совпадает с записанными (%d)", file, limit, len(got), len(want))
+			}
+		}
+	}
+
+	// Сжатый файл действительно сжат, а файл с расширением .gz без сжатия не читается.
+	plain, _ := os.Stat(filepath.Join(dir, "workers.csv"))
+	packed, _ := os.Stat(filepath.Join(dir, "workers.csv.gz"))
+	if packed.Size() >= plain.Size() {
+		t.Errorf("сжатый файл %d байт, несжатый %d", packed.Size(), plain.Size())
+	}
+	fake := filepath.Join(dir, "fake.csv.gz")
+	if err := os.Rename(filepath.Join(dir, "workers.csv"), fake); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readDataset(fake, asOf, 0); err == nil {
+		t.Errorf("файл без сжатия с расширением .gz прочитан без ошибки")
+	}
+}
+
+// Функция TestBinaryDatasetCorrupt проверяет, что усеченный или поврежденный двоичный файл
+// читается с ошибкой, а не с паникой или лишними записями.
+func TestBinaryDatasetCorrupt(t *testing.T) {
+	workers := []Worker{{Name: "Иван", Position: "Д", Salary: 1}, {Name: "Петр", Position: "Р", Salary: 2}}
+	path := filepath.Join(t.TempDir(), "workers.wbin")
+	if _, err := writeDataset(path, workers); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := map[string][]byte{
+		"усечен":        data[:len(data)-1],
+		"пустой":        nil,
+		"нет сигнатуры": append([]byte("LAB4WBIX"), data[len(binaryMagic):]...),
+		"длина имени":   append(append([]byte{}, data[:len(binaryMagic)]...), append([]byte{0xff}, data[len(binaryMagic)+1:]...)...),
+		"число записей": append(append([]byte{}, data[:len(data)-binaryTrailer-4]...), append([]byte{0xff, 0xff, 0, 0}, data[len(data)-binaryTrailer:]...)...),
+	}
+	for name, content := range corrupt {
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := readDataset(path, time.Time{}, 0); err == nil {
+			t.Errorf("%s: прочитано %d работников без ошибки", name, len(got))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Функция TestDiffWorkers проверяет, что diffWorkers находит принятых, уволенных
+// и изменившихся работников одинаково при любом числе частей хеш-соединения.
+// Запуск: go test 2t2.go diff_test.go.
+func TestDiffWorkers(t *testing.T) {
+	before := []Worker{
+		{Name: "А", Position: "Д", Salary: 100},
+		{Name: "Б", Position: "Д", Salary: 200},
+		{Name: "В", Position: "С", Salary: 300},
+		{Name: "Г", Position: "С", Salary: 400},
+	}
+	after := []Worker{
+		{Name: "Б", Position: "Д", Salary: 250},
+		{Name: "В", Position: "Д", Salary: 300},
+		{Name: "Г", Position: "Д", Salary: 350},
+		{Name: "Е", Position: "С", Salary: 500},
+	}
+	want := datasetDiff{
+		Added:   []Worker{after[3]},
+		Removed: []Worker{before[0]},
+		Salary: []workerChange{
+			{Before: before[1], After: after[0]},
+			{Before: before[3], After: after[2]},
+		},
+		Position: []workerChange{
+			{Before: before[2], After: after[1]},
+			{Before: before[3], After: after[2]},
+		},
+	}
+	for parts := 0; parts <= 5; parts++ {
+		if got := diffWorkers(before, after, parts); !reflect.DeepEqual(got, want) {
+			t.Errorf("частей %d: %+v, ожидалось %+v", parts, got, want)
+		}
+	}
+
+	if got := diffWorkers(before, before, 3); !reflect.DeepEqual(got, datasetDiff{}) {
+		t.Errorf("одинаковые наборы: %+v, ожидалось без различий", got)
+	}
+}
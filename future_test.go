@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+// Функция mustPanic вызывает f и возвращает значение ее паники; если паники нет, тест падает.
+func mustPanic(t *testing.T, name string, f func()) (value any) {
+	t.Helper()
+	defer func() {
+		value = recover()
+		if value == nil {
+			t.Errorf("%s: паника не повторена в вызывающей горутине", name)
+		}
+	}()
+	f()
+	return nil
+}
+
+// Функция TestSubmitPanic проверяет, что паника задачи Submit не завершает программу
+// из горутины пула: Future получает *PanicError, Wait (в том числе у WhenAll и ParallelFor)
+// повторяет панику, а горутина пула продолжает выполнять задачи.
+// Запуск: go test 2t2.go future_test.go.
+func TestSubmitPanic(t *testing.T) {
+	ctx := context.Background()
+	pool := NewPool(1)
+	defer pool.Close()
+
+	f := Submit(ctx, pool, func(context.Context) (int, error) { panic("сбой части") })
+	<-f.Done()
+	var panicErr *PanicError
+	if !errors.As(f.err, &panicErr) || panicErr.Value != "сбой части" {
+		t.Fatalf("ошибка Future: %v, ожидалась *PanicError со значением паники", f.err)
+	}
+	if value := mustPanic(t, "Wait", func() { f.Wait(ctx) }); value != "сбой части" {
+		t.Errorf("Wait: паника %v, ожидалась \"сбой части\"", value)
+	}
+
+	ok := Submit(ctx, pool, func(context.Context) (int, error) { return 1, nil })
+	mustPanic(t, "WhenAll", func() { WhenAll(ok, f).Wait(ctx) })
+	if value, err := ok.Wait(ctx); value != 1 || err != nil {
+		t.Errorf("задача после паники: %d, %v, ожидалось 1 без ошибки", value, err)
+	}
+
+	mustPanic(t, "ParallelFor", func() {
+		ParallelFor(ctx, 10, 1, 4, func(lo, hi int) {
+			if lo == 7 {
+				panic("сбой полуинтервала")
+			}
+		})
+	})
+}
+
+// Функция TestAnalyzeParallelOverflow проверяет, что переполнение суммы возрастов в части
+// доходит до вызывающего analyzeParallel при любом разбиении, а не завершает программу
+// из горутины пула.
+func TestAnalyzeParallelOverflow(t *testing.T) {
+	workers := make([]Worker, 8)
+	for i := range workers {
+		workers[i] = Worker{Position: "Д", Age: math.MaxInt64 / 2}
+	}
+	for _, p := range []Partitioner{blockPartitioner{}, interleavedPartitioner{}, positionPartitioner{}} {
+		value := mustPanic(t, p.Name(), func() { analyzeParallel(workers, "Д", p, 2) })
+		if s, ok := value.(string); !ok || s == "" {
+			t.Errorf("%s: паника %v, ожидалось сообщение о переполнении", p.Name(), value)
+		}
+	}
+}
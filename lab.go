@@ -0,0 +1,836 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Структура Subsystem описывает одну часть лабораторной работы: программу, которую
+// оркестратор запускает через go run, и способ извлечь из ее вывода главное для отчета.
+type Subsystem struct {
+	Name      string
+	File      string
+	Args      []string
+	CIArgs    []string            // Дополнительные аргументы в режиме -ci.
+	Artifacts []SubsystemArtifact // Файлы, которые подсистема записывает в каталог запуска.
+	Summarize func(lines []string) []string
+}
+
+// Структура SubsystemArtifact описывает файл, который подсистема записывает по флагу Flag.
+// В каталоге запуска файл называется <подсистема>/<File>.
+type SubsystemArtifact struct {
+	Flag string
+	File string
+	Kind string
+}
+
+// Структура Result представляет результат запуска подсистемы.
+type Result struct {
+	Name     string
+	Elapsed  time.Duration
+	Err      error
+	TimedOut bool     // Подсистема прервана по ограничению времени.
+	Output   []string // Полный вывод программы (stdout и stderr).
+	Summary  []string // Строки для итогового отчета.
+}
+
+// Подсистемы в порядке запуска. Сценарии sync не ждут ввода и не выводят прогресс,
+// поэтому режиму -ci для них нечего менять.
+var subsystems = []Subsystem{
+	{
+		Name: "sync", File: "t1.go",
+		Artifacts: []SubsystemArtifact{{Flag: "-export", File: "results.jsonl", Kind: "results"}},
+		Summarize: summarizeSync,
+	},
+	{
+		Name: "analytics", File: "2t2.go", Args: []string{"-n", "100000", "-seed", "1"}, CIArgs: []string{"-ci"},
+		Artifacts: []SubsystemArtifact{{Flag: "-stats-out", File: "stats.json", Kind: "stats"}},
+		Summarize: summarizeAnalytics,
+	},
+	{
+		Name: "philosophers", File: "3.go", Args: []string{"-output", "none", "-metrics", "-seed", "1"}, CIArgs: []string{"-ci"},
+		Artifacts: []SubsystemArtifact{{Flag: "-export", File: "events.jsonl", Kind: "trace"}},
+		Summarize: summarizePhilosophers,
+	},
+}
+
+// Функция summarizeSync выбирает из строк "X Time: ..." сценарии с наибольшим временем.
+func summarizeSync(lines []string) []string {
+	type scenario struct {
+		name    string
+		elapsed time.Duration
+	}
+	var scenarios []scenario
+	for _, line := range lines {
+		name, rest, ok := strings.Cut(line, " Time: ")
+		if !ok {
+			continue
+		}
+		value, _, _ := strings.Cut(rest, ",")
+		if d, err := time.ParseDuration(value); err == nil {
+			scenarios = append(scenarios, scenario{name, d})
+		}
+	}
+	sort.SliceStable(scenarios, func(i, j int) bool { return scenarios[i].elapsed > scenarios[j].elapsed })
+
+	summary := []string{fmt.Sprintf("Сценариев: %d", len(scenarios))}
+	for i := 0; i < len(scenarios) && i < 3; i++ {
+		summary = append(summary, fmt.Sprintf("Самый долгий №%d: %s (%v)", i+1, scenarios[i].name, scenarios[i].elapsed))
+	}
+	return summary
+}
+
+// Функция summarizeAnalytics сопоставляет заголовки способов обработки с их временем:
+// заголовок — строка, заканчивающаяся двоеточием, время — следующая за ним строка
+// "Время обработки: ...".
+func summarizeAnalytics(lines []string) []string {
+	var summary []string
+	header := ""
+	for _, line := range lines {
+		switch {
+		case strings.HasSuffix(line, ":"):
+			header = strings.TrimSuffix(line, ":")
+		case strings.HasPrefix(line, "Время обработки: ") && header != "":
+			summary = append(summary, fmt.Sprintf("%s: %s", header, strings.TrimPrefix(line, "Время обработки: ")))
+			header = ""
+		}
+	}
+	return summary
+}
+
+// Функция summarizePhilosophers оставляет сводные метрики и итоговую строку банкета.
+func summarizePhilosophers(lines []string) []string {
+	var summary []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Метрики:") {
+			summary = append(summary, line)
+		}
+	}
+	if len(lines) > 0 {
+		summary = append(summary, lines[len(lines)-1])
+	}
+	return summary
+}
+
+// Функция run запускает подсистему через go run в каталоге dir и собирает результат.
+// Если limit > 0, подсистема прерывается через limit. В режиме ci к аргументам
+// добавляются CIArgs подсистемы, а если задан каталог запуска art — флаги записи артефактов.
+func run(ctx context.Context, dir string, s Subsystem, limit time.Duration, ci bool, art *RunArtifacts) Result {
+	if limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+	args := append([]string{"run", s.File}, s.Args...)
+	if ci {
+		args = append(args, s.CIArgs...)
+	}
+	if art != nil {
+		artifactArgs, err := subsystemArtifactArgs(art, s)
+		if err != nil {
+			return Result{Name: s.Name, Err: err, Output: []string{err.Error()}}
+		}
+		args = append(args, artifactArgs...)
+	}
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Отмена завершает go run, но собранная им программа может продолжать держать вывод
+	// открытым; без WaitDelay ожидание вывода длилось бы до ее завершения.
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	result := Result{Name: s.Name, Elapsed: time.Since(start), Err: err, TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded)}
+	result.Output = strings.Split(strings.TrimRight(output.String(), "\n"), "\n")
+	if err == nil {
+		result.Summary = s.Summarize(result.Output)
+	}
+	return result
+}
+
+// Функция selectSubsystems возвращает подсистемы из списка names через запятую
+// (пустой список — все подсистемы).
+func selectSubsystems(names string) ([]Subsystem, error) {
+	if names == "" {
+		return subsystems, nil
+	}
+	var selected []Subsystem
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for _, s := range subsystems {
+			if s.Name == strings.TrimSpace(name) {
+				selected = append(selected, s)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("неизвестная подсистема %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// Функция printReport выводит итоговый отчет: таблицу статусов и сводку каждой подсистемы.
+// Если verbose, после сводки выводится полный вывод программы.
+func printReport(results []Result, total time.Duration, verbose bool) {
+	fmt.Printf("Отчет по лабораторной работе (общее время %v):\n", total.Round(time.Millisecond))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Подсистема\tСтатус\tВремя\t")
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = "ошибка: " + r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\t\n", r.Name, status, r.Elapsed.Round(time.Millisecond))
+	}
+	w.Flush()
+
+	for _, r := range results {
+		fmt.Printf("\n%s:\n", r.Name)
+		lines := r.Summary
+		// При ошибке сводку извлечь нельзя, поэтому показывается конец вывода.
+		if r.Err != nil && !verbose {
+			lines = r.Output[max(0, len(r.Output)-10):]
+		}
+		if verbose {
+			lines = r.Output
+		}
+		for _, line := range lines {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
+
+// Функция applyEnv задает флагам, не указанным в командной строке, значения из переменных
+// окружения: для флага -timeout проверяются LAB4_TIMEOUT. Приоритет: флаг >
+// переменная окружения > значение по умолчанию. Переменная с неверным значением — ошибка.
+func applyEnv(fs *flag.FlagSet, program string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		for _, name := range envNames(program, f.Name) {
+			if value, ok := os.LookupEnv(name); ok {
+				if setErr := fs.Set(f.Name, value); setErr != nil {
+					err = fmt.Errorf("%s=%q: %w", name, value, setErr)
+				}
+				return
+			}
+		}
+	})
+	return err
+}
+
+// Функция envNames возвращает имена переменных окружения флага. Оркестратор передает
+// program == "", а программы подсистем проверяют и переменные со своим именем.
+func envNames(program, flagName string) []string {
+	name := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if program == "" {
+		return []string{"LAB4_" + name}
+	}
+	return []string{"LAB4_" + strings.ToUpper(program) + "_" + name, "LAB4_" + name}
+}
+
+// Мьютекс, не дающий строкам журнала JSON из разных горутин перемешаться.
+var logMu sync.Mutex
+
+// Функция logJSON выводит в stderr событие журнала режима -ci одной строкой JSON.
+func logJSON(event string, fields map[string]any) {
+	record := map[string]any{"time": time.Now().UTC().Format(time.RFC3339Nano), "event": event}
+	for k, v := range fields {
+		record[k] = v
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{"event": "log_error", "error": err.Error()})
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	os.Stderr.Write(append(data, '\n'))
+}
+
+// Структура ciSummary представляет итоговую сводку запуска в машиночитаемом виде.
+type ciSummary struct {
+	OK         bool          `json:"ok"`
+	ElapsedMS  int64         `json:"elapsed_ms"`
+	Subsystems []ciSubsystem `json:"subsystems"`
+}
+
+// Структура ciSubsystem представляет результат одной подсистемы в итоговой сводке.
+type ciSubsystem struct {
+	Name      string   `json:"name"`
+	Status    string   `json:"status"` // ok, error или timeout.
+	ElapsedMS int64    `json:"elapsed_ms"`
+	Error     string   `json:"error,omitempty"`
+	Summary   []string `json:"summary,omitempty"`
+	Tail      []string `json:"tail,omitempty"` // Конец вывода при ошибке.
+}
+
+// Функция status возвращает состояние подсистемы для сводки и журнала.
+func (r Result) status() string {
+	switch {
+	case r.TimedOut:
+		return "timeout"
+	case r.Err != nil:
+		return "error"
+	}
+	return "ok"
+}
+
+// Функция newSummary собирает итоговую сводку по результатам подсистем.
+func newSummary(results []Result, total time.Duration) ciSummary {
+	summary := ciSummary{OK: true, ElapsedMS: total.Milliseconds()}
+	for _, r := range results {
+		s := ciSubsystem{Name: r.Name, Status: r.status(), ElapsedMS: r.Elapsed.Milliseconds(), Summary: r.Summary}
+		if r.Err != nil {
+			summary.OK = false
+			s.Error = r.Err.Error()
+			s.Tail = r.Output[max(0, len(r.Output)-10):]
+		}
+		summary.Subsystems = append(summary.Subsystems, s)
+	}
+	return summary
+}
+
+// Функция writeSummary записывает сводку в w в формате JSON.
+func writeSummary(w io.Writer, summary ciSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Структура RunArtifacts управляет каталогом артефактов одного запуска: журналы и файлы
+// подсистем, results.json, report.html и манифест manifest.json со списком всех файлов.
+// Каталог называется по времени запуска, поэтому запуски не перезаписывают друг друга.
+type RunArtifacts struct {
+	Dir     string
+	Started time.Time
+
+	mu    sync.Mutex
+	files []ArtifactFile
+}
+
+// Структура ArtifactFile описывает файл артефакта в манифесте запуска.
+type ArtifactFile struct {
+	Path  string `json:"path"` // Путь относительно каталога запуска.
+	Kind  string `json:"kind"` // log, results, trace, stats, report.
+	Bytes int64  `json:"bytes"`
+}
+
+// Структура runManifest представляет манифест каталога запуска.
+type runManifest struct {
+	Started   time.Time      `json:"started"`
+	Finished  time.Time      `json:"finished"`
+	Args      []string       `json:"args"`
+	GoVersion string         `json:"go_version"`
+	OK        bool           `json:"ok"`
+	Files     []ArtifactFile `json:"files"`
+}
+
+// Функция NewRunArtifacts создает в root каталог запуска с именем по времени started.
+// Если каталог с таким именем уже есть (два запуска в одну секунду), добавляется номер.
+func NewRunArtifacts(root string, started time.Time) (*RunArtifacts, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	name := started.Format("20060102-150405")
+	dir := filepath.Join(root, name)
+	for i := 2; ; i++ {
+		err := os.Mkdir(dir, 0o755)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		dir = filepath.Join(root, fmt.Sprintf("%s-%d", name, i))
+	}
+	return &RunArtifacts{Dir: dir, Started: started}, nil
+}
+
+// Метод Path возвращает путь файла name в каталоге запуска и создает его подкаталоги.
+func (a *RunArtifacts) Path(name string) (string, error) {
+	path := filepath.Join(a.Dir, name)
+	return path, os.MkdirAll(filepath.Dir(path), 0o755)
+}
+
+// Метод Add вносит в манифест файл name, записанный в каталог запуска. Файлы, которых
+// нет (например, подсистема завершилась раньше, чем их записала), пропускаются.
+func (a *RunArtifacts) Add(name, kind string) {
+	info, err := os.Stat(filepath.Join(a.Dir, name))
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.files = append(a.files, ArtifactFile{Path: filepath.ToSlash(name), Kind: kind, Bytes: info.Size()})
+}
+
+// Метод WriteFile записывает файл name в каталог запуска и вносит его в манифест.
+func (a *RunArtifacts) WriteFile(name, kind string, data []byte) error {
+	path, err := a.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	a.Add(name, kind)
+	return nil
+}
+
+// Метод Close записывает манифест запуска. Вызывается последним, когда все файлы добавлены.
+func (a *RunArtifacts) Close(ok bool) error {
+	a.mu.Lock()
+	files := append([]ArtifactFile(nil), a.files...)
+	a.mu.Unlock()
+	manifest := runManifest{
+		Started:   a.Started,
+		Finished:  time.Now(),
+		Args:      os.Args[1:],
+		GoVersion: runtime.Version(),
+		OK:        ok,
+		Files:     files,
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(a.Dir, "manifest.json"), append(data, '\n'), 0o644)
+}
+
+// Функция subsystemArtifactArgs возвращает флаги, с которыми подсистема s записывает свои
+// файлы в каталог запуска, и создает для них подкаталог.
+func subsystemArtifactArgs(a *RunArtifacts, s Subsystem) ([]string, error) {
+	var args []string
+	for _, f := range s.Artifacts {
+		path, err := a.Path(filepath.Join(s.Name, f.File))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, f.Flag, path)
+	}
+	return args, nil
+}
+
+// Функция saveArtifacts записывает в каталог запуска журналы подсистем, results.json и
+// report.html и вносит в манифест файлы, записанные самими подсистемами.
+func saveArtifacts(a *RunArtifacts, selected []Subsystem, results []Result, summary ciSummary) error {
+	for i, r := range results {
+		log := strings.Join(r.Output, "\n") + "\n"
+		if err := a.WriteFile(filepath.Join("logs", r.Name+".log"), "log", []byte(log)); err != nil {
+			return err
+		}
+		for _, f := range selected[i].Artifacts {
+			a.Add(filepath.Join(r.Name, f.File), f.Kind)
+		}
+	}
+
+	var data bytes.Buffer
+	if err := writeSummary(&data, summary); err != nil {
+		return err
+	}
+	if err := a.WriteFile("results.json", "results", data.Bytes()); err != nil {
+		return err
+	}
+
+	data.Reset()
+	if err := reportTemplate.Execute(&data, struct {
+		Started time.Time
+		Summary ciSummary
+	}{a.Started, summary}); err != nil {
+		return err
+	}
+	return a.WriteFile("report.html", "report", data.Bytes())
+}
+
+// Шаблон отчета report.html: таблица статусов и сводки подсистем со ссылками на журналы.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Отчет по лабораторной работе {{.Started.Format "2006-01-02 15:04:05"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.ok { color: #070; } .error, .timeout { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Отчет по лабораторной работе</h1>
+<p>Запуск {{.Started.Format "2006-01-02 15:04:05"}}, общее время {{.Summary.ElapsedMS}} мс.</p>
+<table>
+<tr><th>Подсистема</th><th>Статус</th><th>Время, мс</th><th>Журнал</th></tr>
+{{range .Summary.Subsystems}}<tr><td>{{.Name}}</td><td class="{{.Status}}">{{.Status}}{{if .Error}}: {{.Error}}{{end}}</td><td>{{.ElapsedMS}}</td><td><a href="logs/{{.Name}}.log">{{.Name}}.log</a></td></tr>
+{{end}}</table>
+{{range .Summary.Subsystems}}<h2>{{.Name}}</h2>
+<ul>{{range .Summary}}<li>{{.}}</li>{{end}}{{range .Tail}}<li><code>{{.}}</code></li>{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// Структура runRecord представляет сохраненный запуск из каталога артефактов: манифест
+// и итоговую сводку results.json. История запусков — это сами каталоги запусков, отдельная
+// база данных не нужна.
+type runRecord struct {
+	ID       string // Имя каталога запуска.
+	Manifest runManifest
+	Summary  ciSummary
+}
+
+// Функция loadRuns читает запуски из каталога root в порядке времени запуска. Каталоги
+// без манифеста (запуск еще идет или был прерван) пропускаются.
+func loadRuns(root string) ([]runRecord, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var runs []runRecord
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		record := runRecord{ID: entry.Name()}
+		data, err := os.ReadFile(filepath.Join(root, entry.Name(), "manifest.json"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = json.Unmarshal(data, &record.Manifest)
+		}
+		if err == nil {
+			data, err = os.ReadFile(filepath.Join(root, entry.Name(), "results.json"))
+		}
+		if err == nil {
+			err = json.Unmarshal(data, &record.Summary)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("запуск %s: %w", entry.Name(), err)
+		}
+		runs = append(runs, record)
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Manifest.Started.Before(runs[j].Manifest.Started) })
+	return runs, nil
+}
+
+// Функция findRun ищет запуск по имени каталога; "last" означает последний запуск.
+func findRun(runs []runRecord, id string) (runRecord, error) {
+	if id == "last" && len(runs) > 0 {
+		return runs[len(runs)-1], nil
+	}
+	for _, r := range runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return runRecord{}, fmt.Errorf("запуск %q не найден", id)
+}
+
+// Функция splitTiming разбирает строку сводки вида "название: время ...". Двоеточие может
+// встречаться и в самом названии, поэтому выбирается первое, за которым следует длительность.
+func splitTiming(line string) (string, time.Duration, bool) {
+	for i := 0; ; {
+		j := strings.Index(line[i:], ": ")
+		if j < 0 {
+			return "", 0, false
+		}
+		i += j
+		value, _, _ := strings.Cut(line[i+2:], " ")
+		if d, err := time.ParseDuration(value); err == nil {
+			return line[:i], d, true
+		}
+		i += 2
+	}
+}
+
+// Функция summaryTimings извлекает из строк сводки время каждого названного замера.
+// Строки без длительности пропускаются.
+func summaryTimings(lines []string) map[string]time.Duration {
+	timings := make(map[string]time.Duration)
+	for _, line := range lines {
+		if name, d, ok := splitTiming(line); ok {
+			timings[name] = d
+		}
+	}
+	return timings
+}
+
+// Функция formatChange возвращает изменение времени от before к after в процентах.
+func formatChange(before, after time.Duration) string {
+	if before <= 0 {
+		return "—"
+	}
+	return fmt.Sprintf("%+.1f%%", (float64(after)/float64(before)-1)*100)
+}
+
+// Функция runHistoryCommand выполняет подкоманду history по каталогам запусков:
+//
+//	history list               выводит все запуски со статусом и временем подсистем
+//	history show ID|last       выводит сводку одного запуска
+//	history compare A B        сравнивает время подсистем и замеров двух запусков
+func runHistoryCommand(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	root := fs.String("artifacts", "runs", "каталог с каталогами запусков")
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) == 0 {
+		return errors.New("использование: history [-artifacts каталог] list|show ID|compare A B")
+	}
+	runs, err := loadRuns(*root)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	switch {
+	case args[0] == "list":
+		fmt.Fprintln(w, "Запуск\tНачало\tСтатус\tВремя\tПодсистемы\t")
+		for _, r := range runs {
+			status := "ok"
+			if !r.Summary.OK {
+				status = "ошибка"
+			}
+			var parts []string
+			for _, s := range r.Summary.Subsystems {
+				parts = append(parts, fmt.Sprintf("%s %s %dмс", s.Name, s.Status, s.ElapsedMS))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%dмс\t%s\t\n", r.ID, r.Manifest.Started.Format("2006-01-02 15:04:05"),
+				status, r.Summary.ElapsedMS, strings.Join(parts, ", "))
+		}
+
+	case args[0] == "show" && len(args) == 2:
+		r, err := findRun(runs, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Запуск %s (%s, %s, аргументы: %s), общее время %dмс\n", r.ID,
+			r.Manifest.Started.Format("2006-01-02 15:04:05"), r.Manifest.GoVersion, strings.Join(r.Manifest.Args, " "), r.Summary.ElapsedMS)
+		for _, s := range r.Summary.Subsystems {
+			fmt.Printf("\n%s: %s, %dмс\n", s.Name, s.Status, s.ElapsedMS)
+			if s.Error != "" {
+				fmt.Printf("  ошибка: %s\n", s.Error)
+			}
+			for _, line := range append(s.Summary, s.Tail...) {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+		return nil
+
+	case args[0] == "compare" && len(args) == 3:
+		a, err := findRun(runs, args[1])
+		if err != nil {
+			return err
+		}
+		b, err := findRun(runs, args[2])
+		if err != nil {
+			return err
+		}
+		// Подсистемы и замеры сопоставляются по названию; есть только в одном запуске — пропускаются.
+		fmt.Fprintf(w, "Замер\t%s\t%s\tИзменение\t\n", a.ID, b.ID)
+		fmt.Fprintf(w, "всего\t%dмс\t%dмс\t%s\t\n", a.Summary.ElapsedMS, b.Summary.ElapsedMS,
+			formatChange(time.Duration(a.Summary.ElapsedMS)*time.Millisecond, time.Duration(b.Summary.ElapsedMS)*time.Millisecond))
+		for _, sa := range a.Summary.Subsystems {
+			for _, sb := range b.Summary.Subsystems {
+				if sa.Name != sb.Name {
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%dмс\t%dмс\t%s\t\n", sa.Name, sa.ElapsedMS, sb.ElapsedMS,
+					formatChange(time.Duration(sa.ElapsedMS)*time.Millisecond, time.Duration(sb.ElapsedMS)*time.Millisecond))
+				ta, tb := summaryTimings(sa.Summary), summaryTimings(sb.Summary)
+				for _, line := range sa.Summary {
+					name, _, _ := splitTiming(line)
+					before, okA := ta[name]
+					after, okB := tb[name]
+					if okA && okB {
+						fmt.Fprintf(w, "  %s\t%v\t%v\t%s\t\n", name, before, after, formatChange(before, after))
+					}
+				}
+			}
+		}
+
+	default:
+		return errors.New("использование: history [-artifacts каталог] list|show ID|compare A B")
+	}
+	return w.Flush()
+}
+
+// Функция logResult выводит в журнал режима -ci результат подсистемы.
+func logResult(r Result) {
+	fields := map[string]any{"subsystem": r.Name, "status": r.status(), "elapsed_ms": r.Elapsed.Milliseconds()}
+	if r.Err != nil {
+		fields["error"] = r.Err.Error()
+	}
+	logJSON("finish", fields)
+}
+
+// Основная функция программы: запуск всех подсистем и вывод общего отчета.
+func main() {
+	// Подкоманда просмотра истории запусков по каталогам артефактов.
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		if err := runHistoryCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	dir := flag.String("dir", ".", "каталог с программами лабораторной работы")
+	parallel := flag.Bool("parallel", false, "запускать подсистемы одновременно, а не по очереди")
+	only := flag.String("only", "", "запустить только перечисленные через запятую подсистемы")
+	timeout := flag.Duration("timeout", 10*time.Minute, "ограничение времени всего запуска")
+	verbose := flag.Bool("v", false, "выводить полный вывод каждой подсистемы")
+	ci := flag.Bool("ci", false, "режим для автоматической проверки: журнал только в JSON, сводка в JSON, ограничение времени каждой подсистемы, подсистемы без интерактива")
+	summaryPath := flag.String("summary", "", "записать итоговую сводку в JSON-файл (в режиме -ci по умолчанию — в stdout)")
+	summaryFD := flag.Int("summary-fd", 0, "записать итоговую сводку в JSON в дескриптор, открытый родительским процессом, например 3")
+	artifactsRoot := flag.String("artifacts", "runs", "каталог для каталогов запусков с артефактами (пустая строка — не сохранять)")
+	stepTimeout := flag.Duration("subsystem-timeout", 0, "ограничение времени одной подсистемы (0 — без ограничения, в режиме -ci — 5m)")
+	flag.Parse()
+	if err := applyEnv(flag.CommandLine, ""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// В режиме -ci каждая подсистема ограничена по времени, даже если ограничение не задано.
+	if *ci && *stepTimeout == 0 {
+		*stepTimeout = 5 * time.Minute
+	}
+	// Ошибки разбора параметров в режиме -ci тоже выводятся в JSON.
+	fail := func(err error) {
+		if *ci {
+			logJSON("error", map[string]any{"error": err.Error()})
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+
+	selected, err := selectSubsystems(*only)
+	if err != nil {
+		fail(err)
+	}
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	start := time.Now()
+	var art *RunArtifacts
+	if *artifactsRoot != "" {
+		// Подсистемы запускаются в каталоге -dir, поэтому пути артефактов должны быть абсолютными.
+		artRoot, err := filepath.Abs(*artifactsRoot)
+		if err == nil {
+			art, err = NewRunArtifacts(artRoot, start)
+		}
+		if err != nil {
+			fail(err)
+		}
+	}
+	results := make([]Result, len(selected))
+	if *parallel {
+		// Одновременный запуск быстрее, но подсистемы делят процессор, и их время
+		// нельзя сравнивать с последовательным запуском.
+		var wg sync.WaitGroup
+		for i, s := range selected {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if *ci {
+					logJSON("start", map[string]any{"subsystem": s.Name, "file": s.File})
+				}
+				results[i] = run(ctx, root, s, *stepTimeout, *ci, art)
+				if *ci {
+					logResult(results[i])
+				}
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i, s := range selected {
+			if *ci {
+				logJSON("start", map[string]any{"subsystem": s.Name, "file": s.File, "index": i + 1, "total": len(selected)})
+			} else {
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s (%s)...\n", i+1, len(selected), s.Name, s.File)
+			}
+			results[i] = run(ctx, root, s, *stepTimeout, *ci, art)
+			if *ci {
+				logResult(results[i])
+			}
+		}
+	}
+	total := time.Since(start)
+
+	if !*ci {
+		printReport(results, total, *verbose)
+	}
+	// Сводка пишется в файл -summary или дескриптор -summary-fd, а в режиме -ci без них — в stdout.
+	// Дескриптор задается только явно: среда выполнения Go сама держит открытыми файлы
+	// ограничений cgroup, и свободный на вид дескриптор 3 может принадлежать ей.
+	summary := newSummary(results, total)
+	var summaryOut io.Writer
+	switch {
+	case *summaryPath != "":
+		file, err := os.Create(*summaryPath)
+		if err != nil {
+			fail(err)
+		}
+		defer file.Close()
+		summaryOut = file
+	case *summaryFD > 0:
+		summaryOut = os.NewFile(uintptr(*summaryFD), "summary-fd")
+	case *ci:
+		summaryOut = os.Stdout
+	}
+	if summaryOut != nil {
+		if err := writeSummary(summaryOut, summary); err != nil {
+			fail(err)
+		}
+	}
+	if art != nil {
+		err := saveArtifacts(art, selected, results, summary)
+		if err == nil {
+			err = art.Close(summary.OK)
+		}
+		if err != nil {
+			fail(err)
+		}
+		if *ci {
+			logJSON("artifacts", map[string]any{"dir": art.Dir})
+		} else {
+			fmt.Printf("\nАртефакты запуска: %s\n", art.Dir)
+		}
+	}
+	if *ci {
+		logJSON("done", map[string]any{"ok": summary.OK, "elapsed_ms": summary.ElapsedMS})
+	}
+	if !summary.OK {
+		os.Exit(1)
+	}
+}
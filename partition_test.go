@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// Функция TestPartition проверяет разбиение partition на границах: частей больше, чем
+// элементов, пустые данные, неположительное число частей и большие остатки.
+// Запуск: go test 2t1.go partition_test.go (или с 2t2.go).
+func TestPartition(t *testing.T) {
+	tests := []struct {
+		name      string
+		n, parts  int
+		wantParts int
+	}{
+		{name: "n < parts", n: 2, parts: 5, wantParts: 2},
+		{name: "n == 0", n: 0, parts: 3, wantParts: 0},
+		{name: "parts == 0", n: 10, parts: 0, wantParts: 0},
+		{name: "parts < 0", n: 10, parts: -1, wantParts: 0},
+		{name: "n = 5, parts = 3", n: 5, parts: 3, wantParts: 3},
+		{name: "без остатка", n: 9, parts: 3, wantParts: 3},
+		{name: "одна часть", n: 7, parts: 1, wantParts: 1},
+		{name: "n == parts", n: 4, parts: 4, wantParts: 4},
+		{name: "большой остаток", n: 1000003, parts: 1000, wantParts: 1000},
+		{name: "остаток parts-1", n: 199, parts: 100, wantParts: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := partition(tt.n, tt.parts)
+			if len(ranges) != tt.wantParts {
+				t.Fatalf("partition(%d, %d): частей %d, ожидалось %d", tt.n, tt.parts, len(ranges), tt.wantParts)
+			}
+			if len(ranges) == 0 {
+				return
+			}
+
+			// Части идут подряд и покрывают [0, n) без пропусков и пересечений.
+			if ranges[0][0] != 0 || ranges[len(ranges)-1][1] != tt.n {
+				t.Fatalf("partition(%d, %d): части покрывают [%d, %d), ожидалось [0, %d)",
+					tt.n, tt.parts, ranges[0][0], ranges[len(ranges)-1][1], tt.n)
+			}
+			minSize, maxSize := tt.n, 0
+			for i, r := range ranges {
+				if i > 0 && r[0] != ranges[i-1][1] {
+					t.Fatalf("partition(%d, %d): часть %d начинается с %d, а предыдущая кончается на %d",
+						tt.n, tt.parts, i, r[0], ranges[i-1][1])
+				}
+				size := r[1] - r[0]
+				if size <= 0 {
+					t.Fatalf("partition(%d, %d): часть %d пустая: %v", tt.n, tt.parts, i, r)
+				}
+				minSize, maxSize = min(minSize, size), max(maxSize, size)
+			}
+			if maxSize-minSize > 1 {
+				t.Errorf("partition(%d, %d): размеры частей от %d до %d, разница больше 1", tt.n, tt.parts, minSize, maxSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+// Функция streamWorkers передает yield n синтетических работников частями по chunk записей.
+// Буфер части один на весь поток, поэтому объем данных не ограничен памятью.
+// Возраст записи i равен 18 + i%50, должность — "Р" для четных i и "Д" для нечетных.
+func streamWorkers(n, chunk int, yield func([]Worker)) {
+	buf := make([]Worker, chunk)
+	for start := 0; start < n; start += chunk {
+		part := buf[:min(chunk, n-start)]
+		for j := range part {
+			i := start + j
+			part[j].Age = 18 + i%50
+			part[j].Position = "Д"
+			if i%2 == 0 {
+				part[j].Position = "Р"
+			}
+		}
+		yield(part)
+	}
+}
+
+// Функция TestSumAgesStreaming суммирует возраст синтетических записей потоком частей:
+// суммы и количества частей объединяются через addInt64, как результаты горутин.
+// По умолчанию проверяется 20 млн записей (с -short — 2 млн); с LAB4_LONG_TESTS=1 —
+// 2 млрд, итоговая сумма (42 млрд) тогда не помещается в int32 и uint32.
+// Запуск: go test 2t1.go sumages_test.go (или с 2t2.go).
+func TestSumAgesStreaming(t *testing.T) {
+	n := 20_000_000
+	switch {
+	case os.Getenv("LAB4_LONG_TESTS") == "1":
+		n = 2_000_000_000
+	case testing.Short():
+		n = 2_000_000
+	}
+	const chunk = 1_000_000
+
+	var totalAge, count int64
+	streamWorkers(n, chunk, func(part []Worker) {
+		age, c := sumAges(part, "Р")
+		totalAge = addInt64(totalAge, age)
+		count = addInt64(count, c)
+	})
+
+	// В каждых 50 записях 25 четных с возрастами 18, 20, ..., 66: сумма 1050.
+	wantAge, wantCount := int64(n/50)*1050, int64(n/2)
+	if totalAge != wantAge || count != wantCount {
+		t.Fatalf("записей %d: сумма возрастов %d, количество %d, ожидалось %d и %d",
+			n, totalAge, count, wantAge, wantCount)
+	}
+	if avg := float64(totalAge) / float64(count); avg != 42 {
+		t.Errorf("средний возраст %v, ожидалось 42", avg)
+	}
+}
+
+// Функция TestAddInt64Overflow проверяет, что addInt64 аварийно завершается при переполнении
+// в обе стороны и складывает числа у границ диапазона без переполнения.
+func TestAddInt64Overflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     int64
+		overflow bool
+	}{
+		{name: "MaxInt64 + 1", a: math.MaxInt64, b: 1, overflow: true},
+		{name: "MinInt64 - 1", a: math.MinInt64, b: -1, overflow: true},
+		{name: "MaxInt64 + MaxInt64", a: math.MaxInt64, b: math.MaxInt64, overflow: true},
+		{name: "MaxInt64 - 1 + 1", a: math.MaxInt64 - 1, b: 1},
+		{name: "MinInt64 + MaxInt64", a: math.MinInt64, b: math.MaxInt64},
+		{name: "MaxInt64 + 0", a: math.MaxInt64, b: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.overflow {
+					t.Errorf("addInt64(%d, %d): паника %v, ожидалась: %t", tt.a, tt.b, r, tt.overflow)
+				}
+			}()
+			if sum := addInt64(tt.a, tt.b); sum != tt.a+tt.b {
+				t.Errorf("addInt64(%d, %d) = %d, ожидалось %d", tt.a, tt.b, sum, tt.a+tt.b)
+			}
+		})
+	}
+}
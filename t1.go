@@ -1,8 +1,21 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math"
 	"math/rand"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,59 +29,1214 @@ func generateRandomASCII() byte {
 	return byte(rand.Intn(94) + 33)
 }
 
-// StopWatch обертка для измерения времени выполнения функции
+// WorkUnit единица работы, которую тесты выполняют внутри и вне критической секции.
+// Вместо печати случайного символа каждый примитив нагружается одинаковой,
+// управляемой работой, поэтому результаты разных примитивов можно сравнивать
+type WorkUnit interface {
+	Name() string
+	Do() uint64 // Результат возвращается, чтобы компилятор не выбросил работу
+}
+
+// Названия единиц работы для флага -work
+var workUnits = []string{"cpu", "memory", "sleep"}
+
+// newWorkUnit создает единицу работы по названию
+func newWorkUnit(name string) (WorkUnit, error) {
+	switch name {
+	case "cpu":
+		return cpuWork{iterations: 1000}, nil
+	case "memory":
+		return newMemoryWork(1<<20, 64), nil
+	case "sleep":
+		return sleepWork{d: 10 * time.Microsecond}, nil
+	}
+	return nil, fmt.Errorf("unknown work unit %q (expected one of: %s)", name, strings.Join(workUnits, ", "))
+}
+
+// cpuWork вычислительная работа: iterations шагов хеша FNV-1a
+type cpuWork struct {
+	iterations int
+}
+
+func (w cpuWork) Name() string { return fmt.Sprintf("cpu(%d iterations)", w.iterations) }
+
+func (w cpuWork) Do() uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < w.iterations; i++ {
+		h ^= uint64(i)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// memoryWork работа с памятью: чтение по одному байту из каждой строки кэша
+// общего буфера, который не помещается в кэш первого уровня
+type memoryWork struct {
+	buf    []byte
+	stride int
+}
+
+// newMemoryWork создает работу с памятью над буфером size байт с шагом stride
+func newMemoryWork(size, stride int) memoryWork {
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	return memoryWork{buf: buf, stride: stride}
+}
+
+func (w memoryWork) Name() string { return fmt.Sprintf("memory(%d KiB)", len(w.buf)>>10) }
+
+func (w memoryWork) Do() uint64 {
+	var sum uint64
+	for i := 0; i < len(w.buf); i += w.stride {
+		sum += uint64(w.buf[i])
+	}
+	return sum
+}
+
+// sleepWork ожидание без нагрузки на процессор (имитация ввода-вывода)
+type sleepWork struct {
+	d time.Duration
+}
+
+func (w sleepWork) Name() string { return fmt.Sprintf("sleep(%v)", w.d) }
+
+func (w sleepWork) Do() uint64 {
+	time.Sleep(w.d)
+	return 0
+}
+
+// Работа, выполняемая тестами (задается флагом -work в main)
+var work WorkUnit = cpuWork{iterations: 1000}
+
+// cpuModel возвращает модель процессора из /proc/cpuinfo (или архитектуру, если она недоступна)
+func cpuModel() string {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return runtime.GOARCH
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "model name") {
+			if i := strings.Index(line, ":"); i >= 0 {
+				return strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return runtime.GOARCH
+}
+
+// environment параметры окружения и нагрузки, при которых получены результаты
+type environment struct {
+	GoVersion  string `json:"go_version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	CPU        string `json:"cpu"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	Goroutines int    `json:"goroutines"` // Горутин в каждом тесте
+	Work       string `json:"work"`
+}
+
+// currentEnvironment снимает параметры текущего окружения
+func currentEnvironment() environment {
+	return environment{
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		CPU:        cpuModel(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: numGoroutines,
+		Work:       work.Name(),
+	}
+}
+
+// printEnvironment выводит параметры окружения, чтобы результаты с разных машин были сравнимы
+func printEnvironment() {
+	env := currentEnvironment()
+	out.Printf("Go: %s, OS: %s/%s, CPU: %s, GOMAXPROCS: %d, Goroutines per test: %d, Work: %s\n\n",
+		env.GoVersion, env.OS, env.Arch, env.CPU, env.GOMAXPROCS, env.Goroutines, env.Work)
+}
+
+// cpuTime возвращает процессорное время процесса по оценке среды выполнения Go: время,
+// когда процессоры планировщика были заняты кодом программы, сборкой мусора и прочей работой
+// среды. runtime/metrics доступен на любой ОС, в отличие от getrusage. Метрики обновляются
+// при сборке мусора, поэтому перед чтением она запускается принудительно
+func cpuTime() time.Duration {
+	runtime.GC()
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	busy := samples[0].Value.Float64() - samples[1].Value.Float64()
+	return time.Duration(busy * float64(time.Second))
+}
+
+// schedStats накопленные показатели планировщика и сборщика мусора из runtime/metrics.
+// Разница снимков до и после сценария объясняет аномалии во времени: лишние горутины,
+// неожиданные сборки мусора и паузы с остановкой мира
+type schedStats struct {
+	GoroutinesCreated uint64
+	GCCycles          uint64
+	STWPause          time.Duration // Суммарная пауза с остановкой мира (сборка мусора и прочие)
+}
+
+// Метрики runtime/metrics, из которых собирается schedStats
+var schedMetrics = []string{
+	"/sched/goroutines-created:goroutines",
+	"/gc/cycles/total:gc-cycles",
+	"/sched/pauses/total/gc:seconds",
+	"/sched/pauses/total/other:seconds",
+}
+
+// readSchedStats снимает текущие показатели. Метрики, которых нет в этой версии Go, остаются нулевыми
+func readSchedStats() schedStats {
+	samples := make([]metrics.Sample, len(schedMetrics))
+	for i, name := range schedMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	var s schedStats
+	for _, sample := range samples {
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			if sample.Name == schedMetrics[0] {
+				s.GoroutinesCreated = sample.Value.Uint64()
+			} else {
+				s.GCCycles = sample.Value.Uint64()
+			}
+		case metrics.KindFloat64Histogram:
+			s.STWPause += histogramTotal(sample.Value.Float64Histogram())
+		}
+	}
+	return s
+}
+
+// histogramTotal оценивает сумму значений гистограммы пауз: каждое значение считается
+// равным середине своего интервала (для крайних бесконечных интервалов — конечной границе)
+func histogramTotal(h *metrics.Float64Histogram) time.Duration {
+	var total float64
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		var mid float64
+		switch {
+		case math.IsInf(lo, -1):
+			mid = hi
+		case math.IsInf(hi, 1):
+			mid = lo
+		default:
+			mid = (lo + hi) / 2
+		}
+		total += float64(count) * mid
+	}
+	return time.Duration(total * float64(time.Second))
+}
+
+// sub возвращает разницу показателей s и более раннего снимка before
+func (s schedStats) sub(before schedStats) schedStats {
+	return schedStats{
+		GoroutinesCreated: s.GoroutinesCreated - before.GoroutinesCreated,
+		GCCycles:          s.GCCycles - before.GCCycles,
+		STWPause:          s.STWPause - before.STWPause,
+	}
+}
+
+// ScenarioResult результат одного сценария для экспорта (флаг -export)
+type ScenarioResult struct {
+	Name              string        `json:"name"`
+	Wall              time.Duration `json:"wall_ns"`
+	CPU               time.Duration `json:"cpu_ns"`
+	GOMAXPROCS        int           `json:"gomaxprocs"`
+	GoroutinesCreated uint64        `json:"goroutines_created"`
+	GCCycles          uint64        `json:"gc_cycles"`
+	STWPause          time.Duration `json:"stw_pause_ns"`
+}
+
+// Результаты всех сценариев в порядке запуска
+var results []ScenarioResult
+
+// exportHeader первая запись экспорта: окружение, общее для всех сценариев
+type exportHeader struct {
+	Environment environment `json:"environment"`
+}
+
+// exportResults записывает результаты сценариев в path в формате JSON Lines.
+// Первой строкой идет exportHeader, чтобы результаты с разных машин можно было сравнивать
+func exportResults(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	if err := enc.Encode(exportHeader{Environment: currentEnvironment()}); err != nil {
+		f.Close()
+		return err
+	}
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// StopWatch обертка для измерения времени выполнения функции.
+// Кроме времени выводит затраченное процессорное время и его отношение ко времени
+// выполнения (сколько ядер в среднем было занято): спин-примитивы могут работать
+// не дольше блокирующих, но при этом жечь процессор, пока ждут.
+// Показатели планировщика за время сценария выводятся и сохраняются в results
 func StopWatch(name string, f func()) {
+	// cpuTime запускает сборку мусора, поэтому вызывается вне замеров времени и планировщика.
+	// Время самой принудительной сборки попадает в конечный замер, поэтому оно оценивается
+	// двумя вызовами подряд и вычитается
+	cpuStart := cpuTime()
+	cpuOverhead := cpuTime() - cpuStart
+	cpuStart += cpuOverhead
+	sched := readSchedStats()
 	start := time.Now()
 	f()
 	duration := time.Since(start)
-	fmt.Printf("%s Time: %v\n", name, duration)
+	sched = readSchedStats().sub(sched)
+	cpu := max(cpuTime()-cpuStart-cpuOverhead, 0)
+	out.Printf("%s Time: %v, CPU: %v, CPU cost: %.2f cores, goroutines: %d, GC: %d, STW: %v\n", name, duration, cpu,
+		cpu.Seconds()/duration.Seconds(), sched.GoroutinesCreated, sched.GCCycles, sched.STWPause)
+	results = append(results, ScenarioResult{
+		Name:              name,
+		Wall:              duration,
+		CPU:               cpu,
+		GOMAXPROCS:        runtime.GOMAXPROCS(0),
+		GoroutinesCreated: sched.GoroutinesCreated,
+		GCCycles:          sched.GCCycles,
+		STWPause:          sched.STWPause,
+	})
+}
+
+// logger вывод результатов тестов. Все сценарии печатают через общий logger out,
+// чтобы способ вывода можно было переключить флагом -sync-output
+type logger interface {
+	Printf(format string, args ...any)
+	Flush()
+}
+
+// Общий вывод всех сценариев (задается в main)
+var out logger = &syncLogger{w: os.Stdout}
+
+// syncLogger синхронный вывод: каждая строка сразу пишется в w отдельным вызовом,
+// и горутины, печатающие одновременно, выстраиваются в очередь на запись
+type syncLogger struct {
+	w io.Writer
+}
+
+func (l *syncLogger) Printf(format string, args ...any) { fmt.Fprintf(l.w, format, args...) }
+func (l *syncLogger) Flush()                            {}
+
+// AsyncLogger асинхронный вывод: строки складываются в кольцевой буфер, а одна
+// горутина-писатель забирает их пачками и пишет в w через буфер. Вызывающий
+// не ждет записи, только форматирует строку; при переполнении буфера он ждет,
+// пока писатель освободит место
+type AsyncLogger struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *CondCtx
+	idle     *sync.Cond
+	ring     []string
+	head     int
+	size     int
+	writing  bool
+	closed   bool
+	done     chan struct{} // Закрывается при выходе писателя
+	w        *bufio.Writer
+}
+
+// errLoggerClosed ошибка PrintfContext после Close
+var errLoggerClosed = errors.New("async logger closed")
+
+// NewAsyncLogger создает асинхронный вывод в w с буфером на capacity строк
+// и запускает горутину-писателя
+func NewAsyncLogger(w io.Writer, capacity int) *AsyncLogger {
+	l := &AsyncLogger{ring: make([]string, capacity), done: make(chan struct{}), w: bufio.NewWriter(w)}
+	l.notEmpty = sync.NewCond(&l.mu)
+	l.notFull = NewCondCtx(&l.mu)
+	l.idle = sync.NewCond(&l.mu)
+	go l.run()
+	return l
+}
+
+// Printf форматирует строку и кладет ее в буфер
+func (l *AsyncLogger) Printf(format string, args ...any) {
+	l.PrintfContext(context.Background(), format, args...)
+}
+
+// PrintfContext как Printf, но при заполненном буфере ждет места не дольше,
+// чем позволяет ctx, и возвращает ошибку контекста, если строка не попала в буфер.
+// После Close строки не принимаются
+func (l *AsyncLogger) PrintfContext(ctx context.Context, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errLoggerClosed
+	}
+	for l.size == len(l.ring) {
+		if err := l.notFull.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	l.ring[(l.head+l.size)%len(l.ring)] = msg
+	l.size++
+	l.notEmpty.Signal()
+	return nil
+}
+
+// Flush ждет, пока все отправленные строки не будут записаны
+func (l *AsyncLogger) Flush() {
+	l.mu.Lock()
+	for l.size > 0 || l.writing {
+		l.idle.Wait()
+	}
+	l.mu.Unlock()
+}
+
+// Close дописывает отправленные строки, останавливает горутину-писателя и ждет ее выхода.
+// Если писатель заблокирован на записи в w, Close ждет, пока запись не завершится
+func (l *AsyncLogger) Close() {
+	l.mu.Lock()
+	l.closed = true
+	l.notEmpty.Signal()
+	l.mu.Unlock()
+	<-l.done
+}
+
+// run горутина-писатель: забирает из буфера все накопившиеся строки и пишет их одной пачкой.
+// Завершается после Close, когда буфер опустеет
+func (l *AsyncLogger) run() {
+	defer close(l.done)
+	var batch []string
+	for {
+		l.mu.Lock()
+		for l.size == 0 && !l.closed {
+			l.notEmpty.Wait()
+		}
+		if l.size == 0 {
+			l.mu.Unlock()
+			return
+		}
+		batch = batch[:0]
+		for ; l.size > 0; l.size-- {
+			batch = append(batch, l.ring[l.head])
+			l.ring[l.head] = ""
+			l.head = (l.head + 1) % len(l.ring)
+		}
+		l.writing = true
+		l.notFull.Broadcast()
+		l.mu.Unlock()
+
+		for _, msg := range batch {
+			l.w.WriteString(msg)
+		}
+		l.w.Flush()
+
+		l.mu.Lock()
+		l.writing = false
+		l.idle.Broadcast()
+		l.mu.Unlock()
+	}
+}
+
+// Тест Output: numGoroutines горутин печатают по lines строк через l.
+// Показывает, сколько времени сценарии теряют на конкуренции за вывод
+func testOutput(l logger, lines int) {
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				l.Printf("goroutine %d: line %d %c\n", id, j, generateRandomASCII())
+			}
+		}(i)
+	}
+	wg.Wait()
+	l.Flush()
+}
+
+// TimerPool пул таймеров для повторных попыток и ожидания с таймаутом.
+// time.After создает новый таймер на каждый вызов, а пул переиспользует
+// остановленные таймеры, поэтому горячий цикл не выделяет память
+type TimerPool struct {
+	p sync.Pool
+}
+
+// Get возвращает таймер, который сработает через d
+func (tp *TimerPool) Get(d time.Duration) *time.Timer {
+	if t, ok := tp.p.Get().(*time.Timer); ok {
+		t.Reset(d)
+		return t
+	}
+	return time.NewTimer(d)
+}
+
+// Put останавливает таймер и возвращает его в пул. Если таймер уже сработал,
+// а значение не прочитано, канал очищается, чтобы следующий Get не получил старое срабатывание
+func (tp *TimerPool) Put(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	tp.p.Put(t)
+}
+
+// Sleep ждет d на таймере из пула
+func (tp *TimerPool) Sleep(d time.Duration) {
+	t := tp.Get(d)
+	<-t.C
+	tp.p.Put(t) // Таймер сработал и канал прочитан, останавливать нечего
+}
+
+// Общий пул таймеров программы
+var timers TimerPool
+
+// DebugMutex мьютекс для отладки упражнений: запоминает горутину-владельца и аварийно
+// завершает программу с понятным сообщением при повторном захвате той же горутиной
+// (sync.Mutex в этом случае молча зависает) и при освобождении не владельцем
+// (sync.Mutex это разрешает, и ошибка проявляется позже в другом месте)
+type DebugMutex struct {
+	mu    sync.Mutex
+	owner atomic.Uint64 // Номер горутины-владельца, 0 — мьютекс свободен
+}
+
+func (m *DebugMutex) Lock() {
+	gid := goroutineID()
+	if m.owner.Load() == gid {
+		panic(fmt.Sprintf("DebugMutex: повторный захват горутиной %d, которая уже владеет мьютексом", gid))
+	}
+	m.mu.Lock()
+	m.owner.Store(gid)
+}
+
+func (m *DebugMutex) Unlock() {
+	gid := goroutineID()
+	switch owner := m.owner.Load(); owner {
+	case 0:
+		panic(fmt.Sprintf("DebugMutex: горутина %d освобождает свободный мьютекс", gid))
+	case gid:
+	default:
+		panic(fmt.Sprintf("DebugMutex: горутина %d освобождает мьютекс, которым владеет горутина %d", gid, owner))
+	}
+	m.owner.Store(0)
+	m.mu.Unlock()
+}
+
+// goroutineID возвращает номер текущей горутины из заголовка ее стека
+// ("goroutine 42 [running]:"). Go не дает этот номер напрямую, поэтому функция
+// годится только для отладки
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	fields := strings.Fields(string(buf[:n]))
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(fields[1], 10, 64)
+	return id
+}
+
+// ReentrantMutex мьютекс, который горутина-владелец может захватывать повторно:
+// повторный Lock только увеличивает глубину, мьютекс освобождается, когда число
+// Unlock сравняется с числом Lock. Владелец определяется через goroutineID, разбор
+// стека занимает единицы микросекунд на каждый Lock и Unlock, поэтому захват
+// в сотни раз дороже sync.Mutex (см. сценарии LockCost). Повторный захват удобен,
+// когда методы под мьютексом вызывают друг друга, но скрывает, какой код на самом
+// деле выполняется под блокировкой
+type ReentrantMutex struct {
+	mu    sync.Mutex
+	owner atomic.Uint64 // Номер горутины-владельца, 0 — мьютекс свободен
+	depth int           // Глубина захвата, меняется только владельцем
+}
+
+func (m *ReentrantMutex) Lock() {
+	gid := goroutineID()
+	if m.owner.Load() == gid {
+		m.depth++
+		return
+	}
+	m.mu.Lock()
+	m.owner.Store(gid)
+	m.depth = 1
+}
+
+func (m *ReentrantMutex) Unlock() {
+	gid := goroutineID()
+	if owner := m.owner.Load(); owner != gid {
+		panic(fmt.Sprintf("ReentrantMutex: горутина %d освобождает мьютекс, которым владеет горутина %d", gid, owner))
+	}
+	m.depth--
+	if m.depth > 0 {
+		return
+	}
+	m.owner.Store(0)
+	m.mu.Unlock()
+}
+
+// Depth возвращает глубину захвата, если мьютексом владеет текущая горутина, иначе 0
+func (m *ReentrantMutex) Depth() int {
+	if m.owner.Load() != goroutineID() {
+		return 0
+	}
+	return m.depth
+}
+
+// Тест LockCost: стоимость захвата без конкуренции. Одна горутина iterations раз
+// захватывает мьютекс depth раз подряд и столько же раз освобождает,
+// выводится время на одну пару Lock/Unlock
+func testLockCost(name string, mu sync.Locker, depth, iterations int) {
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		for j := 0; j < depth; j++ {
+			mu.Lock()
+		}
+		for j := 0; j < depth; j++ {
+			mu.Unlock()
+		}
+	}
+	out.Printf("%s: %v per Lock/Unlock\n", name, time.Since(start)/time.Duration(iterations*depth))
+}
+
+// Конструктор мьютексов для тестов Mutex и Monitor (флаг -debug-mutex заменяет его на DebugMutex)
+var newMutex = func() sync.Locker { return &sync.Mutex{} }
+
+// Тест Mutex: использует мьютекс для синхронизации доступа к общему ресурсу
+func testMutex(wg *sync.WaitGroup, mu sync.Locker) {
+	defer wg.Done()
+	mu.Lock()
+	work.Do() // Работа внутри критической секции
+	mu.Unlock()
+	work.Do() // Работа вне критической секции
+}
+
+// FIFOMutex мьютекс со строгой передачей владения по очереди: Unlock при наличии
+// ожидающих отдает мьютекс первому из них напрямую, и освободившая горутина не может
+// сразу перехватить его снова. sync.Mutex в обычном режиме такой перехват разрешает
+// и переходит к передаче по очереди (режим голодания) только после 1 мс ожидания
+type FIFOMutex struct {
+	mu      sync.Mutex
+	locked  bool
+	waiters []chan struct{}
+}
+
+func (m *FIFOMutex) Lock() {
+	m.mu.Lock()
+	if !m.locked {
+		m.locked = true
+		m.mu.Unlock()
+		return
+	}
+	ready := make(chan struct{})
+	m.waiters = append(m.waiters, ready)
+	m.mu.Unlock()
+	<-ready // Владение передается напрямую из Unlock
+}
+
+func (m *FIFOMutex) Unlock() {
+	m.mu.Lock()
+	if len(m.waiters) > 0 {
+		close(m.waiters[0])
+		m.waiters = m.waiters[1:]
+	} else {
+		m.locked = false
+	}
+	m.mu.Unlock()
+}
+
+// Тест MutexHandoff: горутины в течение duration захватывают мьютекс и сразу после
+// освобождения запрашивают его снова. Выводятся пропускная способность, перцентили
+// ожидания, доля повторных захватов той же горутиной подряд и справедливость:
+// перехват у sync.Mutex дает большую пропускную способность (владелец продолжает
+// работать без переключения), но длинный хвост ожидания у остальных
+func testMutexHandoff(name string, mu sync.Locker, duration time.Duration) {
+	var wg sync.WaitGroup
+	waits := make([][]time.Duration, numGoroutines)
+	last, repeats := -1, 0 // Предыдущий владелец и число повторных захватов (меняются под mu)
+	deadline := time.Now().Add(duration)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				mu.Lock()
+				waits[i] = append(waits[i], time.Since(start))
+				if last == i {
+					repeats++
+				}
+				last = i
+				work.Do() // Работа внутри критической секции
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	counts := make([]int, numGoroutines)
+	var all []time.Duration
+	for i, w := range waits {
+		counts[i] = len(w)
+		all = append(all, w...)
+	}
+	slices.Sort(all)
+	n := len(all)
+	out.Printf("%s: %.0f ops/s, wait p50 %v, p99 %v, max %v, repeat acquisitions: %.1f%%, fairness: %.3f\n", name,
+		float64(n)/duration.Seconds(), all[n/2], all[n*99/100], all[n-1], 100*float64(repeats)/float64(n), jainIndex(counts))
+}
+
+// Тест Semaphore: использует канал с буфером для ограничения количества одновременно работающих горутин
+func testSemaphore(wg *sync.WaitGroup, sem chan struct{}) {
+	defer wg.Done()
+	sem <- struct{}{} // Захват семафора
+	work.Do()         // Работа внутри критической секции
+	<-sem             // Освобождение семафора
+	work.Do()         // Работа вне критической секции
+}
+
+// Тест SemaphoreSlim: использует семафор с ограниченным количеством попыток захвата
+func testSemaphoreSlim(wg *sync.WaitGroup, sem chan struct{}, retries int) {
+	defer wg.Done()
+	for i := 0; i < retries; i++ {
+		select {
+		case sem <- struct{}{}: // Попытка захвата семафора
+			work.Do() // Работа внутри критической секции
+			<-sem     // Освобождение семафора
+			work.Do() // Работа вне критической секции
+			return
+		default:
+			timers.Sleep(time.Millisecond * 10) // Ожидание перед следующей попыткой
+		}
+	}
+}
+
+// Общий интерфейс для вариантов семафора в сравнительном тесте
+type semaphore interface {
+	Acquire()
+	Release()
+}
+
+// chanSemaphore семафор на основе канала с буфером (как в тесте Semaphore)
+type chanSemaphore chan struct{}
+
+func (s chanSemaphore) Acquire() { s <- struct{}{} }
+func (s chanSemaphore) Release() { <-s }
+
+// Semaphore собственная реализация семафора: счетчик разрешений и очередь ожидающих,
+// разрешения передаются ожидающим строго в порядке очереди (FIFO)
+type Semaphore struct {
+	mu      sync.Mutex
+	permits int
+	waiters []chan struct{}
+}
+
+// NewSemaphore создает семафор с n разрешениями
+func NewSemaphore(n int) *Semaphore {
+	return &Semaphore{permits: n}
+}
+
+// Acquire захватывает разрешение, при их отсутствии встает в конец очереди
+func (s *Semaphore) Acquire() {
+	s.mu.Lock()
+	if s.permits > 0 && len(s.waiters) == 0 {
+		s.permits--
+		s.mu.Unlock()
+		return
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	s.mu.Unlock()
+	<-ready // Разрешение передается напрямую из Release
+}
+
+// Release освобождает разрешение, передавая его первому ожидающему, если он есть
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	if len(s.waiters) > 0 {
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+	} else {
+		s.permits++
+	}
+	s.mu.Unlock()
+}
+
+// PrioritySemaphore семафор с приоритетами: освободившееся разрешение получает ожидающий
+// с наибольшим приоритетом, при равных — пришедший раньше. Чтобы поток захватов
+// с высоким приоритетом не морил голодом остальных, действующий приоритет ожидающего
+// растет на 1 за каждый интервал aging ожидания (aging = 0 — без старения)
+type PrioritySemaphore struct {
+	mu      sync.Mutex
+	permits int
+	aging   time.Duration
+	waiters []*priorityWaiter // В порядке прихода
+}
+
+type priorityWaiter struct {
+	priority int
+	since    time.Time
+	ready    chan struct{}
+}
+
+// NewPrioritySemaphore создает семафор с n разрешениями и интервалом старения aging
+func NewPrioritySemaphore(n int, aging time.Duration) *PrioritySemaphore {
+	return &PrioritySemaphore{permits: n, aging: aging}
+}
+
+// Acquire захватывает разрешение с наименьшим приоритетом 0
+func (s *PrioritySemaphore) Acquire() { s.AcquirePriority(0) }
+
+// AcquirePriority захватывает разрешение с приоритетом priority (больше — важнее)
+func (s *PrioritySemaphore) AcquirePriority(priority int) {
+	s.mu.Lock()
+	if s.permits > 0 && len(s.waiters) == 0 {
+		s.permits--
+		s.mu.Unlock()
+		return
+	}
+	w := &priorityWaiter{priority: priority, since: time.Now(), ready: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+	<-w.ready // Разрешение передается напрямую из Release
+}
+
+// Release освобождает разрешение, передавая его ожидающему с наибольшим действующим приоритетом
+func (s *PrioritySemaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiters) == 0 {
+		s.permits++
+		return
+	}
+	now := time.Now()
+	best, bestPriority := 0, s.effective(s.waiters[0], now)
+	for i, w := range s.waiters[1:] {
+		if p := s.effective(w, now); p > bestPriority {
+			best, bestPriority = i+1, p
+		}
+	}
+	close(s.waiters[best].ready)
+	s.waiters = slices.Delete(s.waiters, best, best+1)
+}
+
+// effective возвращает приоритет ожидающего с учетом старения
+func (s *PrioritySemaphore) effective(w *priorityWaiter, now time.Time) int {
+	if s.aging <= 0 {
+		return w.priority
+	}
+	return w.priority + int(now.Sub(w.since)/s.aging)
+}
+
+// jainIndex вычисляет индекс справедливости Джейна: 1 — все горутины получили доступ поровну
+func jainIndex(counts []int) float64 {
+	var sum, sumSq float64
+	for _, c := range counts {
+		sum += float64(c)
+		sumSq += float64(c) * float64(c)
+	}
+	if sumSq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(counts)) * sumSq)
+}
+
+// Тест вариантов семафора: горутины захватывают семафор в течение duration,
+// выводятся пропускная способность и справедливость распределения захватов
+func testSemaphoreVariant(name string, sem semaphore, duration time.Duration) {
+	var wg sync.WaitGroup
+	counts := make([]int, numGoroutines)
+	deadline := time.Now().Add(duration)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				sem.Acquire()
+				work.Do() // Работа внутри критической секции
+				sem.Release()
+				counts[i]++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	out.Printf("%s: %.0f ops/s, fairness: %.3f\n", name, float64(total)/duration.Seconds(), jainIndex(counts))
+}
+
+// Названия уровней приоритета в тесте PrioritySemaphore
+var priorityLevels = []string{"low", "mid", "high"}
+
+// Тест PrioritySemaphore: горутины с приоритетами low, mid и high (по номеру горутины)
+// захватывают семафор в течение duration. Выводятся пропускная способность и среднее
+// и максимальное ожидание для каждого приоритета: у FIFO-семафора ожидание от приоритета
+// не зависит, у семафора с приоритетами без старения низкий приоритет может ждать
+// весь тест, старение ограничивает его ожидание
+func testPrioritySemaphore(name string, acquire func(priority int), release func(), duration time.Duration) {
+	var wg sync.WaitGroup
+	waits := make([][]time.Duration, numGoroutines)
+	deadline := time.Now().Add(duration)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			priority := i % len(priorityLevels)
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				acquire(priority)
+				waits[i] = append(waits[i], time.Since(start))
+				work.Do() // Работа внутри критической секции
+				release()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	var report []string
+	for priority, level := range priorityLevels {
+		var sum, longest time.Duration
+		count := 0
+		for i := priority; i < numGoroutines; i += len(priorityLevels) {
+			for _, wait := range waits[i] {
+				sum += wait
+				longest = max(longest, wait)
+			}
+			count += len(waits[i])
+		}
+		total += count
+		avg := time.Duration(0)
+		if count > 0 {
+			avg = sum / time.Duration(count)
+		}
+		report = append(report, fmt.Sprintf("%s %v/%v", level, avg, longest.Round(time.Microsecond)))
+	}
+	out.Printf("%s: %.0f ops/s, wait avg/max: %s\n", name, float64(total)/duration.Seconds(), strings.Join(report, ", "))
+}
+
+// Общий интерфейс для вариантов барьера: Wait блокирует, пока все участники не дойдут до барьера
+type barrier interface {
+	Wait()
+}
+
+// wgBarrier одноразовый барьер на WaitGroup
+type wgBarrier struct {
+	wg sync.WaitGroup
+}
+
+func newWGBarrier(n int) barrier {
+	b := &wgBarrier{}
+	b.wg.Add(n)
+	return b
+}
+
+func (b *wgBarrier) Wait() {
+	b.wg.Done() // Уменьшение счетчика барьера
+	b.wg.Wait() // Ожидание, пока все горутины достигнут барьера
+}
+
+// condBarrier одноразовый барьер на условной переменной
+type condBarrier struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	n, arrived int
+}
+
+func newCondBarrier(n int) barrier {
+	b := &condBarrier{n: n}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *condBarrier) Wait() {
+	b.mu.Lock()
+	b.arrived++
+	if b.arrived == b.n {
+		b.cond.Broadcast() // Последний участник будит остальных
+	}
+	for b.arrived < b.n {
+		b.cond.Wait()
+	}
+	b.mu.Unlock()
+}
+
+// chanBarrier одноразовый барьер: последний участник закрывает канал
+type chanBarrier struct {
+	mu         sync.Mutex
+	n, arrived int
+	release    chan struct{}
+}
+
+func newChanBarrier(n int) barrier {
+	return &chanBarrier{n: n, release: make(chan struct{})}
+}
+
+func (b *chanBarrier) Wait() {
+	b.mu.Lock()
+	b.arrived++
+	if b.arrived == b.n {
+		close(b.release)
+	}
+	b.mu.Unlock()
+	<-b.release
+}
+
+// CyclicBarrier многоразовый барьер: после прохода всех участников сбрасывается
+// и может использоваться для следующей фазы
+type CyclicBarrier struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	n, count   int
+	generation int
+}
+
+// NewCyclicBarrier создает циклический барьер на n участников
+func NewCyclicBarrier(n int) *CyclicBarrier {
+	b := &CyclicBarrier{n: n}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Wait ожидает остальных участников текущей фазы
+func (b *CyclicBarrier) Wait() {
+	b.mu.Lock()
+	generation := b.generation
+	b.count++
+	if b.count == b.n {
+		// Последний участник открывает барьер и начинает новую фазу
+		b.count = 0
+		b.generation++
+		b.cond.Broadcast()
+	}
+	for generation == b.generation {
+		b.cond.Wait()
+	}
+	b.mu.Unlock()
+}
+
+// Тест Barrier: горутины проходят phases фаз, синхронизируясь на барьере в конце каждой.
+// После барьера проверяется атомарный счетчик фазы: все участники должны были прибыть
+// до того, как кто-либо продолжил. Возвращает количество нарушений.
+func testBarrier(newBarrier func(n int) barrier, reusable bool, phases int) int32 {
+	var wg sync.WaitGroup
+	var violations int32
+
+	// Одноразовым барьерам нужен отдельный экземпляр на каждую фазу
+	barriers := make([]barrier, phases)
+	for p := range barriers {
+		if reusable && p > 0 {
+			barriers[p] = barriers[0]
+		} else {
+			barriers[p] = newBarrier(numGoroutines)
+		}
+	}
+	arrived := make([]int32, phases)
+
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for p := 0; p < phases; p++ {
+				atomic.AddInt32(&arrived[p], 1)
+				barriers[p].Wait()
+				if atomic.LoadInt32(&arrived[p]) != numGoroutines {
+					atomic.AddInt32(&violations, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return violations
+}
+
+// Общий интерфейс для событий (оповещение одного-ко-многим): Set будит всех ожидающих,
+// Wait блокируется до Set, Reset возвращает событие в исходное состояние
+type event interface {
+	Set()
+	Wait()
+	Reset()
+}
+
+// ChanEvent событие на основе закрытия канала
+type ChanEvent struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// NewChanEvent создает несработавшее событие
+func NewChanEvent() *ChanEvent {
+	return &ChanEvent{ch: make(chan struct{})}
+}
+
+func (e *ChanEvent) Set() {
+	e.mu.Lock()
+	select {
+	case <-e.ch: // Уже установлено
+	default:
+		close(e.ch)
+	}
+	e.mu.Unlock()
+}
+
+func (e *ChanEvent) Wait() {
+	e.mu.Lock()
+	ch := e.ch
+	e.mu.Unlock()
+	<-ch
+}
+
+func (e *ChanEvent) Reset() {
+	e.mu.Lock()
+	select {
+	case <-e.ch:
+		e.ch = make(chan struct{}) // Закрытый канал заменяется новым
+	default:
+	}
+	e.mu.Unlock()
 }
 
-// Тест Mutex: использует мьютекс для синхронизации доступа к общему ресурсу
-func testMutex(wg *sync.WaitGroup, mu *sync.Mutex) {
-	defer wg.Done()
-	mu.Lock()
-	fmt.Printf("Mutex: %c\n", generateRandomASCII())
-	mu.Unlock()
+// CondEvent событие на основе условной переменной
+type CondEvent struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	set  bool
 }
 
-// Тест Semaphore: использует канал с буфером для ограничения количества одновременно работающих горутин
-func testSemaphore(wg *sync.WaitGroup, sem chan struct{}) {
-	defer wg.Done()
-	sem <- struct{}{} // Захват семафора
-	fmt.Printf("Semaphore: %c\n", generateRandomASCII())
-	<-sem // Освобождение семафора
+// NewCondEvent создает несработавшее событие
+func NewCondEvent() *CondEvent {
+	e := &CondEvent{}
+	e.cond = sync.NewCond(&e.mu)
+	return e
 }
 
-// Тест SemaphoreSlim: использует семафор с ограниченным количеством попыток захвата
-func testSemaphoreSlim(wg *sync.WaitGroup, sem chan struct{}, retries int) {
-	defer wg.Done()
-	for i := 0; i < retries; i++ {
-		select {
-		case sem <- struct{}{}: // Попытка захвата семафора
-			fmt.Printf("SemaphoreSlim: %c\n", generateRandomASCII())
-			<-sem // Освобождение семафора
-			return
-		default:
-			time.Sleep(time.Millisecond * 10) // Ожидание перед следующей попыткой
+func (e *CondEvent) Set() {
+	e.mu.Lock()
+	e.set = true
+	e.cond.Broadcast()
+	e.mu.Unlock()
+}
+
+func (e *CondEvent) Wait() {
+	e.mu.Lock()
+	for !e.set {
+		e.cond.Wait()
+	}
+	e.mu.Unlock()
+}
+
+func (e *CondEvent) Reset() {
+	e.mu.Lock()
+	e.set = false
+	e.mu.Unlock()
+}
+
+// Тест Event: измеряет задержку пробуждения ожидающих горутин после Set.
+// Выводит среднюю и максимальную задержку за rounds раундов.
+func testEvent(name string, ev event, rounds int) {
+	var total, worst time.Duration
+	var mu sync.Mutex
+	for r := 0; r < rounds; r++ {
+		var wg, ready sync.WaitGroup
+		var setAt time.Time
+		wg.Add(numGoroutines)
+		ready.Add(numGoroutines)
+		for i := 0; i < numGoroutines; i++ {
+			go func() {
+				defer wg.Done()
+				ready.Done()
+				ev.Wait()
+				latency := time.Since(setAt) // setAt записан до Set, Wait гарантирует видимость
+				mu.Lock()
+				total += latency
+				if latency > worst {
+					worst = latency
+				}
+				mu.Unlock()
+			}()
 		}
+		ready.Wait()
+		time.Sleep(100 * time.Microsecond) // Даём горутинам заблокироваться в Wait
+		setAt = time.Now()
+		ev.Set()
+		wg.Wait()
+		ev.Reset()
 	}
+	avg := total / time.Duration(rounds*numGoroutines)
+	out.Printf("%s wake-up latency: avg %v, max %v\n", name, avg, worst)
 }
 
-// Тест Barrier: использует WaitGroup для синхронизации горутин в точке барьера
-func testBarrier(wg *sync.WaitGroup, barrier *sync.WaitGroup) {
-	defer wg.Done()
-	barrier.Done() // Уменьшение счетчика барьера
-	barrier.Wait() // Ожидание, пока все горутины достигнут барьера
-	fmt.Printf("Barrier: %c\n", generateRandomASCII())
+// Тест ThreadPinning: горутина с чувствительной к задержкам критической секцией каждые
+// interval просыпается, захватывает общий мьютекс и измеряет опоздание пробуждения,
+// пока numGoroutines фоновых горутин нагружают процессор под тем же мьютексом.
+// При pinned горутина закреплена за потоком ОС через runtime.LockOSThread: поток
+// не обслуживает другие горутины, но пробуждение идет через планировщик ОС
+func testThreadPinning(name string, pinned bool, interval time.Duration, ticks int) {
+	var mu sync.Mutex
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				mu.Lock()
+				work.Do() // Короткая работа под общим мьютексом
+				mu.Unlock()
+				work.Do() // Фоновая нагрузка вне критической секции
+			}
+		}()
+	}
+
+	lateness := make([]time.Duration, ticks)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if pinned {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+		}
+		for i := range lateness {
+			wake := time.Now().Add(interval)
+			time.Sleep(interval)
+			mu.Lock()
+			lateness[i] = time.Since(wake) // Опоздание к моменту входа в критическую секцию
+			mu.Unlock()
+		}
+	}()
+	<-done
+	stop.Store(true)
+	wg.Wait()
+
+	slices.Sort(lateness)
+	var total time.Duration
+	for _, d := range lateness {
+		total += d
+	}
+	out.Printf("%s jitter: avg %v, p50 %v, p99 %v, max %v\n", name, total/time.Duration(ticks),
+		lateness[ticks/2], lateness[ticks*99/100], lateness[ticks-1])
 }
 
 // Тест SpinLock: использует атомарные операции для реализации спин-лока
 func testSpinLock(counter *int32) {
 	for {
 		if atomic.CompareAndSwapInt32(counter, 0, 1) { // Попытка захвата спин-лока
-			fmt.Printf("SpinLock: %c\n", generateRandomASCII())
+			work.Do()                     // Работа внутри критической секции
 			atomic.StoreInt32(counter, 0) // Освобождение спин-лока
+			work.Do()                     // Работа вне критической секции
 			break
 		}
 	}
@@ -84,24 +1252,734 @@ func testSpinWait() {
 		}
 		spinCount++
 	}
-	fmt.Printf("SpinWait: %c\n", generateRandomASCII())
+	work.Do() // Работа после ожидания
+}
+
+// CondCtx условная переменная, ожидание которой можно прервать контекстом (sync.Cond
+// этого не умеет). Каждый ожидающий ждет собственный канал: Signal закрывает канал
+// первого в очереди, Broadcast — каналы всех
+type CondCtx struct {
+	L       sync.Locker
+	mu      sync.Mutex // Защищает waiters
+	waiters []chan struct{}
+}
+
+// NewCondCtx создает условную переменную, связанную с l
+func NewCondCtx(l sync.Locker) *CondCtx {
+	return &CondCtx{L: l}
+}
+
+// Wait как sync.Cond.Wait освобождает L, ждет сигнала и снова захватывает L перед
+// возвратом, в том числе при отмене ctx. При отмене возвращается ошибка контекста;
+// если сигнал пришел одновременно с отменой, он не теряется и Wait возвращает nil
+func (c *CondCtx) Wait(ctx context.Context) error {
+	ready := make(chan struct{})
+	c.mu.Lock()
+	c.waiters = append(c.waiters, ready)
+	c.mu.Unlock()
+	c.L.Unlock()
+	defer c.L.Lock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := slices.Index(c.waiters, ready); i >= 0 {
+		c.waiters = slices.Delete(c.waiters, i, i+1)
+		return ctx.Err()
+	}
+	return nil // Signal уже выбрал этого ожидающего
+}
+
+// Signal будит самого давнего ожидающего, если он есть
+func (c *CondCtx) Signal() {
+	c.mu.Lock()
+	if len(c.waiters) > 0 {
+		close(c.waiters[0])
+		c.waiters = c.waiters[1:]
+	}
+	c.mu.Unlock()
+}
+
+// Broadcast будит всех ожидающих
+func (c *CondCtx) Broadcast() {
+	c.mu.Lock()
+	for _, ready := range c.waiters {
+		close(ready)
+	}
+	c.waiters = nil
+	c.mu.Unlock()
+}
+
+// Тест CondTimeout: никто не подает сигнал, поэтому каждое ожидание CondCtx
+// должно завершиться по таймауту с ошибкой контекста и захваченным мьютексом.
+// Затем то же проверяется для заполненного буфера AsyncLogger, писатель которого
+// заблокирован, и для заполненного BoundedBuffer без потребителей. Выводится число ожиданий, завершившихся правильно, и наибольшее
+// опоздание возврата после истечения таймаута
+func testCondTimeout(name string, timeout time.Duration) {
+	var mu sync.Mutex
+	cond := NewCondCtx(&mu)
+	var wg sync.WaitGroup
+	var timedOut atomic.Int32
+	lateness := make([]time.Duration, numGoroutines)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			deadline, _ := ctx.Deadline()
+			mu.Lock()
+			err := cond.Wait(ctx)
+			lateness[i] = time.Since(deadline)
+			if err == context.DeadlineExceeded && !mu.TryLock() { // Мьютекс должен быть захвачен
+				timedOut.Add(1)
+			}
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	out.Printf("%s: waits timed out: %d of %d, max lateness: %v\n", name, timedOut.Load(), numGoroutines, slices.Max(lateness))
+
+	// Буфер на одну строку: первая строка забирается писателем, который блокируется
+	// на записи в канал без читателя, вторая заполняет буфер, третья ждет места
+	r, w := io.Pipe()
+	l := NewAsyncLogger(w, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = l.PrintfContext(ctx, "line %d\n", i)
+	}
+	out.Printf("%s: full AsyncLogger: %v\n", name, err)
+
+	// Закрытие канала разблокирует писателя (запись вернет ошибку), после чего Close
+	// дождется его выхода
+	r.Close()
+	l.Close()
+
+	// Буфер на один элемент: первый Put заполняет его, второй ждет места до таймаута
+	b := NewBoundedBuffer(1)
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = nil
+	for i := 0; i < 2 && err == nil; i++ {
+		err = b.Put(ctx, i)
+	}
+	out.Printf("%s: full BoundedBuffer: %v\n", name, err)
+}
+
+// monitorState общее состояние теста Monitor под мьютексом mu. Сигнал подается только
+// после того, как начали ждать все горутины, а ожидающие проверяют флаг ready в цикле,
+// поэтому сигнал не теряется и не зависит от того, успели ли горутины заблокироваться
+type monitorState struct {
+	mu      sync.Locker
+	cond    *CondCtx // Сигнал горутинам продолжить
+	arrived *CondCtx // Очередная горутина начала ждать
+	waiting int
+	ready   bool
+}
+
+// newMonitorState создает состояние теста Monitor над мьютексом mu
+func newMonitorState(mu sync.Locker) *monitorState {
+	return &monitorState{mu: mu, cond: NewCondCtx(mu), arrived: NewCondCtx(mu)}
+}
+
+// broadcast дожидается, пока ждут n горутин, и будит их всех
+func (s *monitorState) broadcast(ctx context.Context, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.waiting < n {
+		if err := s.arrived.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	s.ready = true
+	s.cond.Broadcast()
+	return nil
 }
 
 // Тест Monitor: использует мьютекс и условную переменную для синхронизации
-func testMonitor(wg *sync.WaitGroup, mu *sync.Mutex, cond *sync.Cond) {
+func testMonitor(ctx context.Context, wg *sync.WaitGroup, s *monitorState) {
 	defer wg.Done()
-	mu.Lock()
-	cond.Wait() // Ожидание сигнала от условной переменной
-	fmt.Printf("Monitor: %c\n", generateRandomASCII())
-	mu.Unlock()
+	s.mu.Lock()
+	s.waiting++
+	s.arrived.Signal()
+	for !s.ready {
+		if err := s.cond.Wait(ctx); err != nil { // Ожидание сигнала от условной переменной
+			out.Printf("Monitor: %v\n", err)
+			break
+		}
+	}
+	work.Do() // Работа внутри критической секции
+	s.mu.Unlock()
+	work.Do() // Работа вне критической секции
+}
+
+// BoundedBuffer ограниченный буфер на CondCtx: Put ждет свободного места, Get — элемента,
+// и оба ожидания можно прервать контекстом
+type BoundedBuffer struct {
+	mu       sync.Mutex
+	notEmpty *CondCtx
+	notFull  *CondCtx
+	items    []int
+	head     int
+	size     int
+}
+
+// NewBoundedBuffer создает буфер на capacity элементов
+func NewBoundedBuffer(capacity int) *BoundedBuffer {
+	b := &BoundedBuffer{items: make([]int, capacity)}
+	b.notEmpty = NewCondCtx(&b.mu)
+	b.notFull = NewCondCtx(&b.mu)
+	return b
+}
+
+// Put кладет v в буфер, при заполненном буфере ждет места не дольше, чем позволяет ctx
+func (b *BoundedBuffer) Put(ctx context.Context, v int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.size == len(b.items) {
+		if err := b.notFull.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	b.items[(b.head+b.size)%len(b.items)] = v
+	b.size++
+	b.notEmpty.Signal()
+	return nil
+}
+
+// Get забирает самый давний элемент, при пустом буфере ждет не дольше, чем позволяет ctx
+func (b *BoundedBuffer) Get(ctx context.Context) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.size == 0 {
+		if err := b.notEmpty.Wait(ctx); err != nil {
+			return 0, err
+		}
+	}
+	v := b.items[b.head]
+	b.head = (b.head + 1) % len(b.items)
+	b.size--
+	b.notFull.Signal()
+	return v, nil
+}
+
+// Тест BoundedBuffer: половина горутин кладет в буфер на capacity элементов по items
+// чисел, другая половина столько же забирает. Выводится, сколько чисел прошло через
+// буфер и совпала ли их сумма с отправленной
+func testBoundedBuffer(name string, capacity, items int) {
+	// Таймаут только страхует от ошибки синхронизации: без нее все ожидания завершатся
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	b := NewBoundedBuffer(capacity)
+	pairs := max(numGoroutines/2, 1)
+	var wg sync.WaitGroup
+	var received, sum atomic.Int64
+	wg.Add(2 * pairs)
+	for i := 0; i < pairs; i++ {
+		go func() {
+			defer wg.Done()
+			for v := 1; v <= items; v++ {
+				if err := b.Put(ctx, v); err != nil {
+					out.Printf("%s: put: %v\n", name, err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < items; j++ {
+				v, err := b.Get(ctx)
+				if err != nil {
+					out.Printf("%s: get: %v\n", name, err)
+					return
+				}
+				received.Add(1)
+				sum.Add(int64(v))
+			}
+		}()
+	}
+	wg.Wait()
+	wantSum := int64(pairs) * int64(items) * int64(items+1) / 2
+	out.Printf("%s: items: %d of %d, sum ok: %t\n", name, received.Load(), pairs*items, sum.Load() == wantSum)
+}
+
+// shardedCounter счетчик, защищенный собственным мьютексом; дополнен до размера
+// строки кэша, чтобы соседние шарды не делили одну строку
+type shardedCounter struct {
+	mu sync.Mutex
+	n  int64
+	_  [48]byte
+}
+
+// Тест LockConvoy: горутины в течение duration многократно захватывают мьютекс вокруг
+// крошечной критической секции и после освобождения уступают процессор (runtime.Gosched),
+// из-за чего мьютекс постоянно передается следующей горутине в очереди. При shards == 1
+// все горутины делят один мьютекс, при shards > 1 горутина i использует шард i % shards.
+func testLockConvoy(name string, shards int, duration time.Duration) {
+	var wg sync.WaitGroup
+	counters := make([]shardedCounter, shards)
+	deadline := time.Now().Add(duration)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(c *shardedCounter) {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				c.mu.Lock()
+				c.n++ // Крошечная критическая секция
+				c.mu.Unlock()
+				runtime.Gosched() // Передача управления следующей горутине
+			}
+		}(&counters[i%shards])
+	}
+	wg.Wait()
+
+	var total int64
+	for i := range counters {
+		total += counters[i].n
+	}
+	out.Printf("%s: %d shard(s), %.0f ops/s\n", name, shards, float64(total)/duration.Seconds())
+}
+
+// printSelectReport выводит пояснение к результатам теста Select
+func printSelectReport() {
+	out.Printf("Select: блокирующее чтение не тратит процессор на ожидание и не выделяет память.\n")
+	out.Printf("select с default превращает ожидание в активный опрос: обработчики занимают процессор\n")
+	out.Printf("и отнимают его у диспетчера. select с time.After на каждой итерации создает новый\n")
+	out.Printf("таймер, поэтому в горячем цикле растут выделения памяти и нагрузка на сборщик мусора.\n")
+	out.Printf("TimerPool дает тот же таймаут, переиспользуя остановленные таймеры.\n")
+}
+
+// Способ получения задач из канала: обработать все задачи до закрытия канала
+type receiver func(tasks <-chan int, handle func(int))
+
+// receiveBlocking блокирующее чтение: горутина спит, пока задачи нет
+func receiveBlocking(tasks <-chan int, handle func(int)) {
+	for t := range tasks {
+		handle(t)
+	}
+}
+
+// receivePoll select с default: активный опрос канала, процессор занят даже без задач
+func receivePoll(tasks <-chan int, handle func(int)) {
+	for {
+		select {
+		case t, ok := <-tasks:
+			if !ok {
+				return
+			}
+			handle(t)
+		default: // Задачи нет, сразу пробуем снова
+		}
+	}
+}
+
+// Таймаут ожидания задачи в вариантах select с таймером
+const selectTimeout = time.Millisecond
+
+// receiveTimeAfter select с time.After: каждая итерация создает новый таймер
+func receiveTimeAfter(tasks <-chan int, handle func(int)) {
+	for {
+		select {
+		case t, ok := <-tasks:
+			if !ok {
+				return
+			}
+			handle(t)
+		case <-time.After(selectTimeout): // Таймаут: задачи нет, ждем дальше
+		}
+	}
+}
+
+// receivePooledTimer select с таймером из пула: тот же таймаут без выделений памяти
+func receivePooledTimer(tasks <-chan int, handle func(int)) {
+	for {
+		t := timers.Get(selectTimeout)
+		select {
+		case task, ok := <-tasks:
+			timers.Put(t)
+			if !ok {
+				return
+			}
+			handle(task)
+		case <-t.C: // Таймаут: задачи нет, ждем дальше
+			timers.Put(t)
+		}
+	}
+}
+
+// Тест Select: диспетчер в течение duration раздает задачи numGoroutines обработчикам
+// через очередь на numGoroutines задач, обработчики получают их способом recv.
+// Кроме скорости выводится число выделений памяти на задачу, чтобы была видна цена time.After
+func testSelect(name string, recv receiver, duration time.Duration) {
+	var wg sync.WaitGroup
+	ch := make(chan int, numGoroutines)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			recv(ch, func(int) { work.Do() })
+		}()
+	}
+	deadline := start.Add(duration)
+	tasks := 0
+	for ; time.Now().Before(deadline); tasks++ {
+		ch <- tasks
+	}
+	close(ch)
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	out.Printf("%s: %.0f tasks/s, %.2f allocs/task\n", name,
+		float64(tasks)/elapsed.Seconds(), float64(after.Mallocs-before.Mallocs)/float64(max(tasks, 1)))
+}
+
+// Counter счетчик событий без общей точки конкуренции: у каждой горутины свой слот,
+// дополненный до строки кэша, а значение счетчика — сумма слотов при чтении.
+// Запись дешевле, чем у одного атомарного счетчика, чтение дороже
+type Counter struct {
+	slots []counterSlot
+}
+
+// counterSlot слот счетчика, занимающий отдельную строку кэша
+type counterSlot struct {
+	n atomic.Int64
+	_ [56]byte
+}
+
+// NewCounter создает счетчик на slots слотов (обычно по одному на горутину)
+func NewCounter(slots int) *Counter {
+	return &Counter{slots: make([]counterSlot, slots)}
+}
+
+// Add добавляет delta в слот горутины slot
+func (c *Counter) Add(slot int, delta int64) {
+	c.slots[slot%len(c.slots)].n.Add(delta)
+}
+
+// Load возвращает сумму всех слотов
+func (c *Counter) Load() int64 {
+	var total int64
+	for i := range c.slots {
+		total += c.slots[i].n.Load()
+	}
+	return total
+}
+
+// mutexCounter счетчик под мьютексом для сравнения с Counter
+type mutexCounter struct {
+	mu sync.Mutex
+	n  int64
+}
+
+func (c *mutexCounter) Add(_ int, delta int64) {
+	c.mu.Lock()
+	c.n += delta
+	c.mu.Unlock()
+}
+
+func (c *mutexCounter) Load() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// atomicCounter один атомарный счетчик на все горутины для сравнения с Counter
+type atomicCounter struct {
+	n atomic.Int64
+}
+
+func (c *atomicCounter) Add(_ int, delta int64) { c.n.Add(delta) }
+func (c *atomicCounter) Load() int64            { return c.n.Load() }
+
+// Общий интерфейс счетчиков в сравнительном тесте
+type eventCounter interface {
+	Add(slot int, delta int64)
+	Load() int64
+}
+
+// Тест Counter: numGoroutines горутин увеличивают счетчик по increments раз,
+// горутина i пишет в слот i
+func testCounter(name string, c eventCounter, increments int) {
+	var wg sync.WaitGroup
+	start := time.Now()
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(slot int) {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				c.Add(slot, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	duration := time.Since(start)
+	total := c.Load()
+	out.Printf("%s: total: %d, %.0f ops/s\n", name, total, float64(total)/duration.Seconds())
+}
+
+// printLockConvoyReport выводит пояснение к результатам теста LockConvoy
+func printLockConvoyReport() {
+	out.Printf("Lock convoy: когда много горутин постоянно захватывают один мьютекс, каждое\n")
+	out.Printf("освобождение будит следующую горутину из очереди, и время уходит на переключения,\n")
+	out.Printf("а не на работу в критической секции. Разделение состояния на шарды с отдельными\n")
+	out.Printf("мьютексами убирает общую очередь: горутины конкурируют только внутри своего шарда.\n")
+}
+
+// Общий интерфейс блокировки чтения-записи (ему удовлетворяет sync.RWMutex)
+type rwLocker interface {
+	RLock()
+	RUnlock()
+	Lock()
+	Unlock()
+}
+
+// naiveRWLock наивная блокировка с приоритетом читателей: первый читатель захватывает
+// блокировку записи, последний освобождает. Пока читатели перекрываются, писатель ждет бесконечно.
+type naiveRWLock struct {
+	mu      sync.Mutex // Защищает счетчик читателей
+	readers int
+	w       sync.Mutex // Блокировка записи
+}
+
+func (l *naiveRWLock) RLock() {
+	l.mu.Lock()
+	l.readers++
+	if l.readers == 1 {
+		l.w.Lock()
+	}
+	l.mu.Unlock()
+}
+
+func (l *naiveRWLock) RUnlock() {
+	l.mu.Lock()
+	l.readers--
+	if l.readers == 0 {
+		l.w.Unlock()
+	}
+	l.mu.Unlock()
+}
+
+func (l *naiveRWLock) Lock()   { l.w.Lock() }
+func (l *naiveRWLock) Unlock() { l.w.Unlock() }
+
+// Тест RWStarvation: непрерывный поток читателей с перекрывающимися чтениями и один писатель.
+// Выводит количество записей и максимальное время ожидания писателя.
+func testRWStarvation(name string, l rwLocker, duration time.Duration) {
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(duration)
+
+	// Читатели: все горутины, кроме одной
+	wg.Add(numGoroutines - 1)
+	for i := 0; i < numGoroutines-1; i++ {
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				l.RLock()
+				time.Sleep(100 * time.Microsecond) // Чтение
+				l.RUnlock()
+			}
+		}()
+	}
+
+	// Писатель
+	var writes int
+	var maxWait time.Duration
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for time.Now().Before(deadline) {
+			start := time.Now()
+			l.Lock()
+			if wait := time.Since(start); wait > maxWait {
+				maxWait = wait
+			}
+			writes++
+			l.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	out.Printf("%s: writes: %d, max writer wait: %v\n", name, writes, maxWait)
+}
+
+// Количество узлов в пуле lock-free стека
+const abaNodes = 8
+
+// abaStack lock-free стек (стек Трайбера) над фиксированным пулом узлов.
+// Узлы задаются номерами 1..abaNodes, 0 означает пустой стек. Младшие 32 бита head
+// хранят номер верхнего узла. В версии tagged старшие 32 бита хранят счетчик версий,
+// который увеличивается при каждом изменении head, поэтому устаревший CAS не проходит.
+type abaStack struct {
+	head   uint64
+	next   [abaNodes]uint32 // Номер следующего узла
+	owned  [abaNodes]int32  // 1, если узел сейчас извлечен из стека
+	tagged bool
+}
+
+// newABAStack создает стек, содержащий все узлы пула
+func newABAStack(tagged bool) *abaStack {
+	s := &abaStack{tagged: tagged}
+	for i := uint32(1); i <= abaNodes; i++ {
+		s.Push(i)
+	}
+	return s
+}
+
+// pack формирует новое значение head с вершиной top на основе старого значения
+func (s *abaStack) pack(old uint64, top uint32) uint64 {
+	if s.tagged {
+		return (old>>32+1)<<32 | uint64(top)
+	}
+	return uint64(top)
+}
+
+func (s *abaStack) Push(node uint32) {
+	for {
+		old := atomic.LoadUint64(&s.head)
+		atomic.StoreUint32(&s.next[node-1], uint32(old))
+		if atomic.CompareAndSwapUint64(&s.head, old, s.pack(old, node)) {
+			return
+		}
+	}
+}
+
+func (s *abaStack) Pop() uint32 {
+	for {
+		old := atomic.LoadUint64(&s.head)
+		top := uint32(old)
+		if top == 0 {
+			return 0
+		}
+		next := atomic.LoadUint32(&s.next[top-1])
+		// Окно между чтением next и CAS: другие горутины успевают извлечь top,
+		// изменить стек и вернуть top обратно (A -> B -> A)
+		runtime.Gosched()
+		if atomic.CompareAndSwapUint64(&s.head, old, s.pack(old, next)) {
+			return top
+		}
+	}
+}
+
+// Тест ABA: горутины извлекают узлы из стека и возвращают их обратно. Повреждение стека
+// из-за ABA проявляется как повторное извлечение узла, который уже кем-то извлечен,
+// или как потеря узлов: в конце стек разбирается и подсчитываются оставшиеся в нем узлы.
+func testABA(name string, tagged bool, iterations int) {
+	var wg sync.WaitGroup
+	var doublePops int32
+	s := newABAStack(tagged)
+
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				node := s.Pop()
+				if node == 0 {
+					continue
+				}
+				if !atomic.CompareAndSwapInt32(&s.owned[node-1], 0, 1) {
+					// Узел уже принадлежит другой горутине: она и вернет его в стек
+					atomic.AddInt32(&doublePops, 1)
+					continue
+				}
+				for k := rand.Intn(3); k > 0; k-- {
+					runtime.Gosched() // Работа с узлом случайной длительности
+				}
+				atomic.StoreInt32(&s.owned[node-1], 0)
+				s.Push(node)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Разбираем стек; ограничение числа шагов защищает от циклов в поврежденном стеке
+	seen := make(map[uint32]bool)
+	for steps := 0; steps < 2*abaNodes; steps++ {
+		node := s.Pop()
+		if node == 0 {
+			break
+		}
+		seen[node] = true
+	}
+	out.Printf("%s: double pops: %d, nodes left: %d/%d\n", name, doublePops, len(seen), abaNodes)
+}
+
+// applyEnv задает флагам, не указанным в командной строке, значения из переменных окружения
+// LAB4_SYNC_<ФЛАГ> или LAB4_<ФЛАГ>. Приоритет: флаг > переменная окружения > значение по умолчанию
+func applyEnv(fs *flag.FlagSet, program string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		for _, name := range envNames(program, f.Name) {
+			if value, ok := os.LookupEnv(name); ok {
+				if setErr := fs.Set(f.Name, value); setErr != nil {
+					err = fmt.Errorf("%s=%q: %w", name, value, setErr)
+				}
+				return
+			}
+		}
+	})
+	return err
+}
+
+// envNames возвращает имена переменных окружения флага в порядке проверки: сначала
+// с именем программы, затем общее для всех программ лабораторной работы
+func envNames(program, flagName string) []string {
+	name := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if program == "" {
+		return []string{"LAB4_" + name}
+	}
+	return []string{"LAB4_" + strings.ToUpper(program) + "_" + name, "LAB4_" + name}
 }
 
 func main() {
+	syncOutput := flag.Bool("sync-output", false, "печатать синхронно, без асинхронного буфера вывода")
+	debugMutex := flag.Bool("debug-mutex", false, "использовать DebugMutex в тестах Mutex и Monitor")
+	exportPath := flag.String("export", "", "записать результаты сценариев в файл в формате JSON Lines")
+	workName := flag.String("work", "cpu", "работа внутри и вне критической секции: "+strings.Join(workUnits, ", "))
+	flag.Parse()
+	if err := applyEnv(flag.CommandLine, "sync"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *debugMutex {
+		newMutex = func() sync.Locker { return &DebugMutex{} }
+	}
+	var err error
+	if work, err = newWorkUnit(*workName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	rand.Seed(time.Now().UnixNano()) // Инициализация генератора случайных чисел
+
+	// По умолчанию сценарии печатают через асинхронный буфер, чтобы запись в stdout
+	// не выстраивала горутины в очередь и не искажала замеры
+	if !*syncOutput {
+		out = NewAsyncLogger(os.Stdout, 4096)
+	}
+	defer out.Flush()
+
+	printEnvironment()
 	var wg sync.WaitGroup
 
 	// Тест Mutex
-	mu := &sync.Mutex{}
+	mu := newMutex()
 	StopWatch("Mutex", func() {
 		wg.Add(numGoroutines)
 		for i := 0; i < numGoroutines; i++ {
@@ -110,6 +1988,22 @@ func main() {
 		wg.Wait()
 	})
 
+	// Тест MutexHandoff: перехват владения у sync.Mutex против строгой очереди FIFOMutex
+	handoffDuration := 200 * time.Millisecond
+	StopWatch("MutexHandoff(sync.Mutex)", func() { testMutexHandoff("MutexHandoff(sync.Mutex)", &sync.Mutex{}, handoffDuration) })
+	StopWatch("MutexHandoff(FIFO)", func() { testMutexHandoff("MutexHandoff(FIFO)", &FIFOMutex{}, handoffDuration) })
+	StopWatch("MutexHandoff(Reentrant)", func() {
+		testMutexHandoff("MutexHandoff(Reentrant)", &ReentrantMutex{}, handoffDuration)
+	})
+
+	// Тест LockCost: цена повторного захвата по сравнению с sync.Mutex
+	lockIterations := 10000
+	StopWatch("LockCost(sync.Mutex)", func() { testLockCost("LockCost(sync.Mutex)", &sync.Mutex{}, 1, lockIterations) })
+	StopWatch("LockCost(Reentrant)", func() { testLockCost("LockCost(Reentrant)", &ReentrantMutex{}, 1, lockIterations) })
+	StopWatch("LockCost(Reentrant, depth 3)", func() {
+		testLockCost("LockCost(Reentrant, depth 3)", &ReentrantMutex{}, 3, lockIterations)
+	})
+
 	// Тест Semaphore
 	sem := make(chan struct{}, 3) // Ограничение на 3 горутины
 	StopWatch("Semaphore", func() {
@@ -130,15 +2024,54 @@ func main() {
 		wg.Wait()
 	})
 
-	// Тест Barrier
-	barrier := &sync.WaitGroup{}
-	barrier.Add(numGoroutines)
-	StopWatch("Barrier", func() {
-		wg.Add(numGoroutines)
-		for i := 0; i < numGoroutines; i++ {
-			go testBarrier(&wg, barrier)
-		}
-		wg.Wait()
+	// Сравнение реализаций семафора под одинаковой нагрузкой
+	semDuration := 200 * time.Millisecond
+	StopWatch("Semaphore(chan)", func() { testSemaphoreVariant("Semaphore(chan)", make(chanSemaphore, 3), semDuration) })
+	StopWatch("Semaphore(custom)", func() { testSemaphoreVariant("Semaphore(custom)", NewSemaphore(3), semDuration) })
+
+	// Семафор с приоритетами против FIFO-семафора: ожидание горутин с разными приоритетами
+	fifo := NewSemaphore(3)
+	StopWatch("PrioritySemaphore(FIFO)", func() {
+		testPrioritySemaphore("PrioritySemaphore(FIFO)", func(int) { fifo.Acquire() }, fifo.Release, semDuration)
+	})
+	for _, aging := range []time.Duration{0, time.Millisecond} {
+		name := fmt.Sprintf("PrioritySemaphore(aging=%v)", aging)
+		sem := NewPrioritySemaphore(3, aging)
+		StopWatch(name, func() { testPrioritySemaphore(name, sem.AcquirePriority, sem.Release, semDuration) })
+	}
+
+	// Тест Barrier: четыре реализации на одной и той же нагрузке
+	barrierPhases := 100
+	barrierVariants := []struct {
+		name       string
+		newBarrier func(n int) barrier
+		reusable   bool
+	}{
+		{"Barrier(WaitGroup)", newWGBarrier, false},
+		{"Barrier(Cond)", newCondBarrier, false},
+		{"Barrier(chan)", newChanBarrier, false},
+		{"Barrier(cyclic)", func(n int) barrier { return NewCyclicBarrier(n) }, true},
+	}
+	for _, v := range barrierVariants {
+		var violations int32
+		StopWatch(v.name, func() {
+			violations = testBarrier(v.newBarrier, v.reusable, barrierPhases)
+		})
+		out.Printf("%s: phases: %d, violations: %d\n", v.name, barrierPhases, violations)
+	}
+
+	// Тест Event: задержка пробуждения для двух реализаций
+	eventRounds := 100
+	StopWatch("Event(chan)", func() { testEvent("Event(chan)", NewChanEvent(), eventRounds) })
+	StopWatch("Event(Cond)", func() { testEvent("Event(Cond)", NewCondEvent(), eventRounds) })
+
+	// Тест ThreadPinning: опоздание пробуждения без закрепления за потоком ОС и с ним
+	pinInterval, pinTicks := time.Millisecond, 100
+	StopWatch("ThreadPinning(goroutine)", func() {
+		testThreadPinning("ThreadPinning(goroutine)", false, pinInterval, pinTicks)
+	})
+	StopWatch("ThreadPinning(LockOSThread)", func() {
+		testThreadPinning("ThreadPinning(LockOSThread)", true, pinInterval, pinTicks)
 	})
 
 	// Тест SpinLock
@@ -167,15 +2100,77 @@ func main() {
 	})
 
 	// Тест Monitor
-	mu = &sync.Mutex{}
-	cond := sync.NewCond(mu)
+	mu = newMutex()
 	StopWatch("Monitor", func() {
+		// Таймаут только страхует от ошибки синхронизации: сигнал подается после того,
+		// как ждут все горутины, и не теряется
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		state := newMonitorState(mu)
 		wg.Add(numGoroutines)
 		for i := 0; i < numGoroutines; i++ {
-			go testMonitor(&wg, mu, cond)
+			go testMonitor(ctx, &wg, state)
+		}
+		if err := state.broadcast(ctx, numGoroutines); err != nil { // Сигнал всем горутинам для продолжения
+			out.Printf("Monitor: %v\n", err)
 		}
-		time.Sleep(time.Microsecond * 1000) // Даём время горутинам заблокироваться
-		cond.Broadcast() // Сигнал всем горутинам для продолжения
 		wg.Wait()
 	})
+
+	// Тест BoundedBuffer: производители и потребители через буфер на CondCtx
+	StopWatch("BoundedBuffer", func() { testBoundedBuffer("BoundedBuffer", 4, 1000) })
+
+	// Тест CondTimeout: ожидание CondCtx прерывается по таймауту
+	StopWatch("CondTimeout", func() { testCondTimeout("CondTimeout", 5*time.Millisecond) })
+
+	// Тест LockConvoy: один общий мьютекс против шардированных
+	convoyDuration := 200 * time.Millisecond
+	StopWatch("LockConvoy(single)", func() { testLockConvoy("LockConvoy(single)", 1, convoyDuration) })
+	StopWatch("LockConvoy(sharded)", func() { testLockConvoy("LockConvoy(sharded)", numGoroutines, convoyDuration) })
+	printLockConvoyReport()
+
+	// Тест RWStarvation: наивная блокировка с приоритетом читателей против sync.RWMutex
+	rwDuration := 300 * time.Millisecond
+	StopWatch("RWStarvation(naive)", func() { testRWStarvation("RWStarvation(naive)", &naiveRWLock{}, rwDuration) })
+	StopWatch("RWStarvation(sync.RWMutex)", func() { testRWStarvation("RWStarvation(sync.RWMutex)", &sync.RWMutex{}, rwDuration) })
+
+	// Тест ABA: lock-free стек без версий и с версиями в head
+	abaIterations := 10000
+	StopWatch("ABA(naive)", func() { testABA("ABA(naive)", false, abaIterations) })
+	StopWatch("ABA(tagged)", func() { testABA("ABA(tagged)", true, abaIterations) })
+
+	// Тест Output: синхронный и асинхронный вывод одной и той же нагрузки в /dev/null
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		out.Printf("Output: %v\n", err)
+		return
+	}
+	defer devNull.Close()
+	outputLines := 1000
+	StopWatch("Output(sync)", func() { testOutput(&syncLogger{w: devNull}, outputLines) })
+	StopWatch("Output(async)", func() {
+		l := NewAsyncLogger(devNull, 4096)
+		testOutput(l, outputLines)
+		l.Close()
+	})
+
+	// Тест Counter: один атомарный счетчик, счетчик под мьютексом и счетчик со слотами
+	counterIncrements := 100000
+	StopWatch("Counter(atomic)", func() { testCounter("Counter(atomic)", &atomicCounter{}, counterIncrements) })
+	StopWatch("Counter(mutex)", func() { testCounter("Counter(mutex)", &mutexCounter{}, counterIncrements) })
+	StopWatch("Counter(sharded)", func() { testCounter("Counter(sharded)", NewCounter(numGoroutines), counterIncrements) })
+
+	// Тест Select: одна и та же раздача задач с разными способами получения из канала
+	selectDuration := 200 * time.Millisecond
+	StopWatch("Select(blocking)", func() { testSelect("Select(blocking)", receiveBlocking, selectDuration) })
+	StopWatch("Select(default)", func() { testSelect("Select(default)", receivePoll, selectDuration) })
+	StopWatch("Select(time.After)", func() { testSelect("Select(time.After)", receiveTimeAfter, selectDuration) })
+	StopWatch("Select(TimerPool)", func() { testSelect("Select(TimerPool)", receivePooledTimer, selectDuration) })
+	printSelectReport()
+
+	if *exportPath != "" {
+		if err := exportResults(*exportPath); err != nil {
+			out.Printf("Export: %v\n", err)
+		}
+	}
 }